@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"io"
+	"time"
+)
+
+// timeClaims are the claims printed as human-readable times, in order.
+// Claims that are missing or 0 are skipped.
+var timeClaims = []string{
+	lcom.JWTClaimExpiresAtKey,
+	lcom.JWTClaimIssuedAtKey,
+	lcom.JWTClaimNotBeforeKey,
+	"auth_time",
+}
+
+// decode pretty-prints the header and claims of a JWT without verifying its
+// signature, followed by its time claims in RFC 3339 and relative to now.
+func decode(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// decode doesn't need any keys, so unlike mint and verify it has no
+	// -env-file flag
+	flags := flag.NewFlagSet("ljwt decode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	userJWT, err := readToken(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(userJWT, jwt.MapClaims{})
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to decode the JWT: %s\n", err)
+		return exitInvalid
+	}
+
+	printToken(stdout, token.Header, token.Claims.(jwt.MapClaims), time.Now())
+
+	return exitOK
+}
+
+// printToken prints header, claims and the time claims of claims.
+func printToken(w io.Writer, header map[string]any, claims jwt.MapClaims, now time.Time) {
+	printJSON(w, "Header", header)
+	printJSON(w, "Claims", claims)
+
+	var lines []string
+	for _, key := range timeClaims {
+		seconds, ok := claims[key].(float64)
+		if !ok || seconds == 0 {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("  %-9s %s", key, describeTime(time.Unix(int64(seconds), 0), now)))
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "Times:")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// printJSON prints value as indented JSON under title.
+func printJSON(w io.Writer, title string, value any) {
+	indented, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		indented = []byte(fmt.Sprint(value))
+	}
+
+	fmt.Fprintf(w, "%s:\n%s\n", title, indented)
+}
+
+// describeTime formats t in UTC and relative to now, such as
+// "2026-10-16T12:00:00Z (in 59m0s)" or "2026-10-16T10:00:00Z (1h0m0s ago)".
+func describeTime(t, now time.Time) string {
+	formatted := t.UTC().Format(time.RFC3339)
+
+	diff := t.Sub(now).Round(time.Second)
+	if diff >= 0 {
+		return fmt.Sprintf("%s (in %s)", formatted, diff)
+	}
+
+	return fmt.Sprintf("%s (%s ago)", formatted, -diff)
+}
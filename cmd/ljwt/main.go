@@ -0,0 +1,115 @@
+// Command ljwt mints, decodes and verifies JWTs for local development with
+// the same environment variables the Lambdas use, so a token for curl is one
+// command away:
+//
+//	ljwt mint -sub user-42 -user-type admin -ttl 1h
+//	ljwt decode eyJhbGciOi...
+//	ljwt verify eyJhbGciOi...
+//
+// mint and verify accept -env-file to load the LAMBDA_JWT_ROUTER_* variables
+// from a .env file. decode and verify read the token from stdin if it isn't
+// passed as an argument.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `usage: ljwt <mode> [flags]
+
+modes:
+  mint    sign ExpandedClaims or StandardClaims built from flags or a JSON file
+  decode  print the header and claims of a JWT without verifying it
+  verify  verify a JWT and report why it fails
+
+run "ljwt <mode> -h" for the flags of a mode
+`
+
+// Exit codes of run.
+const (
+	exitOK      = 0
+	exitInvalid = 1
+	exitUsage   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the mode named by args[0] and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "mint":
+		return mint(args[1:], stdout, stderr)
+	case "decode":
+		return decode(args[1:], stdin, stdout, stderr)
+	case "verify":
+		return verify(args[1:], stdin, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "unknown mode %q\n\n%s", args[0], usage)
+
+	return exitUsage
+}
+
+// newFlagSet returns the flag set of mode with the shared -env-file flag.
+func newFlagSet(mode string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("ljwt "+mode, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	envFile := flags.String("env-file", "", "load environment variables from this .env file first")
+
+	return flags, envFile
+}
+
+// loadEnv loads envFile if it is set. Variables that are already set win.
+func loadEnv(envFile string) error {
+	if envFile == "" {
+		return nil
+	}
+
+	return godotenv.Load(envFile)
+}
+
+// readToken returns the token passed as the only argument or read from
+// stdin. A pasted "Authorization" header value is accepted as well.
+func readToken(args []string, stdin io.Reader) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("expected one token but got %d arguments", len(args))
+	}
+
+	var token string
+	if len(args) == 1 && args[0] != "-" {
+		token = strings.TrimSpace(args[0])
+	} else {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		token = strings.TrimSpace(line)
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("no token passed as argument or on stdin")
+	}
+
+	if scheme, rest, ok := strings.Cut(token, " "); ok && (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "DPoP")) {
+		token = strings.TrimSpace(rest)
+	}
+
+	return token, nil
+}
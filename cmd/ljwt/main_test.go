@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cliSecret = "cli secret"
+
+func setupEnv(t *testing.T) {
+	t.Setenv(lcom.HMACSecretEnvKey, hex.EncodeToString([]byte(cliSecret)))
+	t.Setenv(lcom.JWTAlgorithmsEnvKey, "HS256")
+	t.Setenv(lcom.JWKSURLEnvKey, "")
+	t.Setenv(lcom.PublicKeyEnvKey, "")
+	t.Setenv(lcom.PrivateKeyEnvKey, "")
+	t.Setenv(lcom.HMACKeyringEnvKey, "")
+	t.Setenv(lcom.JWTIssuerEnvKey, "")
+	t.Setenv(lcom.JWTAudienceEnvKey, "")
+	t.Setenv(lcom.JWTLeewayEnvKey, "")
+	t.Setenv(lcom.JWTRequiredClaimsEnvKey, "")
+}
+
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func parseClaims(t *testing.T, token string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(cliSecret), nil
+	})
+	require.Nil(t, err)
+
+	return claims
+}
+
+func TestMint(t *testing.T) {
+	setupEnv(t)
+
+	t.Run("verify mint signs ExpandedClaims from flags", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "", "mint", "-sub", "user-42", "-user-type", "admin", "-claim", "tenant=acme", "-claim", "scope=[\"read\"]", "-ttl", "30m")
+		require.Equal(t, exitOK, code, stderr)
+
+		claims := parseClaims(t, strings.TrimSpace(stdout))
+		require.Equal(t, "user-42", claims[lcom.JWTClaimSubjectKey])
+		require.Equal(t, "admin", claims[lcom.JWTClaimUserTypeKey])
+		require.Equal(t, "acme", claims["tenant"])
+		require.Equal(t, []any{"read"}, claims["scope"])
+		require.Contains(t, claims, lcom.JWTClaimEmailKey)
+		require.InDelta(t, time.Now().Add(30*time.Minute).Unix(), claims[lcom.JWTClaimExpiresAtKey], 5)
+	})
+
+	t.Run("verify flags override the claims file", func(t *testing.T) {
+		claimsFile := filepath.Join(t.TempDir(), "claims.json")
+		err := os.WriteFile(claimsFile, []byte(`{"sub":"from-file","iss":"file-issuer","exp":4102444800,"tenant":"acme"}`), 0o600)
+		require.Nil(t, err)
+
+		code, stdout, stderr := runCLI(t, "", "mint", "-standard", "-claims", claimsFile, "-sub", "from-flag")
+		require.Equal(t, exitOK, code, stderr)
+
+		claims := parseClaims(t, strings.TrimSpace(stdout))
+		require.Equal(t, "from-flag", claims[lcom.JWTClaimSubjectKey])
+		require.Equal(t, "file-issuer", claims[lcom.JWTClaimIssuerKey])
+		require.Equal(t, float64(4102444800), claims[lcom.JWTClaimExpiresAtKey])
+		require.Equal(t, "acme", claims["tenant"])
+		require.NotContains(t, claims, lcom.JWTClaimUserTypeKey)
+	})
+
+	t.Run("verify a malformed claim flag is a usage error", func(t *testing.T) {
+		code, _, _ := runCLI(t, "", "mint", "-claim", "tenant")
+		require.Equal(t, exitUsage, code)
+	})
+}
+
+func TestDecode(t *testing.T) {
+	setupEnv(t)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		lcom.JWTClaimSubjectKey:   "user-42",
+		lcom.JWTClaimExpiresAtKey: exp,
+	}).SignedString([]byte("some other secret"))
+	require.Nil(t, err)
+
+	t.Run("verify decode prints header, claims and times without verifying", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "", "decode", token)
+		require.Equal(t, exitOK, code, stderr)
+		require.Contains(t, stdout, `"alg": "HS512"`)
+		require.Contains(t, stdout, `"sub": "user-42"`)
+		require.Contains(t, stdout, "exp       "+time.Unix(exp, 0).UTC().Format(time.RFC3339)+" (in ")
+	})
+
+	t.Run("verify decode reads an Authorization header value from stdin", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "Bearer "+token+"\n", "decode")
+		require.Equal(t, exitOK, code, stderr)
+		require.Contains(t, stdout, `"sub": "user-42"`)
+	})
+
+	t.Run("verify decode strips the scheme of an argument", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "", "decode", "DPoP "+token)
+		require.Equal(t, exitOK, code, stderr)
+		require.Contains(t, stdout, `"sub": "user-42"`)
+	})
+
+	t.Run("verify decode has no -env-file flag", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "", "decode", "-env-file", ".env", token)
+		require.Equal(t, exitUsage, code)
+		require.Contains(t, stderr, "-env-file")
+	})
+
+	t.Run("verify decode rejects garbage", func(t *testing.T) {
+		code, _, _ := runCLI(t, "", "decode", "not-a-jwt")
+		require.Equal(t, exitInvalid, code)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	setupEnv(t)
+
+	sign := func(method jwt.SigningMethod, secret string, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+		require.Nil(t, err)
+		return token
+	}
+
+	valid := jwt.MapClaims{lcom.JWTClaimSubjectKey: "user-42", lcom.JWTClaimExpiresAtKey: time.Now().Add(time.Hour).Unix()}
+
+	t.Run("verify a valid JWT", func(t *testing.T) {
+		code, stdout, _ := runCLI(t, "", "verify", sign(jwt.SigningMethodHS256, cliSecret, valid))
+		require.Equal(t, exitOK, code)
+		require.True(t, strings.HasPrefix(stdout, "valid\n"))
+		require.Contains(t, stdout, `"sub": "user-42"`)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{
+			name:   "expired",
+			token:  sign(jwt.SigningMethodHS256, cliSecret, jwt.MapClaims{lcom.JWTClaimExpiresAtKey: time.Now().Add(-time.Hour).Unix()}),
+			reason: "expired",
+		},
+		{
+			name:   "algorithm",
+			token:  sign(jwt.SigningMethodHS512, cliSecret, valid),
+			reason: "algorithm not allowed",
+		},
+		{
+			name:   "signature",
+			token:  sign(jwt.SigningMethodHS256, "wrong secret", valid),
+			reason: "signature invalid",
+		},
+		{
+			name:   "malformed",
+			token:  "not.a.jwt",
+			reason: "malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("verify the "+tt.name+" failure is reported", func(t *testing.T) {
+			code, stdout, _ := runCLI(t, "", "verify", tt.token)
+			require.Equal(t, exitInvalid, code)
+			require.True(t, strings.HasPrefix(stdout, "invalid: "+tt.reason+"\n"), stdout)
+			require.NotContains(t, stdout, "%w")
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	code, _, stderr := runCLI(t, "")
+	require.Equal(t, exitUsage, code)
+	require.Contains(t, stderr, "usage: ljwt")
+
+	code, _, stderr = runCLI(t, "", "sign")
+	require.Equal(t, exitUsage, code)
+	require.Contains(t, stderr, `unknown mode "sign"`)
+}
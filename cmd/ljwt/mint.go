@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// claimValues collects repeated -claim key=value flags. Values that are
+// valid JSON, such as numbers, booleans or arrays, keep their type and
+// everything else is a string.
+type claimValues jwt.MapClaims
+
+func (c claimValues) String() string {
+	return ""
+}
+
+func (c claimValues) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value but got %q", value)
+	}
+
+	var parsed any
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+
+	c[key] = parsed
+
+	return nil
+}
+
+// mint signs the ExpandedClaims, or with -standard the jwt.StandardClaims,
+// built from the -claims file and the flags with ljwt.Sign and prints the
+// JWT. Flags win over the file and -claim wins over both.
+func mint(args []string, stdout, stderr io.Writer) int {
+	flags, envFile := newFlagSet("mint", stderr)
+	standard := flags.Bool("standard", false, "sign jwt.StandardClaims instead of ExpandedClaims")
+	claimsFile := flags.String("claims", "", "JSON file with the claims to start from")
+	ttl := flags.Duration("ttl", time.Hour, "lifetime of the JWT, used for exp unless the claims set it")
+	extra := claimValues{}
+	flags.Var(extra, "claim", "extra claim as key=value, may be repeated")
+
+	expanded := ljwt.ExpandedClaims{}
+	flags.StringVar(&expanded.Audience, "aud", "", "audience")
+	flags.StringVar(&expanded.Email, "email", "", "email (ExpandedClaims only)")
+	flags.StringVar(&expanded.FirstName, "first-name", "", "first name (ExpandedClaims only)")
+	flags.StringVar(&expanded.FullName, "full-name", "", "full name (ExpandedClaims only)")
+	flags.StringVar(&expanded.ID, "jti", "", "JWT ID")
+	flags.StringVar(&expanded.Issuer, "iss", "", "issuer")
+	flags.StringVar(&expanded.Level, "level", "", "level (ExpandedClaims only)")
+	flags.StringVar(&expanded.Subject, "sub", "", "subject")
+	flags.StringVar(&expanded.UserType, "user-type", "", "user type (ExpandedClaims only)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments %q\n", flags.Args())
+		return exitUsage
+	}
+
+	if err := loadEnv(*envFile); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	fileClaims := jwt.MapClaims{}
+	if *claimsFile != "" {
+		contents, err := os.ReadFile(*claimsFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+
+		if err = json.Unmarshal(contents, &fileClaims); err != nil {
+			fmt.Fprintf(stderr, "unable to parse %s: %s\n", *claimsFile, err)
+			return exitUsage
+		}
+	}
+
+	mapClaims, err := buildClaims(fileClaims, expanded, setFlags(flags), *standard)
+	if err != nil {
+		if *claimsFile != "" {
+			fmt.Fprintf(stderr, "unable to use the claims of %s: %s\n", *claimsFile, err)
+		} else {
+			fmt.Fprintf(stderr, "unable to build the claims: %s\n", err)
+		}
+		return exitUsage
+	}
+
+	for key, value := range extra {
+		mapClaims[key] = value
+	}
+
+	now := time.Now()
+	if isZero(mapClaims[lcom.JWTClaimIssuedAtKey]) {
+		mapClaims[lcom.JWTClaimIssuedAtKey] = now.Unix()
+	}
+
+	if isZero(mapClaims[lcom.JWTClaimExpiresAtKey]) {
+		mapClaims[lcom.JWTClaimExpiresAtKey] = now.Add(*ttl).Unix()
+	}
+
+	signed, err := ljwt.Sign(mapClaims)
+	if err != nil {
+		fmt.Fprintln(stderr, displayError(err))
+		return exitInvalid
+	}
+
+	fmt.Fprintln(stdout, signed)
+
+	return exitOK
+}
+
+// buildClaims converts fileClaims into ExpandedClaims or jwt.StandardClaims,
+// overrides the fields whose flags are set and returns the result with the
+// keys of fileClaims that aren't part of the struct.
+func buildClaims(fileClaims jwt.MapClaims, flagged ljwt.ExpandedClaims, set map[string]bool, standard bool) (jwt.MapClaims, error) {
+	expanded := ljwt.ExpandedClaims{}
+	if err := ljwt.ExtractCustom(fileClaims, &expanded); err != nil {
+		return nil, err
+	}
+
+	override := func(name string, dst *string, value string) {
+		if set[name] {
+			*dst = value
+		}
+	}
+
+	override("aud", &expanded.Audience, flagged.Audience)
+	override("email", &expanded.Email, flagged.Email)
+	override("first-name", &expanded.FirstName, flagged.FirstName)
+	override("full-name", &expanded.FullName, flagged.FullName)
+	override("jti", &expanded.ID, flagged.ID)
+	override("iss", &expanded.Issuer, flagged.Issuer)
+	override("level", &expanded.Level, flagged.Level)
+	override("sub", &expanded.Subject, flagged.Subject)
+	override("user-type", &expanded.UserType, flagged.UserType)
+
+	var mapClaims jwt.MapClaims
+	if standard {
+		mapClaims = ljwt.ExtendStandard(jwt.StandardClaims{
+			Audience:  expanded.Audience,
+			ExpiresAt: expanded.ExpiresAt,
+			Id:        expanded.ID,
+			IssuedAt:  expanded.IssuedAt,
+			Issuer:    expanded.Issuer,
+			NotBefore: expanded.NotBefore,
+			Subject:   expanded.Subject,
+		})
+	} else {
+		mapClaims = ljwt.ExtendExpanded(expanded)
+	}
+
+	for key, value := range fileClaims {
+		if _, ok := mapClaims[key]; !ok {
+			mapClaims[key] = value
+		}
+	}
+
+	return mapClaims, nil
+}
+
+// setFlags returns the names of the flags set on the command line.
+func setFlags(flags *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	return set
+}
+
+// isZero reports whether a numeric claim is missing or 0.
+func isZero(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"io"
+	"strings"
+	"time"
+)
+
+// failureReasons map the errors of ljwt.VerifyJWT to the reason verify
+// reports, most specific first. lcom.ErrInvalidJWT is the fallback.
+var failureReasons = []struct {
+	err    error
+	reason string
+}{
+	{lcom.ErrTokenExpired, "expired"},
+	{lcom.ErrTokenNotValidYet, "not valid yet"},
+	{lcom.ErrTokenIssuedInFuture, "issued in the future"},
+	{lcom.ErrInvalidIssuer, "issuer not accepted"},
+	{lcom.ErrInvalidAudience, "audience not accepted"},
+	{lcom.ErrMissingClaim, "missing required claim"},
+	{lcom.ErrTokenRevoked, "revoked"},
+	{lcom.ErrRevocationCheck, "revocation check failed"},
+	{lcom.ErrUnknownKeyID, "unknown key ID"},
+	{lcom.ErrUnsupportedSigningMethod, "algorithm not allowed"},
+	{lcom.ErrJWKSFetch, "JWKS fetch failed"},
+	{lcom.ErrInvalidKey, "invalid key configuration"},
+	{lcom.ErrInvalidHMACSecret, "invalid key configuration"},
+	{lcom.ErrInvalidKeyring, "invalid key configuration"},
+	{lcom.ErrNoVerificationKey, "invalid key configuration"},
+}
+
+// verify verifies a JWT with ljwt.VerifyJWT and the LAMBDA_JWT_ROUTER_*
+// environment variables. A valid JWT prints its header and claims; an
+// invalid one prints why it failed and exits with exitInvalid.
+func verify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags, envFile := newFlagSet("verify", stderr)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := loadEnv(*envFile); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	userJWT, err := readToken(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	claims, err := ljwt.VerifyJWT(userJWT)
+	if err != nil {
+		fmt.Fprintf(stdout, "invalid: %s\n", failureReason(err))
+		fmt.Fprintf(stdout, "error: %s\n", displayError(err))
+		return exitInvalid
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(userJWT, jwt.MapClaims{})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalid
+	}
+
+	fmt.Fprintln(stdout, "valid")
+	printToken(stdout, token.Header, claims, time.Now())
+
+	return exitOK
+}
+
+// failureReason returns the reason a JWT failed verification with err. The
+// errors of jwt.Parser, which don't unwrap, are classified by their flags.
+func failureReason(err error) string {
+	for _, failure := range failureReasons {
+		if errors.Is(err, failure.err) {
+			return failure.reason
+		}
+	}
+
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, failure := range failureReasons {
+			if validationErr.Inner != nil && errors.Is(validationErr.Inner, failure.err) {
+				return failure.reason
+			}
+		}
+
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return "malformed"
+		case strings.HasPrefix(validationErr.Error(), "signing method"):
+			return "algorithm not allowed"
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return "signature invalid"
+		}
+	}
+
+	return strings.TrimSuffix(lcom.ErrInvalidJWT.Error(), ": %w")
+}
+
+// displayError returns err without the ": %w" placeholders of the lcom
+// errors.
+func displayError(err error) string {
+	return strings.ReplaceAll(err.Error(), ": %w", "")
+}
@@ -42,10 +42,6 @@ type CreateReq struct {
 }
 
 func Create(ctx context.Context, cReq *CreateReq) (*Book, error) {
-	if err := cReq.Valid(); err != nil {
-		return nil, err
-	}
-
 	book := &Book{
 		Author: cReq.Author,
 		ID:     primitive.NewObjectID(),
@@ -78,10 +74,6 @@ type DeleteReq struct {
 }
 
 func Delete(ctx context.Context, dReq *DeleteReq) (*Book, error) {
-	if err := dReq.Valid(); err != nil {
-		return nil, err
-	}
-
 	singleRes := database.BooksColl.FindOneAndDelete(ctx, bson.M{"_id": dReq.ID})
 	if singleRes.Err() != nil {
 		return nil, singleRes.Err()
@@ -112,10 +104,6 @@ type GetReq struct {
 }
 
 func Get(ctx context.Context, gReq *GetReq) (*Book, error) {
-	if err := gReq.Valid(); err != nil {
-		return nil, err
-	}
-
 	singleRes := database.BooksColl.FindOne(ctx, bson.M{"_id": gReq.ID})
 	if singleRes.Err() != nil {
 		return nil, singleRes.Err()
@@ -161,10 +149,6 @@ type UpdateReq struct {
 }
 
 func Update(ctx context.Context, uReq *UpdateReq) (*Book, error) {
-	if err := uReq.Valid(); err != nil {
-		return nil, err
-	}
-
 	singleRes := database.BooksColl.FindOneAndUpdate(ctx, bson.M{"_id": uReq.ID},
 		bson.M{
 			"$set": bson.M{
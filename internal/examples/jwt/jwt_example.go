@@ -17,15 +17,16 @@ func init() {
 	// implement your own base middleware functions and add to the NewRouter declaration to apply to every route
 	router = lrtr.NewRouter("/api", lmw.InjectLambdaContextMW)
 
-	// to configure middleware at the route level, add them singularly to each route
+	// to configure middleware for a set of routes, add them to a group that shares the routes' prefix
 	// DecodeStandard will automagically check events.Headers["Authorization"] for a valid JWT.
 	// It will look for the LAMBDA_JWT_ROUTER_HMAC_SECRET environment variable and use that to decode
 	// the JWT. If decoding succeeds, it will inject all the standard claims into the context object
 	// before returning so other callers can access those fields at run time.
-	router.Route("DELETE", "/books/:id", books.DeleteLambda, lmw.DecodeStandardMW)
-	router.Route("GET", "/books/:id", books.GetLambda, lmw.DecodeStandardMW)
-	router.Route("POST", "/books", books.CreateLambda, lmw.DecodeStandardMW)
-	router.Route("PUT", "/books/:id", books.UpdateLambda, lmw.DecodeStandardMW)
+	booksGroup := router.Group("/books", lmw.DecodeStandardMW)
+	booksGroup.Route("DELETE", "/:id", books.DeleteLambda)
+	booksGroup.Route("GET", "/:id", books.GetLambda)
+	booksGroup.Route("POST", "/", books.CreateLambda)
+	booksGroup.Route("PUT", "/:id", books.UpdateLambda)
 }
 
 func main() {
@@ -187,6 +187,8 @@ func GenerateStandardMapClaims() jwt.MapClaims {
 	}
 }
 
+// WrapErrors prefixes err2 with the message of err1. Both errors stay in the
+// chain so errors.Is matches either of them.
 func WrapErrors(err1, err2 error) error {
-	return fmt.Errorf(err1.Error()+": %w", err2)
+	return fmt.Errorf("%w: %w", err1, err2)
 }
@@ -11,6 +11,7 @@ import (
 // Use these const values to populate your own custom claim values
 
 const JWTClaimAudienceKey = "aud"
+const JWTClaimClientIDKey = "client_id"
 const JWTClaimEmailKey = "email"
 const JWTClaimExpiresAtKey = "exp"
 const JWTClaimFirstNameKey = "firstName"
@@ -20,8 +21,11 @@ const JWTClaimIssuedAtKey = "iat"
 const JWTClaimIssuerKey = "iss"
 const JWTClaimLevelKey = "level"
 const JWTClaimNotBeforeKey = "nbf"
+const JWTClaimScopeKey = "scope"
+const JWTClaimScpKey = "scp"
 const JWTClaimSubjectKey = "sub"
 const JWTClaimUserTypeKey = "userType"
+const JWTClaimUsernameKey = "username"
 
 // Use these values to get / set the appropriate environment variables for CORS
 
@@ -32,10 +36,44 @@ const CORSMethodsHeaderKey = "Access-Control-Allow-Methods"
 const CORSOriginEnvKey = "LAMBDA_JWT_ROUTER_CORS_ORIGIN"
 const CORSOriginHeaderKey = "Access-Control-Allow-Origin"
 
+// Use these values to get / set the headers used by a CORSPolicy
+
+const CORSCredentialsHeaderKey = "Access-Control-Allow-Credentials"
+const CORSExposeHeadersHeaderKey = "Access-Control-Expose-Headers"
+const CORSMaxAgeHeaderKey = "Access-Control-Max-Age"
+const CORSRequestHeadersHeaderKey = "Access-Control-Request-Headers"
+const CORSRequestMethodHeaderKey = "Access-Control-Request-Method"
+const OriginHeaderKey = "Origin"
+const VaryHeaderKey = "Vary"
+
+// Use these values to get the headers a JWT is extracted from
+
+const AuthorizationHeaderKey = "Authorization"
+const CookieHeaderKey = "Cookie"
+const DPoPHeaderKey = "DPoP"
+
+// Use this value to get / set the JWT claims in the context of a Lambda authorizer
+
+const AuthorizerClaimsKey = "jwtClaims"
+
+// Use this value to tell the caller why its JWT was rejected
+
+const WWWAuthenticateHeaderKey = "WWW-Authenticate"
+
 // Use these values for general environment configuration
 
+const HMACKeyringEnvKey = "LAMBDA_JWT_ROUTER_HMAC_KEYRING"
 const HMACSecretEnvKey = "LAMBDA_JWT_ROUTER_HMAC_SECRET"
+const JWKSURLEnvKey = "LAMBDA_JWT_ROUTER_JWKS_URL"
+const JWTAlgorithmsEnvKey = "LAMBDA_JWT_ROUTER_JWT_ALGORITHMS"
+const JWTAudienceEnvKey = "LAMBDA_JWT_ROUTER_JWT_AUDIENCE"
+const JWTIssuerEnvKey = "LAMBDA_JWT_ROUTER_JWT_ISSUER"
+const JWTLeewayEnvKey = "LAMBDA_JWT_ROUTER_JWT_LEEWAY"
+const JWTRequiredClaimsEnvKey = "LAMBDA_JWT_ROUTER_JWT_REQUIRED_CLAIMS"
 const NoCORS = "LAMBDA_JWT_ROUTER_NO_CORS"
+const PrivateKeyEnvKey = "LAMBDA_JWT_ROUTER_PRIVATE_KEY"
+const PublicKeyEnvKey = "LAMBDA_JWT_ROUTER_PUBLIC_KEY"
+const TokenSourcesEnvKey = "LAMBDA_JWT_ROUTER_TOKEN_SOURCES"
 
 // ContentTypeKey exists because "Content-Type" is not in the http std lib for some reason...
 const ContentTypeKey = "Content-Type"
@@ -55,13 +93,55 @@ const LambdaContextUserTypeKey = "userType"
 var ErrMarshalMapClaims = errors.New("unable to Marshal map claims: %w")
 var ErrNoAuthorizationHeader = errors.New("no Authorization header value set: %w")
 var ErrNoBearerPrefix = errors.New("missing 'Bearer ' prefix for Authorization header value: %w")
+var ErrNoDPoPPrefix = errors.New("missing 'DPoP ' prefix for Authorization header value: %w")
 var ErrVerifyJWT = errors.New("unable to verify JWT to retrieve claims. try logging in again to ensure it is not expired: %w")
 var ErrBadClaimsObject = errors.New("lambda_jwt_router: the provided object to extract claims into is not compatible with the default claim set and its types: %w")
 var ErrUnableToSignToken = errors.New("lambda_jwt_router: the provided claims were unable to be signed: %w")
 var ErrInvalidJWT = errors.New("lambda_jwt_router: the provided JWT is invalid: %w")
 var ErrInvalidToken = errors.New("lambda_jwt_router: the provided jwt was unable to be parsed into a token: %w")
 var ErrInvalidTokenClaims = errors.New("lambda_jwt_router: the provided jwt was unable to be parsed for map claims: %w")
-var ErrUnsupportedSigningMethod = errors.New("lambda_jwt_router:the provided signing method is unsupported. HMAC only allowed: %w")
+var ErrUnsupportedSigningMethod = errors.New("lambda_jwt_router: the provided signing method is unsupported or not in the allowed algorithms: %w")
+var ErrInvalidKey = errors.New("lambda_jwt_router: the provided key is not a supported RSA, ECDSA or Ed25519 PEM key: %w")
+var ErrJWKSFetch = errors.New("lambda_jwt_router: unable to fetch the JWKS: %w")
+var ErrUnknownKeyID = errors.New("lambda_jwt_router: no key matches the kid of the JWT or the key is outside its validity window: %w")
+var ErrInvalidHMACSecret = errors.New("lambda_jwt_router: the HMAC secret is missing or not hex encoded: %w")
+var ErrNoSigningKey = errors.New("lambda_jwt_router: no key to sign the JWT with was configured: %w")
+var ErrNoVerificationKey = errors.New("lambda_jwt_router: no key to verify the JWT with was configured: %w")
+var ErrInvalidKeyring = errors.New("lambda_jwt_router: the HMAC keyring is invalid: %w")
+var ErrInvalidLeeway = errors.New("lambda_jwt_router: the JWT leeway is not a valid duration: %w")
+var ErrTokenExpired = errors.New("lambda_jwt_router: the JWT is expired: %w")
+var ErrTokenNotValidYet = errors.New("lambda_jwt_router: the JWT is not valid yet: %w")
+var ErrTokenIssuedInFuture = errors.New("lambda_jwt_router: the JWT was issued in the future: %w")
+var ErrInvalidIssuer = errors.New("lambda_jwt_router: the JWT issuer is not accepted: %w")
+var ErrInvalidAudience = errors.New("lambda_jwt_router: the JWT audience is not accepted: %w")
+var ErrMissingClaim = errors.New("lambda_jwt_router: the JWT is missing a required claim: %w")
+var ErrTokenRevoked = errors.New("lambda_jwt_router: the JWT has been revoked: %w")
+var ErrRevocationCheck = errors.New("lambda_jwt_router: unable to check whether the JWT has been revoked: %w")
+var ErrTokenInactive = errors.New("lambda_jwt_router: the introspection endpoint reports the access token as inactive: %w")
+var ErrIntrospection = errors.New("lambda_jwt_router: unable to introspect the access token: %w")
+var ErrInvalidDPoPProof = errors.New("lambda_jwt_router: the DPoP proof is missing or invalid: %w")
+var ErrDPoPProofReplayed = errors.New("lambda_jwt_router: the DPoP proof was already used: %w")
+var ErrDPoPKeyMismatch = errors.New("lambda_jwt_router: the access token is not bound to the key of the DPoP proof: %w")
+var ErrDPoPReplayCheck = errors.New("lambda_jwt_router: unable to check whether the DPoP proof was replayed: %w")
+var ErrNoToken = errors.New("lambda_jwt_router: no JWT found in the request: %w")
+var ErrInvalidTokenSource = errors.New("lambda_jwt_router: the token source is invalid: %w")
+var ErrNoRefreshToken = errors.New("lambda_jwt_router: no refresh token found in the request body: %w")
+var ErrInvalidRefreshToken = errors.New("lambda_jwt_router: the refresh token is invalid, expired or revoked: %w")
+var ErrRefreshTokenReused = errors.New("lambda_jwt_router: the refresh token was already used and its token family has been revoked: %w")
+var ErrInvalidMethodARN = errors.New("lambda_jwt_router: the authorizer method ARN is invalid: %w")
+var ErrInvalidAuthorizerClaims = errors.New("lambda_jwt_router: the claims in the authorizer context are invalid: %w")
+var ErrOIDCConfig = errors.New("lambda_jwt_router: the OIDC verifier is misconfigured or its discovery document could not be loaded: %w")
+var ErrInvalidIDToken = errors.New("lambda_jwt_router: the OIDC ID token is invalid: %w")
+var ErrInvalidNonce = errors.New("lambda_jwt_router: the ID token nonce does not match the nonce of the authentication request: %w")
+var ErrInvalidAuthorizedParty = errors.New("lambda_jwt_router: the ID token azp claim is missing or not an accepted client ID: %w")
+var ErrAuthTooOld = errors.New("lambda_jwt_router: the user authenticated longer ago than the max age allows: %w")
+var ErrInvalidAccessTokenHash = errors.New("lambda_jwt_router: the ID token at_hash claim does not match the access token: %w")
+var ErrInvalidPolicy = errors.New("lambda_jwt_router: the access policy is invalid: %w")
+var ErrPolicyNotAllowed = errors.New("lambda_jwt_router: the request does not satisfy the access policy of this resource")
+var ErrInsufficientScope = errors.New("lambda_jwt_router: the JWT scopes do not allow access to this resource")
+var ErrClaimNotAllowed = errors.New("lambda_jwt_router: the JWT claims do not allow access to this resource")
+var ErrLevelNotAllowed = errors.New("lambda_jwt_router: the JWT level claim is too low to access this resource")
+var ErrUserTypeNotAllowed = errors.New("lambda_jwt_router: the JWT userType claim is not allowed to access this resource")
 
 // Handler is a lambda request handler function. It takes in the context value created by API Gateway when proxying to
 // AWS Lambda in addition to the events.APIGatewayProxyRequest event itself. This request object is created by API Gateway
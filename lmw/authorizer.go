@@ -0,0 +1,54 @@
+package lmw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"net/http"
+)
+
+// authorizerClaimsKey is the context key for the claims AuthorizerContextMW
+// took from the req's authorizer context.
+type authorizerClaimsKey struct{}
+
+// AuthorizerContextMW rebuilds the context values of DecodeExpandedMW from
+// the claims an ljwt.Authorizer put into req.RequestContext.Authorizer, so
+// Lambdas behind the authorizer don't verify the JWT a second time.
+// DecodeStandardMW, DecodeExpandedMW and DecodeClaimsMW run after it reuse
+// those claims instead of verifying the JWT's signature, so routes can keep
+// them and still work when invoked without the authorizer, such as when
+// developing locally. Their verifier still checks the claims, see
+// ljwt.Verifier.VerifyClaims, so a route requiring another issuer or
+// audience, or a revoked JWT, is rejected like without the authorizer:
+//
+//	router := lrtr.NewRouter("/api", lmw.AuthorizerContextMW)
+//	router.Route(http.MethodGet, "/books", books.ListLambda, lmw.DecodeExpandedMW)
+//
+// NewIntrospectionMW and NewDecodeDPoPMW still check the req's own token.
+// Reqs without authorizer claims are passed on unchanged. Never deploy it
+// behind an API that doesn't use the authorizer: the claims would be
+// trusted without a signature.
+func AuthorizerContextMW(next lcom.Handler) lcom.Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		res events.APIGatewayProxyResponse,
+		err error,
+	) {
+		mapClaims, ok, err := ljwt.ClaimsFromAuthorizer(req.RequestContext.Authorizer)
+		if err != nil {
+			return lres.StatusAndError(http.StatusInternalServerError, err)
+		}
+		if !ok {
+			return next(ctx, req)
+		}
+
+		ctx = context.WithValue(ctx, authorizerClaimsKey{}, mapClaims)
+		ctx, err = injectExpanded(WithClaims(ctx, mapClaims), mapClaims)
+		if err != nil {
+			return lres.StatusAndError(http.StatusInternalServerError, err)
+		}
+
+		return next(WithScopes(ctx, ljwt.ParseScopes(mapClaims)), req)
+	}
+}
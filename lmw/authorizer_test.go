@@ -0,0 +1,120 @@
+package lmw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestAuthorizerContextMW(t *testing.T) {
+	claims := util.GenerateExpandedMapClaims()
+	claims[lcom.JWTClaimScopeKey] = "books:read"
+
+	signedJWT, err := ljwt.Sign(claims)
+	require.Nil(t, err)
+
+	authorizerRes, err := ljwt.NewAuthorizer(nil).HandleToken(context.Background(), events.APIGatewayCustomAuthorizerRequest{
+		AuthorizationToken: "Bearer " + signedJWT,
+		MethodArn:          "arn:aws:execute-api:us-east-1:123456789012:abcdef1234/prod/GET/books",
+	})
+	require.Nil(t, err)
+
+	// API Gateway passes the context on with the principal ID added
+	authorizer := map[string]interface{}{"principalId": authorizerRes.PrincipalID}
+	for key, value := range authorizerRes.Context {
+		authorizer[key] = value
+	}
+
+	req := events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{Authorizer: authorizer}}
+
+	t.Run("verify the context values of DecodeExpandedMW are rebuilt", func(t *testing.T) {
+		handler := func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			require.Equal(t, claims[lcom.JWTClaimEmailKey], ctx.Value(lcom.JWTClaimEmailKey))
+			require.Equal(t, claims[lcom.JWTClaimSubjectKey], ctx.Value(lcom.JWTClaimSubjectKey))
+			require.Equal(t, []string{"books:read"}, Scopes(ctx))
+
+			expandedClaims, ok := Claims[ljwt.ExpandedClaims](ctx)
+			require.True(t, ok)
+			require.Equal(t, claims[lcom.JWTClaimUserTypeKey], expandedClaims.UserType)
+
+			_, ok = Claims[jwt.MapClaims](ctx)
+			require.True(t, ok)
+
+			return lres.Empty()
+		}
+
+		res, err := AuthorizerContextMW(handler)(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify the decode middleware don't verify the JWT signature again", func(t *testing.T) {
+		// the req has no Authorization header left to verify
+		for _, decodeMW := range []lcom.Middleware{DecodeStandardMW, DecodeExpandedMW, DecodeClaimsMW[shelfClaims]()} {
+			res, err := AuthorizerContextMW(decodeMW(RequireScopes("books:read")(generateEmptySuccessHandler())))(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+	t.Run("verify the route's verifier still checks the authorizer claims", func(t *testing.T) {
+		lenient, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("another secret")))
+		require.Nil(t, err)
+		strict, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("another secret")), ljwt.WithIssuer("https://other.example.com"))
+		require.Nil(t, err)
+
+		// the signature was checked by the authorizer
+		res, err := AuthorizerContextMW(NewDecodeStandardMW(lenient)(generateEmptySuccessHandler()))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		for _, decodeMW := range []lcom.Middleware{NewDecodeStandardMW(strict), NewDecodeExpandedMW(strict), NewDecodeClaimsMW[shelfClaims](strict)} {
+			res, err := AuthorizerContextMW(decodeMW(generateEmptySuccessHandler()))(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+			var responseBody lres.HTTPError
+			require.Nil(t, lres.Unmarshal(res, &responseBody))
+			require.Equal(t, lcom.ErrInvalidIssuer.Error(), responseBody.Message)
+		}
+	})
+	t.Run("verify JWTs revoked after the authorizer ran are rejected", func(t *testing.T) {
+		store := ljwt.NewMemoryRevocationStore()
+		ljwt.DefaultRevocationStore = store
+		defer func() { ljwt.DefaultRevocationStore = nil }()
+
+		err := ljwt.RevokeJWT(context.Background(), store, claims)
+		require.Nil(t, err)
+
+		res, err := AuthorizerContextMW(DecodeExpandedMW(generateEmptySuccessHandler()))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		var responseBody lres.HTTPError
+		require.Nil(t, lres.Unmarshal(res, &responseBody))
+		require.Equal(t, lcom.ErrTokenRevoked.Error(), responseBody.Message)
+	})
+	t.Run("verify reqs without an authorizer are passed on", func(t *testing.T) {
+		res, err := AuthorizerContextMW(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = AuthorizerContextMW(DecodeStandardMW(generateEmptySuccessHandler()))(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify invalid authorizer claims return an error", func(t *testing.T) {
+		badReq := events.APIGatewayProxyRequest{RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{lcom.AuthorizerClaimsKey: "not json"},
+		}}
+
+		res, err := AuthorizerContextMW(generateEmptySuccessHandler())(context.Background(), badReq)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+}
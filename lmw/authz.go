@@ -0,0 +1,88 @@
+package lmw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+)
+
+// Levels is the ordered list of values for the "level" claim used by
+// RequireLevel, from the lowest level to the highest. It must be set before
+// RequireLevel is called:
+//
+//	lmw.Levels = []string{"bronze", "silver", "gold"}
+//
+//	router.Route(http.MethodGet, "/reports", reports, lmw.DecodeExpandedMW, lmw.RequireLevel("silver"))
+var Levels []string
+
+// RequireUserType returns a middleware that only allows reqs whose
+// "userType" claim is one of userTypes. It must run after a decode
+// middleware such as DecodeExpandedMW which adds the verified claims to the
+// context. All other reqs, including reqs without verified claims, get a 403.
+func RequireUserType(userTypes ...string) lcom.Middleware {
+	allowed := slices.Clone(userTypes)
+
+	return requireClaim(lcom.JWTClaimUserTypeKey, func(value any) bool {
+		userType, ok := value.(string)
+		return ok && slices.Contains(allowed, userType)
+	}, lcom.ErrUserTypeNotAllowed)
+}
+
+// RequireLevel returns a middleware that only allows reqs whose "level"
+// claim is min or comes after min in Levels. It must run after a decode
+// middleware such as DecodeExpandedMW which adds the verified claims to the
+// context. All other reqs, including reqs with a level that isn't in Levels
+// or without verified claims, get a 403. RequireLevel panics if min isn't in
+// Levels.
+func RequireLevel(min string) lcom.Middleware {
+	order := slices.Clone(Levels)
+
+	minIndex := slices.Index(order, min)
+	if minIndex == -1 {
+		panic(fmt.Sprintf("RequireLevel: level %s is not in lmw.Levels %v", min, order))
+	}
+
+	return requireClaim(lcom.JWTClaimLevelKey, func(value any) bool {
+		level, ok := value.(string)
+		return ok && slices.Index(order, level) >= minIndex
+	}, lcom.ErrLevelNotAllowed)
+}
+
+// RequireClaim returns a middleware that only allows reqs where predicate
+// returns true for the claim key, such as one of the lcom.JWTClaim* keys, of
+// the verified jwt.MapClaims every decode middleware adds to the context.
+// The value is nil if the JWT has no such claim. All other reqs, including
+// reqs without verified claims, get a 403:
+//
+//	lmw.RequireClaim(lcom.JWTClaimEmailKey, func(value any) bool {
+//	    email, _ := value.(string)
+//	    return strings.HasSuffix(email, "@example.com")
+//	})
+func RequireClaim(key string, predicate func(value any) bool) lcom.Middleware {
+	return requireClaim(key, predicate, lcom.ErrClaimNotAllowed)
+}
+
+// requireClaim only reads the claims a decode middleware verified, never
+// the bare context keys, which InjectLambdaContextMW fills from the path,
+// query and body of the req.
+func requireClaim(key string, predicate func(value any) bool, err error) lcom.Middleware {
+	return func(next lcom.Handler) lcom.Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			mapClaims, ok := Claims[jwt.MapClaims](ctx)
+			if !ok || !predicate(mapClaims[key]) {
+				return lres.StatusAndError(http.StatusForbidden, err)
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package lmw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// generateExpandedReq signs an expanded set of claims with the given
+// userType and level and returns a req carrying it as a Bearer token
+func generateExpandedReq(t *testing.T, userType, level string) events.APIGatewayProxyRequest {
+	claims := util.GenerateExpandedMapClaims()
+	claims[lcom.JWTClaimUserTypeKey] = userType
+	claims[lcom.JWTClaimLevelKey] = level
+
+	signedJWT, err := ljwt.Sign(claims)
+	require.Nil(t, err)
+
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodGet,
+		Headers: map[string]string{
+			"Authorization": "Bearer " + signedJWT,
+		},
+		RequestContext: util.GenerateRandomAPIGatewayContext(),
+	}
+}
+
+func requireForbidden(t *testing.T, res events.APIGatewayProxyResponse, expectedErr error) {
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	var httpErr lres.HTTPError
+	require.Nil(t, lres.Unmarshal(res, &httpErr))
+	require.Equal(t, http.StatusForbidden, httpErr.Status)
+	require.Equal(t, expectedErr.Error(), httpErr.Message)
+}
+
+func TestRequireUserType(t *testing.T) {
+	handler := DecodeExpandedMW(RequireUserType("admin", "staff")(generateEmptySuccessHandler()))
+
+	t.Run("verify allowed userType succeeds", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "staff", "gold"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify other userType returns 403", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "gold"))
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrUserTypeNotAllowed)
+	})
+	t.Run("verify missing claims without DecodeExpandedMW return 403", func(t *testing.T) {
+		res, err := RequireUserType("admin")(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrUserTypeNotAllowed)
+	})
+	t.Run("verify a userType from the query string doesn't pass", func(t *testing.T) {
+		handler := InjectLambdaContextMW(DecodeStandardMW(RequireUserType("admin")(generateEmptySuccessHandler())))
+
+		req := generateExpandedReq(t, "customer", "gold")
+		req.QueryStringParameters = map[string]string{lcom.LambdaContextUserTypeKey: "admin"}
+
+		res, err := handler(context.Background(), req)
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrUserTypeNotAllowed)
+	})
+	t.Run("verify decode errors are returned before RequireUserType runs", func(t *testing.T) {
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestRequireLevel(t *testing.T) {
+	Levels = []string{"bronze", "silver", "gold"}
+	defer func() { Levels = nil }()
+
+	handler := DecodeExpandedMW(RequireLevel("silver")(generateEmptySuccessHandler()))
+
+	t.Run("verify the minimum level succeeds", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "silver"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify a higher level succeeds", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "gold"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify a lower level returns 403", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "bronze"))
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrLevelNotAllowed)
+	})
+	t.Run("verify an unknown level returns 403", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "platinum"))
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrLevelNotAllowed)
+	})
+	t.Run("verify levels set after RequireLevel is called are ignored", func(t *testing.T) {
+		Levels = []string{"gold"}
+		res, err := handler(context.Background(), generateExpandedReq(t, "customer", "silver"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify an unknown minimum level panics", func(t *testing.T) {
+		require.Panics(t, func() { RequireLevel("diamond") })
+	})
+}
+
+func TestRequireClaim(t *testing.T) {
+	handler := DecodeExpandedMW(RequireClaim(lcom.JWTClaimUserTypeKey, func(value any) bool {
+		userType, _ := value.(string)
+		return strings.HasPrefix(userType, "internal-")
+	})(generateEmptySuccessHandler()))
+
+	t.Run("verify matching claim succeeds", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "internal-admin", "gold"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify other claim returns 403", func(t *testing.T) {
+		res, err := handler(context.Background(), generateExpandedReq(t, "external-admin", "gold"))
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrClaimNotAllowed)
+	})
+	t.Run("verify missing claim is passed as nil", func(t *testing.T) {
+		var received any = "unset"
+		mw := RequireClaim("missing", func(value any) bool {
+			received = value
+			return false
+		})
+
+		ctx := WithClaims(context.Background(), jwt.MapClaims{lcom.JWTClaimSubjectKey: "user-42"})
+		res, err := mw(generateEmptySuccessHandler())(ctx, events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Nil(t, received)
+		requireForbidden(t, res, lcom.ErrClaimNotAllowed)
+	})
+	t.Run("verify reqs without verified claims never reach the predicate", func(t *testing.T) {
+		called := false
+		mw := RequireClaim(lcom.JWTClaimUserTypeKey, func(value any) bool {
+			called = true
+			return true
+		})
+
+		res, err := mw(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.False(t, called)
+		requireForbidden(t, res, lcom.ErrClaimNotAllowed)
+	})
+}
@@ -0,0 +1,73 @@
+package lmw
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"maps"
+	"strings"
+)
+
+// claimsKey is the context key for claims of type T. Every T gets its own
+// key so claims never collide with each other or with other context values.
+type claimsKey[T any] struct{}
+
+// DecodeClaimsMW returns middleware that decodes the claims of the JWT in the
+// req's "Authorization" header into a T with ljwt.ExtractCustom, including
+// any custom claims, and stores them in the context for Claims to retrieve.
+// An "aud" list is joined by spaces if T declares "aud" as a string.
+// Missing or invalid JWTs are rejected like DecodeStandardMW rejects them:
+//
+//	type BookClaims struct {
+//	    jwt.StandardClaims
+//	    Shelves []string `json:"shelves"`
+//	}
+//
+//	router.Route(http.MethodGet, "/shelves", listShelves, lmw.DecodeClaimsMW[BookClaims]())
+//
+//	func listShelves(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+//	    claims, _ := lmw.Claims[BookClaims](ctx)
+//	    return lres.Success(claims.Shelves)
+//	}
+func DecodeClaimsMW[T any]() lcom.Middleware {
+	return NewDecodeClaimsMW[T](nil)
+}
+
+// NewDecodeClaimsMW returns DecodeClaimsMW verifying JWTs with verifier
+// instead of the key material from environment variables. A nil verifier
+// uses environment variables like DecodeClaimsMW.
+func NewDecodeClaimsMW[T any](verifier *ljwt.Verifier) lcom.Middleware {
+	return newDecodeMW(verifierExtractor(verifier), func(ctx context.Context, mapClaims jwt.MapClaims) (context.Context, error) {
+		var claims T
+		err := ljwt.ExtractCustom(mapClaims, &claims)
+		if err != nil && len(ljwt.ParseAudience(mapClaims)) > 0 {
+			// T declares "aud" as a string like jwt.StandardClaims does
+			joined := maps.Clone(mapClaims)
+			joined[lcom.JWTClaimAudienceKey] = strings.Join(ljwt.ParseAudience(mapClaims), " ")
+
+			claims = *new(T)
+			err = ljwt.ExtractCustom(joined, &claims)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return WithClaims(ctx, claims), nil
+	})
+}
+
+// Claims returns the claims of type T stored by DecodeClaimsMW or
+// WithClaims and whether there were any. DecodeStandardMW and
+// DecodeExpandedMW store a jwt.StandardClaims and an ljwt.ExpandedClaims and
+// every decode middleware stores the raw jwt.MapClaims.
+func Claims[T any](ctx context.Context) (T, bool) {
+	claims, ok := ctx.Value(claimsKey[T]{}).(T)
+	return claims, ok
+}
+
+// WithClaims returns a copy of ctx holding claims for Claims to retrieve. Use
+// it to test handlers without signing a JWT.
+func WithClaims[T any](ctx context.Context, claims T) context.Context {
+	return context.WithValue(ctx, claimsKey[T]{}, claims)
+}
@@ -0,0 +1,118 @@
+package lmw
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+)
+
+type shelfClaims struct {
+	ljwt.ExpandedClaims
+	Shelves []string `json:"shelves"`
+}
+
+// generateClaimsHandler returns a handler that responds with the claims of
+// type T from its context
+func generateClaimsHandler[T any](t *testing.T) lcom.Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		claims, ok := Claims[T](ctx)
+		require.True(t, ok)
+
+		return lres.Success(claims)
+	}
+}
+
+func TestDecodeClaimsMW(t *testing.T) {
+	expandedClaims := util.GenerateExpandedMapClaims()
+	expandedClaims["shelves"] = []string{"fiction", "poetry"}
+
+	signedJWT, err := ljwt.Sign(expandedClaims)
+	require.Nil(t, err)
+
+	secret, err := hex.DecodeString(os.Getenv(lcom.HMACSecretEnvKey))
+	require.Nil(t, err)
+
+	req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+
+	t.Run("verify custom claims are decoded into the caller's struct", func(t *testing.T) {
+		res, err := DecodeClaimsMW[shelfClaims]()(generateClaimsHandler[shelfClaims](t))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var returnedClaims shelfClaims
+		err = lres.Unmarshal(res, &returnedClaims)
+		require.Nil(t, err)
+		require.Equal(t, []string{"fiction", "poetry"}, returnedClaims.Shelves)
+		require.Equal(t, expandedClaims[lcom.JWTClaimEmailKey], returnedClaims.Email)
+		require.Equal(t, expandedClaims[lcom.JWTClaimUserTypeKey], returnedClaims.UserType)
+	})
+	t.Run("verify claims of another type are not found", func(t *testing.T) {
+		handler := func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			_, ok := Claims[ljwt.ExpandedClaims](ctx)
+			require.False(t, ok)
+
+			// DecodeClaimsMW doesn't set the bare string keys
+			require.Nil(t, ctx.Value(lcom.JWTClaimEmailKey))
+
+			return lres.Empty()
+		}
+
+		res, err := DecodeClaimsMW[shelfClaims]()(handler)(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify DecodeStandardMW and DecodeExpandedMW store typed claims", func(t *testing.T) {
+		res, err := DecodeStandardMW(generateClaimsHandler[jwt.StandardClaims](t))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = DecodeExpandedMW(generateClaimsHandler[ljwt.ExpandedClaims](t))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify missing JWTs are rejected", func(t *testing.T) {
+		res, err := DecodeClaimsMW[shelfClaims]()(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("verify claims that don't fit the struct return an error", func(t *testing.T) {
+		type badClaims struct {
+			Email int `json:"email"`
+		}
+
+		res, err := DecodeClaimsMW[badClaims]()(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+	t.Run("verify the verifier's token sources are used", func(t *testing.T) {
+		verifier, err := ljwt.NewVerifier(
+			ljwt.WithHMACSecret(secret),
+			ljwt.WithTokenSources(ljwt.FromAuthorizationHeader(), ljwt.FromCookie("session")),
+		)
+		require.Nil(t, err)
+
+		cookieReq := events.APIGatewayProxyRequest{Headers: map[string]string{"cookie": "session=" + signedJWT}}
+		res, err := NewDecodeClaimsMW[shelfClaims](verifier)(generateClaimsHandler[shelfClaims](t))(context.Background(), cookieReq)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify WithClaims stores claims for handlers under test", func(t *testing.T) {
+		ctx := WithClaims(context.Background(), shelfClaims{Shelves: []string{"history"}})
+
+		claims, ok := Claims[shelfClaims](ctx)
+		require.True(t, ok)
+		require.Equal(t, []string{"history"}, claims.Shelves)
+
+		_, ok = Claims[*shelfClaims](ctx)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,19 @@
+package lmw
+
+import (
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+)
+
+// NewDecodeDPoPMW returns DecodeExpandedMW for DPoP sender-constrained access
+// tokens: the req must carry "Authorization: DPoP <token>" and a "DPoP"
+// proof header that dpop accepts for the token, see ljwt.DPoPVerifier.
+// Bearer tokens are rejected, so a token replayed from logs without its
+// private key gets nowhere. Rejections are a 401 with a "WWW-Authenticate:
+// DPoP" challenge whose error is "invalid_token" or "invalid_dpop_proof" and
+// whose message is the matching lcom error, such as
+// lcom.ErrDPoPProofReplayed or lcom.ErrDPoPKeyMismatch. Claims from
+// AuthorizerContextMW never replace the proof: every req is checked.
+func NewDecodeDPoPMW(dpop *ljwt.DPoPVerifier) lcom.Middleware {
+	return newDecodeMW(dpop.ExtractFromRequest, injectExpanded)
+}
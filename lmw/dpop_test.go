@@ -0,0 +1,106 @@
+package lmw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewDecodeDPoPMW(t *testing.T) {
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	clientJWK, err := ljwt.NewJWK("", "", clientKey.Public())
+	require.Nil(t, err)
+	thumbprint, err := clientJWK.Thumbprint()
+	require.Nil(t, err)
+
+	verifier, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("dpop secret")))
+	require.Nil(t, err)
+	signer, err := ljwt.NewSigner(ljwt.WithHMACSecret([]byte("dpop secret")))
+	require.Nil(t, err)
+
+	accessToken, err := signer.Sign(jwt.MapClaims{
+		lcom.JWTClaimSubjectKey:   "user-42",
+		lcom.JWTClaimUserTypeKey:  "member",
+		lcom.JWTClaimExpiresAtKey: time.Now().Add(time.Hour).Unix(),
+		"cnf":                     map[string]string{"jkt": thumbprint},
+	})
+	require.Nil(t, err)
+
+	handler := NewDecodeDPoPMW(ljwt.NewDPoPVerifier(verifier, ljwt.NewMemoryReplayCache()))(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return lres.Success(ctx.Value(lcom.JWTClaimUserTypeKey))
+	})
+
+	newReq := func(proof string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/books",
+			Headers: map[string]string{
+				"authorization": "DPoP " + accessToken,
+				"dpop":          proof,
+				"host":          "api.example.com",
+			},
+		}
+	}
+
+	proof, err := ljwt.NewDPoPProof(clientKey, http.MethodPost, "https://api.example.com/books", accessToken)
+	require.Nil(t, err)
+
+	t.Run("verify a valid DPoP req sets the expanded context values", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(proof))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, `"member"`, res.Body)
+	})
+
+	t.Run("verify a replayed proof gets a DPoP challenge", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(proof))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		require.Equal(t, `DPoP algs="ES256 ES384 ES512 EdDSA RS256 PS256", error="invalid_dpop_proof"`, res.Headers[lcom.WWWAuthenticateHeaderKey])
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrDPoPProofReplayed.Error(), responseBody.Message)
+	})
+
+	t.Run("verify a Bearer token gets an invalid_token challenge", func(t *testing.T) {
+		req := newReq(proof)
+		req.Headers["authorization"] = "Bearer " + accessToken
+
+		res, err := handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		require.Equal(t, `DPoP algs="ES256 ES384 ES512 EdDSA RS256 PS256", error="invalid_token"`, res.Headers[lcom.WWWAuthenticateHeaderKey])
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrNoDPoPPrefix.Error(), responseBody.Message)
+	})
+
+	t.Run("verify authorizer claims don't skip the proof", func(t *testing.T) {
+		req := newReq(proof)
+		req.Headers["authorization"] = "Bearer " + accessToken
+		req.RequestContext.Authorizer = map[string]interface{}{
+			lcom.AuthorizerClaimsKey: `{"sub":"user-42","userType":"member"}`,
+		}
+
+		res, err := AuthorizerContextMW(handler)(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		require.Equal(t, `DPoP algs="ES256 ES384 ES512 EdDSA RS256 PS256", error="invalid_token"`, res.Headers[lcom.WWWAuthenticateHeaderKey])
+	})
+}
@@ -0,0 +1,30 @@
+package lmw
+
+import (
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+)
+
+// NewIntrospectionMW returns middleware that checks the opaque access token
+// of the req with introspector and sets the same context values as
+// DecodeStandardMW, so handlers work the same whether the caller sent a JWT
+// or an opaque token. The "sub" context value falls back to the "username"
+// and then the "client_id" of the introspection response, its "scope" is
+// available to RequireScopes and the whole response, "client_id" and
+// "username" included, to Claims[jwt.MapClaims] and policies. The response
+// fields are mapped onto jwt.StandardClaims one by one with
+// ljwt.StandardClaimsOf, so an "aud" list, which RFC 7662 allows, is joined
+// by spaces and fields of another type stay empty instead of failing the req:
+//
+//	var introspector = ljwt.NewIntrospector(introspectURL, clientID, clientSecret)
+//
+//	router.Route(http.MethodGet, "/partner/books", books.ListLambda,
+//	    lmw.NewIntrospectionMW(introspector),
+//	    lmw.RequireScopes("books:read"))
+//
+// Set introspector.Verifier to verify JWTs locally on the same route.
+// Inactive tokens are rejected with a 401 whose message is
+// lcom.ErrTokenInactive; an unreachable introspection endpoint is a 500.
+func NewIntrospectionMW(introspector *ljwt.Introspector) lcom.Middleware {
+	return newDecodeMW(introspector.ExtractFromRequest, injectStandard)
+}
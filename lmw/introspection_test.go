@@ -0,0 +1,93 @@
+package lmw
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewIntrospectionMW(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, r.ParseForm())
+
+		response := map[string]any{"active": false}
+		if r.PostForm.Get("token") == "opaque-token" {
+			response = map[string]any{
+				"active":    true,
+				"aud":       []string{"books-api", "partner-api"},
+				"client_id": "partner",
+				"exp":       time.Now().Add(time.Hour).Unix(),
+				"iss":       "https://auth.partner.com",
+				"scope":     "books:read",
+				"username":  "jane",
+			}
+		}
+
+		require.Nil(t, json.NewEncoder(w).Encode(response))
+	}))
+	defer server.Close()
+
+	introspector := ljwt.NewIntrospector(server.URL, "partner", "s3cret")
+	introspector.TokenSources = []ljwt.TokenSource{ljwt.FromAuthorizationHeader()}
+
+	t.Run("verify the introspection response sets the DecodeStandardMW context values", func(t *testing.T) {
+		var ctx context.Context
+		handler := NewIntrospectionMW(introspector)(RequireScopes("books:read")(func(handlerCtx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			ctx = handlerCtx
+			return lres.Empty()
+		}))
+
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer opaque-token"},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		require.Equal(t, "jane", ctx.Value(lcom.JWTClaimSubjectKey))
+		require.Equal(t, "https://auth.partner.com", ctx.Value(lcom.JWTClaimIssuerKey))
+		require.Equal(t, "books-api partner-api", ctx.Value(lcom.JWTClaimAudienceKey))
+
+		standardClaims, ok := Claims[jwt.StandardClaims](ctx)
+		require.True(t, ok)
+		require.Equal(t, "jane", standardClaims.Subject)
+
+		mapClaims, ok := Claims[jwt.MapClaims](ctx)
+		require.True(t, ok)
+		require.Equal(t, "partner", mapClaims[lcom.JWTClaimClientIDKey])
+	})
+
+	t.Run("verify inactive tokens are rejected with a 401", func(t *testing.T) {
+		res, err := NewIntrospectionMW(introspector)(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer revoked-token"},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrTokenInactive.Error(), responseBody.Message)
+	})
+
+	t.Run("verify authorizer claims don't skip the introspection", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer revoked-token"},
+			RequestContext: events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{
+				lcom.AuthorizerClaimsKey: `{"sub":"edge-user","scope":"books:read"}`,
+			}},
+		}
+
+		res, err := AuthorizerContextMW(NewIntrospectionMW(introspector)(generateEmptySuccessHandler()))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
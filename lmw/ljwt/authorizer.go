@@ -0,0 +1,249 @@
+package ljwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"strings"
+)
+
+// errUnauthorized is the error API Gateway turns into a 401. Its message
+// must be exactly "Unauthorized".
+var errUnauthorized = errors.New("Unauthorized")
+
+// AuthorizerRule allows the methods and paths matching Method and Path for
+// the JWTs whose claims satisfy Allow. Method and Path use "*" as a wildcard
+// matching any characters, including "/", like the IAM policies they end up
+// in. An empty Method or Path matches everything and a nil Allow allows
+// every valid JWT:
+//
+//	ljwt.AuthorizerRule{Method: http.MethodGet, Path: "/books/*"}
+//	ljwt.AuthorizerRule{Method: "*", Path: "/admin/*", Allow: func(claims jwt.MapClaims) bool {
+//	    return claims[lcom.JWTClaimUserTypeKey] == "admin"
+//	}}
+type AuthorizerRule struct {
+	Method string
+	Path   string
+	Allow  func(claims jwt.MapClaims) bool
+}
+
+// Authorizer verifies JWTs at the API Gateway edge as a Lambda authorizer
+// so the Lambdas behind it don't have to. It answers both TOKEN and REQUEST
+// authorizer events with an IAM policy allowing the routes its rules allow
+// for the JWT and puts the claims into the policy's context, where
+// lmw.AuthorizerContextMW reads them back from
+// req.RequestContext.Authorizer. Invalid JWTs are answered with the
+// "Unauthorized" error API Gateway turns into a 401.
+//
+// API Gateway caches the policy for the token, so the policy lists every
+// route the JWT may call instead of only the one being called. Rules must
+// therefore only depend on the claims, not on the rest of the req.
+type Authorizer struct {
+	verifier *Verifier
+	rules    []AuthorizerRule
+}
+
+// NewAuthorizer returns an Authorizer verifying JWTs with verifier, or with
+// the key material from environment variables if verifier is nil, and
+// allowing the routes of rules. Without rules every route is allowed for a
+// valid JWT:
+//
+//	authorizer := ljwt.NewAuthorizer(nil)
+//	lambda.Start(authorizer.HandleRequest)
+func NewAuthorizer(verifier *Verifier, rules ...AuthorizerRule) *Authorizer {
+	return &Authorizer{verifier: verifier, rules: rules}
+}
+
+// HandleToken answers a TOKEN authorizer event. Configure the authorizer's
+// token source as the "Authorization" header; the "Bearer " prefix is
+// optional.
+func (a *Authorizer) HandleToken(ctx context.Context, req events.APIGatewayCustomAuthorizerRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	token := strings.TrimSpace(req.AuthorizationToken)
+	if scheme, rest, ok := strings.Cut(token, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(rest)
+	}
+
+	if token == "" {
+		return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+	}
+
+	mapClaims, err := a.verify(ctx, token)
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+
+	return a.response(req.MethodArn, mapClaims)
+}
+
+// HandleRequest answers a REQUEST authorizer event. The JWT is looked for
+// in the token sources of the Verifier or of
+// LAMBDA_JWT_ROUTER_TOKEN_SOURCES, so cookies and query parameters work as
+// well as the "Authorization" header.
+func (a *Authorizer) HandleRequest(ctx context.Context, req events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	proxyReq := events.APIGatewayProxyRequest{
+		Path:                            req.Path,
+		HTTPMethod:                      req.HTTPMethod,
+		Headers:                         req.Headers,
+		MultiValueHeaders:               req.MultiValueHeaders,
+		QueryStringParameters:           req.QueryStringParameters,
+		MultiValueQueryStringParameters: req.MultiValueQueryStringParameters,
+		PathParameters:                  req.PathParameters,
+	}
+
+	var sources []TokenSource
+	if a.verifier != nil {
+		sources = a.verifier.opts.tokenSources
+	} else {
+		var err error
+		sources, err = envTokenSources()
+		if err != nil {
+			return events.APIGatewayCustomAuthorizerResponse{}, err
+		}
+	}
+
+	token, err := ExtractToken(proxyReq, sources...)
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+	}
+
+	mapClaims, err := a.verify(ctx, token)
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+
+	return a.response(req.MethodArn, mapClaims)
+}
+
+// verify verifies token and returns its claims. Invalid JWTs return
+// errUnauthorized; configuration and revocation store errors are returned
+// as-is and become a 500.
+func (a *Authorizer) verify(ctx context.Context, token string) (jwt.MapClaims, error) {
+	verifier := a.verifier
+	if verifier == nil {
+		var err error
+		verifier, err = verifierFromEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mapClaims, err := verifier.Verify(ctx, token)
+	if errors.Is(err, lcom.ErrRevocationCheck) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	return mapClaims, nil
+}
+
+// response returns the policy allowing the routes of the rules mapClaims
+// satisfy on the API and stage of methodArn, with mapClaims as its context.
+func (a *Authorizer) response(methodArn string, mapClaims jwt.MapClaims) (events.APIGatewayCustomAuthorizerResponse, error) {
+	// arn:aws:execute-api:region:account:apiId/stage/METHOD/path
+	parts := strings.SplitN(methodArn, "/", 3)
+	if len(parts) < 3 {
+		return events.APIGatewayCustomAuthorizerResponse{}, util.WrapErrors(fmt.Errorf("method ARN %q has no API, stage and route", methodArn), lcom.ErrInvalidMethodARN)
+	}
+	apiArn := parts[0] + "/" + parts[1]
+
+	rules := a.rules
+	if len(rules) == 0 {
+		rules = []AuthorizerRule{{}}
+	}
+
+	var resources []string
+	for _, rule := range rules {
+		if rule.Allow != nil && !rule.Allow(mapClaims) {
+			continue
+		}
+
+		method := rule.Method
+		if method == "" {
+			method = "*"
+		}
+
+		path := rule.Path
+		if path == "" {
+			path = "*"
+		}
+
+		resources = append(resources, apiArn+"/"+method+"/"+strings.TrimPrefix(path, "/"))
+	}
+
+	statement := events.IAMPolicyStatement{
+		Action:   []string{"execute-api:Invoke"},
+		Effect:   "Allow",
+		Resource: resources,
+	}
+	if len(resources) == 0 {
+		statement.Effect = "Deny"
+		statement.Resource = []string{apiArn + "/*"}
+	}
+
+	authorizerContext, err := AuthorizerContext(mapClaims)
+	if err != nil {
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+
+	principalID, _ := mapClaims[lcom.JWTClaimSubjectKey].(string)
+	if principalID == "" {
+		principalID = "user"
+	}
+
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: principalID,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version:   "2012-10-17",
+			Statement: []events.IAMPolicyStatement{statement},
+		},
+		Context: authorizerContext,
+	}, nil
+}
+
+// AuthorizerContext returns the authorizer context for mapClaims. API
+// Gateway only passes strings, numbers and booleans on, so every claim of
+// those types is copied as-is for mapping templates and the complete claims
+// are stored as JSON under lcom.AuthorizerClaimsKey for
+// ClaimsFromAuthorizer.
+func AuthorizerContext(mapClaims jwt.MapClaims) (map[string]interface{}, error) {
+	claimsJSON, err := json.Marshal(mapClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizerContext := map[string]interface{}{lcom.AuthorizerClaimsKey: string(claimsJSON)}
+	for key, value := range mapClaims {
+		switch value.(type) {
+		case string, float64, int64, int, bool:
+			if key != lcom.AuthorizerClaimsKey && key != "principalId" {
+				authorizerContext[key] = value
+			}
+		}
+	}
+
+	return authorizerContext, nil
+}
+
+// ClaimsFromAuthorizer returns the claims an Authorizer stored in the
+// authorizer context of a req and whether there were any.
+func ClaimsFromAuthorizer(authorizer map[string]interface{}) (jwt.MapClaims, bool, error) {
+	claimsJSON, ok := authorizer[lcom.AuthorizerClaimsKey].(string)
+	if !ok || claimsJSON == "" {
+		return nil, false, nil
+	}
+
+	var mapClaims jwt.MapClaims
+	err := json.Unmarshal([]byte(claimsJSON), &mapClaims)
+	if err != nil {
+		return nil, true, util.WrapErrors(err, lcom.ErrInvalidAuthorizerClaims)
+	}
+
+	return mapClaims, true, nil
+}
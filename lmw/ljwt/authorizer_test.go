@@ -0,0 +1,126 @@
+package ljwt
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+)
+
+const testMethodArn = "arn:aws:execute-api:us-east-1:123456789012:abcdef1234/prod/GET/books/42"
+
+func TestAuthorizer(t *testing.T) {
+	ctx := context.Background()
+
+	claims := util.GenerateExpandedMapClaims()
+	claims[lcom.JWTClaimScopeKey] = "books:read"
+	claims["shelves"] = []string{"fiction"}
+
+	signedJWT, err := Sign(claims)
+	require.Nil(t, err)
+
+	t.Run("verify a TOKEN event is allowed with the claims in the context", func(t *testing.T) {
+		res, err := NewAuthorizer(nil).HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{
+			Type:               "TOKEN",
+			AuthorizationToken: "Bearer " + signedJWT,
+			MethodArn:          testMethodArn,
+		})
+		require.Nil(t, err)
+		require.Equal(t, claims[lcom.JWTClaimSubjectKey], res.PrincipalID)
+		require.Equal(t, []events.IAMPolicyStatement{{
+			Action:   []string{"execute-api:Invoke"},
+			Effect:   "Allow",
+			Resource: []string{"arn:aws:execute-api:us-east-1:123456789012:abcdef1234/prod/*/*"},
+		}}, res.PolicyDocument.Statement)
+
+		require.Equal(t, claims[lcom.JWTClaimEmailKey], res.Context[lcom.JWTClaimEmailKey])
+		require.NotContains(t, res.Context, "shelves")
+
+		retrievedClaims, ok, err := ClaimsFromAuthorizer(res.Context)
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, []any{"fiction"}, retrievedClaims["shelves"])
+		require.Equal(t, claims[lcom.JWTClaimUserTypeKey], retrievedClaims[lcom.JWTClaimUserTypeKey])
+	})
+	t.Run("verify a REQUEST event uses the token sources", func(t *testing.T) {
+		secret, err := hex.DecodeString(os.Getenv(lcom.HMACSecretEnvKey))
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithTokenSources(FromCookie("session")))
+		require.Nil(t, err)
+
+		req := events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			Type:       "REQUEST",
+			MethodArn:  testMethodArn,
+			HTTPMethod: http.MethodGet,
+			Path:       "/books/42",
+			Headers:    map[string]string{"cookie": "session=" + signedJWT},
+		}
+
+		res, err := NewAuthorizer(verifier).HandleRequest(ctx, req)
+		require.Nil(t, err)
+		require.Equal(t, "Allow", res.PolicyDocument.Statement[0].Effect)
+
+		req.Headers = map[string]string{"Authorization": "Bearer " + signedJWT}
+		_, err = NewAuthorizer(verifier).HandleRequest(ctx, req)
+		require.Equal(t, "Unauthorized", err.Error())
+	})
+	t.Run("verify invalid JWTs are unauthorized", func(t *testing.T) {
+		authorizer := NewAuthorizer(nil)
+
+		for _, token := range []string{"", "Bearer ", "Bearer not.a.jwt", signedJWT + "x"} {
+			_, err := authorizer.HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: token, MethodArn: testMethodArn})
+			require.Equal(t, "Unauthorized", err.Error(), token)
+		}
+
+		// a JWT without the prefix works for TOKEN events
+		_, err := authorizer.HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: signedJWT, MethodArn: testMethodArn})
+		require.Nil(t, err)
+
+		_, err = authorizer.HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: signedJWT, MethodArn: "arn"})
+		require.True(t, errors.Is(err, lcom.ErrInvalidMethodARN))
+	})
+	t.Run("verify the rules decide which routes are allowed", func(t *testing.T) {
+		isAdmin := func(claims jwt.MapClaims) bool { return claims[lcom.JWTClaimUserTypeKey] == "admin" }
+
+		authorizer := NewAuthorizer(nil,
+			AuthorizerRule{Method: http.MethodGet, Path: "/books/*"},
+			AuthorizerRule{Path: "/admin/*", Allow: isAdmin},
+		)
+
+		res, err := authorizer.HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: signedJWT, MethodArn: testMethodArn})
+		require.Nil(t, err)
+		require.Equal(t, "Allow", res.PolicyDocument.Statement[0].Effect)
+		require.Equal(t, []string{"arn:aws:execute-api:us-east-1:123456789012:abcdef1234/prod/GET/books/*"}, res.PolicyDocument.Statement[0].Resource)
+
+		adminClaims := util.GenerateExpandedMapClaims()
+		adminClaims[lcom.JWTClaimUserTypeKey] = "admin"
+		adminJWT, err := Sign(adminClaims)
+		require.Nil(t, err)
+
+		res, err = authorizer.HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: adminJWT, MethodArn: testMethodArn})
+		require.Nil(t, err)
+		require.Len(t, res.PolicyDocument.Statement[0].Resource, 2)
+		require.Equal(t, "arn:aws:execute-api:us-east-1:123456789012:abcdef1234/prod/*/admin/*", res.PolicyDocument.Statement[0].Resource[1])
+
+		res, err = NewAuthorizer(nil, AuthorizerRule{Allow: isAdmin}).HandleToken(ctx, events.APIGatewayCustomAuthorizerRequest{AuthorizationToken: signedJWT, MethodArn: testMethodArn})
+		require.Nil(t, err)
+		require.Equal(t, "Deny", res.PolicyDocument.Statement[0].Effect)
+	})
+	t.Run("verify missing and invalid authorizer claims", func(t *testing.T) {
+		_, ok, err := ClaimsFromAuthorizer(map[string]interface{}{"principalId": "user"})
+		require.Nil(t, err)
+		require.False(t, ok)
+
+		_, ok, err = ClaimsFromAuthorizer(map[string]interface{}{lcom.AuthorizerClaimsKey: "{"})
+		require.True(t, ok)
+		require.True(t, errors.Is(err, lcom.ErrInvalidAuthorizerClaims))
+	})
+}
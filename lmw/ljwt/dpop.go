@@ -0,0 +1,548 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDPoPProofMaxAge is how long after its "iat" a DPoP proof is accepted
+// unless DPoPVerifier.MaxAge says otherwise.
+const DefaultDPoPProofMaxAge = time.Minute
+
+// dpopAlgorithms are the asymmetric algorithms a DPoPVerifier accepts for
+// proofs unless DPoPVerifier.Algorithms says otherwise.
+var dpopAlgorithms = []string{
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+}
+
+// DPoPError is a req rejected by a DPoPVerifier. It holds the error code of
+// the "WWW-Authenticate: DPoP" challenge the req must be answered with.
+type DPoPError struct {
+	// Code is "invalid_dpop_proof", "invalid_token" or empty if the req
+	// carried no credentials at all.
+	Code string
+
+	// Algorithms are the proof algorithms the DPoPVerifier accepts.
+	Algorithms []string
+
+	Err error
+}
+
+func (e *DPoPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DPoPError) Unwrap() error {
+	return e.Err
+}
+
+// Challenge returns the "WWW-Authenticate" header value for e as described
+// in RFC 9449 section 7.1.
+func (e *DPoPError) Challenge() string {
+	challenge := `DPoP algs="` + strings.Join(e.Algorithms, " ") + `"`
+	if e.Code != "" {
+		challenge += `, error="` + e.Code + `"`
+	}
+
+	return challenge
+}
+
+// ReplayCache remembers the DPoP proofs a DPoPVerifier accepted so none of
+// them is accepted twice.
+type ReplayCache interface {
+	// Use records key until expiresAt and reports whether it was recorded
+	// already. It must be atomic, so implementations on top of DynamoDB or
+	// Redis should use a conditional write with expiresAt as the TTL.
+	Use(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+}
+
+// DPoPVerifier verifies DPoP sender-constrained access tokens as defined by
+// RFC 9449. The req must carry the access token as "Authorization: DPoP
+// <token>" and a proof JWT in the "DPoP" header, signed by the key the
+// access token's "cnf.jkt" claim is bound to, for the req's method and URL
+// and with a fresh "iat" and unused "jti". A token stolen from logs is
+// useless without the private key:
+//
+//	var dpop = ljwt.NewDPoPVerifier(verifier, ljwt.NewMemoryReplayCache())
+//
+//	router.Route(http.MethodGet, "/books", books.ListLambda, lmw.NewDecodeDPoPMW(dpop))
+//
+// A DPoPVerifier built as a struct literal verifies access tokens with the
+// key material from environment variables and records proofs in its own
+// MemoryReplayCache. Server provided nonces aren't supported.
+type DPoPVerifier struct {
+	// Algorithms are the accepted proof algorithms. HMAC and "none" are
+	// never accepted.
+	Algorithms []string
+
+	// MaxAge is how long after its "iat" a proof is accepted. It defaults
+	// to DefaultDPoPProofMaxAge.
+	MaxAge time.Duration
+
+	// Leeway is how far in the future a proof's "iat" may be.
+	Leeway time.Duration
+
+	// URL returns the URL the req was sent to, which the proof's "htu" must
+	// match. It defaults to https, or the X-Forwarded-Proto header, with the
+	// Host header and the path of the req's request context.
+	URL func(req events.APIGatewayProxyRequest) string
+
+	mu       sync.Mutex
+	verifier *Verifier
+	replay   ReplayCache
+	now      func() time.Time
+}
+
+// NewDPoPVerifier returns a DPoPVerifier verifying access tokens with
+// verifier, or with the key material from environment variables if verifier
+// is nil, and recording proofs in replay. Every Lambda instance has its own
+// memory, so pass a shared ReplayCache rather than a MemoryReplayCache to
+// stop replays across instances.
+func NewDPoPVerifier(verifier *Verifier, replay ReplayCache) *DPoPVerifier {
+	if replay == nil {
+		replay = NewMemoryReplayCache()
+	}
+
+	return &DPoPVerifier{
+		Algorithms: dpopAlgorithms,
+		MaxAge:     DefaultDPoPProofMaxAge,
+		URL:        dpopRequestURL,
+		verifier:   verifier,
+		replay:     replay,
+		now:        time.Now,
+	}
+}
+
+// ExtractFromRequest works like Verifier.ExtractJWTFromRequest for DPoP
+// bound access tokens. Rejected reqs return a 401 with a *DPoPError and
+// configuration and replay cache errors a 500.
+func (d *DPoPVerifier) ExtractFromRequest(ctx context.Context, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+	authorizationHeader := strings.TrimSpace(headerValue(req, lcom.AuthorizationHeaderKey))
+	if authorizationHeader == "" {
+		return nil, http.StatusUnauthorized, d.reject("", lcom.ErrNoAuthorizationHeader)
+	}
+
+	scheme, token, _ := strings.Cut(authorizationHeader, " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "DPoP") || token == "" {
+		return nil, http.StatusUnauthorized, d.reject("invalid_token", lcom.ErrNoDPoPPrefix)
+	}
+
+	verifier := d.verifier
+	if verifier == nil {
+		var err error
+		verifier, err = verifierFromEnv()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	mapClaims, err := verifier.Verify(ctx, token)
+	if errors.Is(err, lcom.ErrRevocationCheck) {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err != nil {
+		return nil, http.StatusUnauthorized, d.reject("invalid_token", util.WrapErrors(err, lcom.ErrVerifyJWT))
+	}
+
+	proof, err := dpopProof(req)
+	if err != nil {
+		return nil, http.StatusUnauthorized, d.reject("invalid_dpop_proof", err)
+	}
+
+	requestURL := d.URL
+	if requestURL == nil {
+		requestURL = dpopRequestURL
+	}
+
+	thumbprint, err := d.VerifyProof(ctx, proof, req.HTTPMethod, requestURL(req), token)
+	if errors.Is(err, lcom.ErrDPoPReplayCheck) {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err != nil {
+		return nil, http.StatusUnauthorized, d.reject("invalid_dpop_proof", err)
+	}
+
+	err = CheckDPoPBinding(mapClaims, thumbprint)
+	if err != nil {
+		return nil, http.StatusUnauthorized, d.reject("invalid_token", err)
+	}
+
+	return mapClaims, http.StatusOK, nil
+}
+
+// VerifyProof verifies the DPoP proof JWT for a req with method to rawURL
+// carrying accessToken and returns the JWK thumbprint of the key that signed
+// it. An empty accessToken skips the "ath" check, which is how token
+// endpoints verify proofs. Invalid proofs return lcom.ErrInvalidDPoPProof,
+// reused ones lcom.ErrDPoPProofReplayed as well.
+func (d *DPoPVerifier) VerifyProof(ctx context.Context, proof, method, rawURL, accessToken string) (string, error) {
+	var jwk JWK
+	parser := &jwt.Parser{ValidMethods: d.algorithms(), SkipClaimsValidation: true}
+	token, err := parser.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("the proof typ is %q instead of %q", typ, "dpop+jwt")
+		}
+
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the proof has no jwk header")
+		}
+		if _, private := header["d"]; private {
+			return nil, fmt.Errorf("the proof jwk contains a private key")
+		}
+
+		jwkJSON, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(jwkJSON, &jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(algorithmsForKey(key), token.Method.Alg()) {
+			return nil, lcom.ErrUnsupportedSigningMethod
+		}
+
+		return key, nil
+	})
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrInvalidDPoPProof)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", lcom.ErrInvalidDPoPProof
+	}
+
+	jti, _ := claims["jti"].(string)
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	iat, hasIat, err := numericClaim(claims, lcom.JWTClaimIssuedAtKey)
+	if err != nil || jti == "" || htm == "" || htu == "" || !hasIat {
+		return "", util.WrapErrors(fmt.Errorf("the proof is missing jti, htm, htu or iat"), lcom.ErrInvalidDPoPProof)
+	}
+
+	if htm != method {
+		return "", util.WrapErrors(fmt.Errorf("the proof is for %s instead of %s", htm, method), lcom.ErrInvalidDPoPProof)
+	}
+
+	if !sameDPoPURL(htu, rawURL) {
+		return "", util.WrapErrors(fmt.Errorf("the proof is for %s instead of %s", htu, rawURL), lcom.ErrInvalidDPoPProof)
+	}
+
+	now := d.clock()
+	maxAge := d.maxAge()
+	issuedAt := time.Unix(iat, 0)
+	if issuedAt.After(now.Add(d.Leeway)) || now.After(issuedAt.Add(maxAge)) {
+		return "", util.WrapErrors(fmt.Errorf("the proof was issued at %s", issuedAt.UTC().Format(time.RFC3339)), lcom.ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		ath, _ := claims["ath"].(string)
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(dpopAccessTokenHash(accessToken))) != 1 {
+			return "", util.WrapErrors(fmt.Errorf("the proof ath does not match the access token"), lcom.ErrInvalidDPoPProof)
+		}
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrInvalidDPoPProof)
+	}
+
+	// jtis only need to be unique per key, so one client can't burn the jtis
+	// of another
+	replayed, err := d.replayCache().Use(ctx, thumbprint+" "+jti, issuedAt.Add(maxAge))
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrDPoPReplayCheck)
+	}
+	if replayed {
+		return "", util.WrapErrors(util.WrapErrors(fmt.Errorf("proof %q was already used", jti), lcom.ErrDPoPProofReplayed), lcom.ErrInvalidDPoPProof)
+	}
+
+	return thumbprint, nil
+}
+
+// CheckDPoPBinding returns lcom.ErrDPoPKeyMismatch unless the "cnf.jkt"
+// claim of mapClaims is thumbprint.
+func CheckDPoPBinding(mapClaims jwt.MapClaims, thumbprint string) error {
+	cnf, _ := mapClaims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	if jkt == "" {
+		return util.WrapErrors(fmt.Errorf("the access token has no cnf.jkt claim"), lcom.ErrDPoPKeyMismatch)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(jkt), []byte(thumbprint)) != 1 {
+		return util.WrapErrors(fmt.Errorf("the access token is bound to %s", jkt), lcom.ErrDPoPKeyMismatch)
+	}
+
+	return nil
+}
+
+// NewDPoPProof returns a DPoP proof signed with key for a req with method to
+// rawURL carrying accessToken, which may be empty for token reqs. Clients and
+// tests use it; key must be an RSA, ECDSA or Ed25519 private key.
+func NewDPoPProof(key crypto.Signer, method, rawURL, accessToken string) (string, error) {
+	algorithms := algorithmsForKey(key)
+	if algorithms == nil {
+		return "", util.WrapErrors(fmt.Errorf("unsupported private key type %T", key), lcom.ErrInvalidKey)
+	}
+
+	jwk, err := NewJWK("", "", key.Public())
+	if err != nil {
+		return "", err
+	}
+	jwk.Use = ""
+
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":                    jti,
+		"htm":                    method,
+		"htu":                    rawURL,
+		lcom.JWTClaimIssuedAtKey: time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = dpopAccessTokenHash(accessToken)
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(algorithms[0]), claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = jwk
+
+	proof, err := token.SignedString(key)
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrUnableToSignToken)
+	}
+
+	return proof, nil
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the JWK, which
+// access tokens use as their "cnf.jkt" claim.
+func (j JWK) Thumbprint() (string, error) {
+	// the required members in lexicographic order
+	var members any
+	switch j.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	default:
+		return "", util.WrapErrors(fmt.Errorf("unsupported key type %s", j.Kty), lcom.ErrInvalidKey)
+	}
+
+	membersJSON, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(membersJSON)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// algorithms returns the accepted proof algorithms without HMAC and "none".
+func (d *DPoPVerifier) algorithms() []string {
+	algorithms := d.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = dpopAlgorithms
+	}
+
+	return slices.DeleteFunc(slices.Clone(algorithms), func(alg string) bool {
+		return alg == "none" || slices.Contains(hmacAlgorithms, alg)
+	})
+}
+
+// maxAge returns MaxAge or DefaultDPoPProofMaxAge if it isn't set.
+func (d *DPoPVerifier) maxAge() time.Duration {
+	if d.MaxAge <= 0 {
+		return DefaultDPoPProofMaxAge
+	}
+
+	return d.MaxAge
+}
+
+// clock returns the current time, from time.Now unless a test replaced it.
+func (d *DPoPVerifier) clock() time.Time {
+	if d.now == nil {
+		return time.Now()
+	}
+
+	return d.now()
+}
+
+// replayCache returns the ReplayCache of d, creating a MemoryReplayCache for
+// verifiers built without NewDPoPVerifier.
+func (d *DPoPVerifier) replayCache() ReplayCache {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.replay == nil {
+		d.replay = NewMemoryReplayCache()
+	}
+
+	return d.replay
+}
+
+// reject returns err as a *DPoPError with code.
+func (d *DPoPVerifier) reject(code string, err error) error {
+	return &DPoPError{Code: code, Algorithms: d.algorithms(), Err: err}
+}
+
+// dpopProof returns the single "DPoP" header of req.
+func dpopProof(req events.APIGatewayProxyRequest) (string, error) {
+	for key, values := range req.MultiValueHeaders {
+		if strings.EqualFold(key, lcom.DPoPHeaderKey) && len(values) > 1 {
+			return "", util.WrapErrors(fmt.Errorf("the req has %d DPoP headers", len(values)), lcom.ErrInvalidDPoPProof)
+		}
+	}
+
+	proof := strings.TrimSpace(headerValue(req, lcom.DPoPHeaderKey))
+	if proof == "" {
+		return "", util.WrapErrors(fmt.Errorf("no DPoP header"), lcom.ErrInvalidDPoPProof)
+	}
+
+	return proof, nil
+}
+
+// dpopRequestURL is the default DPoPVerifier.URL.
+func dpopRequestURL(req events.APIGatewayProxyRequest) string {
+	scheme := "https"
+	if proto := headerValue(req, "X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	path := req.RequestContext.Path
+	if path == "" {
+		path = req.Path
+	}
+
+	return scheme + "://" + headerValue(req, "Host") + path
+}
+
+// sameDPoPURL reports whether the "htu" of a proof matches rawURL, ignoring
+// the query, the fragment, the case of the scheme and host and default ports.
+func sameDPoPURL(htu, rawURL string) bool {
+	normalize := func(rawURL string) (string, bool) {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Host == "" {
+			return "", false
+		}
+
+		scheme := strings.ToLower(parsed.Scheme)
+		host := strings.ToLower(parsed.Hostname())
+		if port := parsed.Port(); port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+			host += ":" + port
+		}
+
+		path := parsed.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+
+		return scheme + "://" + host + path, true
+	}
+
+	normalizedHTU, ok := normalize(htu)
+	if !ok {
+		return false
+	}
+
+	normalizedURL, ok := normalize(rawURL)
+
+	return ok && normalizedHTU == normalizedURL
+}
+
+// dpopAccessTokenHash returns the "ath" of accessToken.
+func dpopAccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// MemoryReplayCache is a ReplayCache that keeps the proofs in memory until
+// they expire. Every Lambda instance has its own memory, so use it in tests,
+// development servers or with a single instance, and a shared cache
+// otherwise. The zero value is an empty MemoryReplayCache.
+type MemoryReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// NewMemoryReplayCache returns an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{seen: map[string]time.Time{}, now: time.Now}
+}
+
+// Use implements ReplayCache.
+func (c *MemoryReplayCache) Use(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	if c.seen == nil {
+		c.seen = map[string]time.Time{}
+	}
+
+	for seenKey, seenUntil := range c.seen {
+		if now.After(seenUntil) {
+			delete(c.seen, seenKey)
+		}
+	}
+
+	if _, ok := c.seen[key]; ok {
+		return true, nil
+	}
+	c.seen[key] = expiresAt
+
+	return false, nil
+}
@@ -0,0 +1,219 @@
+package ljwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDPoPVerifier(t *testing.T) {
+	ctx := context.Background()
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	clientJWK, err := NewJWK("", "", clientKey.Public())
+	require.Nil(t, err)
+	thumbprint, err := clientJWK.Thumbprint()
+	require.Nil(t, err)
+
+	verifier, err := NewVerifier(WithHMACSecret([]byte("dpop secret")))
+	require.Nil(t, err)
+
+	signer, err := NewSigner(WithHMACSecret([]byte("dpop secret")))
+	require.Nil(t, err)
+
+	accessToken, err := signer.Sign(jwt.MapClaims{
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"cnf": map[string]string{"jkt": thumbprint},
+	})
+	require.Nil(t, err)
+
+	const booksURL = "https://api.example.com/prod/books"
+
+	dpopReq := func(scheme, proof string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/books",
+			Headers: map[string]string{
+				"Authorization": scheme + " " + accessToken,
+				"DPoP":          proof,
+				"Host":          "API.example.com",
+			},
+			RequestContext: events.APIGatewayProxyRequestContext{Path: "/prod/books"},
+		}
+	}
+
+	t.Run("verify a valid proof is accepted once", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		proof, err := NewDPoPProof(clientKey, http.MethodGet, booksURL+"?page=2", accessToken)
+		require.Nil(t, err)
+
+		claims, httpStatus, err := dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Equal(t, "user-42", claims[lcom.JWTClaimSubjectKey])
+
+		_, httpStatus, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.Equal(t, http.StatusUnauthorized, httpStatus)
+		require.True(t, errors.Is(err, lcom.ErrDPoPProofReplayed))
+
+		var dpopErr *DPoPError
+		require.True(t, errors.As(err, &dpopErr))
+		require.Equal(t, `DPoP algs="ES256 ES384 ES512 EdDSA RS256 PS256", error="invalid_dpop_proof"`, dpopErr.Challenge())
+	})
+
+	t.Run("verify proofs for another method or URL are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		proof, err := NewDPoPProof(clientKey, http.MethodDelete, booksURL, accessToken)
+		require.Nil(t, err)
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+
+		proof, err = NewDPoPProof(clientKey, http.MethodGet, "https://api.example.com/prod/authors", accessToken)
+		require.Nil(t, err)
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+	})
+
+	t.Run("verify stale proofs are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+		dpop.now = func() time.Time { return time.Now().Add(2 * DefaultDPoPProofMaxAge) }
+
+		proof, err := NewDPoPProof(clientKey, http.MethodGet, booksURL, accessToken)
+		require.Nil(t, err)
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+	})
+
+	t.Run("verify proofs for another access token are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		proof, err := NewDPoPProof(clientKey, http.MethodGet, booksURL, "another token")
+		require.Nil(t, err)
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+	})
+
+	t.Run("verify proofs signed by another key are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.Nil(t, err)
+
+		proof, err := NewDPoPProof(otherKey, http.MethodGet, booksURL, accessToken)
+		require.Nil(t, err)
+		_, httpStatus, err := dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.Equal(t, http.StatusUnauthorized, httpStatus)
+		require.True(t, errors.Is(err, lcom.ErrDPoPKeyMismatch))
+
+		var dpopErr *DPoPError
+		require.True(t, errors.As(err, &dpopErr))
+		require.Equal(t, "invalid_token", dpopErr.Code)
+	})
+
+	t.Run("verify Bearer tokens and missing proofs are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		_, httpStatus, err := dpop.ExtractFromRequest(ctx, dpopReq("Bearer", ""))
+		require.Equal(t, http.StatusUnauthorized, httpStatus)
+		require.True(t, errors.Is(err, lcom.ErrNoDPoPPrefix))
+
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", ""))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+
+		_, _, err = dpop.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{})
+		require.True(t, errors.Is(err, lcom.ErrNoAuthorizationHeader))
+
+		var dpopErr *DPoPError
+		require.True(t, errors.As(err, &dpopErr))
+		require.Equal(t, `DPoP algs="ES256 ES384 ES512 EdDSA RS256 PS256"`, dpopErr.Challenge())
+	})
+
+	t.Run("verify a struct literal verifier uses the defaults", func(t *testing.T) {
+		dpop := &DPoPVerifier{}
+
+		proof, err := NewDPoPProof(clientKey, http.MethodGet, booksURL, accessToken)
+		require.Nil(t, err)
+
+		proofThumbprint, err := dpop.VerifyProof(ctx, proof, http.MethodGet, booksURL, accessToken)
+		require.Nil(t, err)
+		require.Equal(t, thumbprint, proofThumbprint)
+
+		_, err = dpop.VerifyProof(ctx, proof, http.MethodGet, booksURL, accessToken)
+		require.True(t, errors.Is(err, lcom.ErrDPoPProofReplayed))
+	})
+
+	t.Run("verify HMAC signed proofs are rejected", func(t *testing.T) {
+		dpop := NewDPoPVerifier(verifier, nil)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"jti": "hmac", "htm": http.MethodGet, "htu": booksURL, "iat": time.Now().Unix(),
+		})
+		token.Header["typ"] = "dpop+jwt"
+		token.Header["jwk"] = clientJWK
+		proof, err := token.SignedString([]byte("dpop secret"))
+		require.Nil(t, err)
+
+		_, _, err = dpop.ExtractFromRequest(ctx, dpopReq("DPoP", proof))
+		require.True(t, errors.Is(err, lcom.ErrInvalidDPoPProof))
+	})
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	require.Nil(t, err)
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	cache := NewMemoryReplayCache()
+	cache.now = func() time.Time { return now }
+
+	replayed, err := cache.Use(ctx, "jti", now.Add(time.Minute))
+	require.Nil(t, err)
+	require.False(t, replayed)
+
+	replayed, err = cache.Use(ctx, "jti", now.Add(time.Minute))
+	require.Nil(t, err)
+	require.True(t, replayed)
+
+	cache.now = func() time.Time { return now.Add(2 * time.Minute) }
+	replayed, err = cache.Use(ctx, "jti", now.Add(3*time.Minute))
+	require.Nil(t, err)
+	require.False(t, replayed)
+
+	// the zero value is an empty cache
+	var zero MemoryReplayCache
+	replayed, err = zero.Use(ctx, "jti", now.Add(time.Minute))
+	require.Nil(t, err)
+	require.False(t, replayed)
+
+	replayed, err = zero.Use(ctx, "jti", now.Add(time.Minute))
+	require.Nil(t, err)
+	require.True(t, replayed)
+}
@@ -0,0 +1,229 @@
+package ljwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var introspectionClient = &http.Client{Timeout: 10 * time.Second}
+
+// Introspector checks opaque access tokens with the OAuth 2.0 token
+// introspection endpoint of their authorization server as defined by RFC
+// 7662. Active responses are cached until the token's "exp", so keep the
+// Introspector in a package level variable to reuse them across warm
+// invocations of the Lambda. A token revoked at the authorization server is
+// therefore accepted until it expires; responses without "exp" aren't cached.
+//
+//	var introspector = ljwt.NewIntrospector("https://auth.partner.com/oauth2/introspect", clientID, clientSecret)
+//
+//	claims, err := introspector.Introspect(ctx, accessToken)
+type Introspector struct {
+	// URL is the address of the introspection endpoint.
+	URL string
+
+	// ClientID and ClientSecret authenticate the Introspector at the
+	// endpoint with HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+
+	// TokenSources are where ExtractFromRequest looks for the token. They
+	// default to LAMBDA_JWT_ROUTER_TOKEN_SOURCES or the "Authorization:
+	// Bearer" header.
+	TokenSources []TokenSource
+
+	// Verifier, if set, verifies the tokens that look like a JWT locally so
+	// only opaque tokens are introspected.
+	Verifier *Verifier
+
+	// HTTPClient sends the introspection reqs. It defaults to a client with
+	// a 10 second timeout.
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup[jwt.MapClaims]
+	now   func() time.Time
+}
+
+// NewIntrospector returns an Introspector for the endpoint at url
+// authenticating with clientID and clientSecret.
+func NewIntrospector(url, clientID, clientSecret string) *Introspector {
+	return &Introspector{
+		URL:          url,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		HTTPClient:   introspectionClient,
+		cache:        map[string]cachedLookup[jwt.MapClaims]{},
+		now:          time.Now,
+	}
+}
+
+// Introspect returns the introspection response for the active token as
+// claims. The "sub" claim falls back to "username" and then "client_id" so
+// the claims identify the caller like the claims of a JWT. Inactive and
+// expired tokens return lcom.ErrTokenInactive; failed reqs to the endpoint
+// return lcom.ErrIntrospection.
+func (i *Introspector) Introspect(ctx context.Context, token string) (jwt.MapClaims, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	i.mu.Lock()
+	cached, ok := i.cache[key]
+	i.mu.Unlock()
+
+	now := i.clock()
+	if ok && now.Before(cached.expiresAt) {
+		return maps.Clone(cached.value), nil
+	}
+
+	mapClaims, err := i.post(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if active, _ := mapClaims["active"].(bool); !active {
+		return nil, util.WrapErrors(fmt.Errorf("the token is not active"), lcom.ErrTokenInactive)
+	}
+
+	exp, hasExp, err := numericClaim(mapClaims, lcom.JWTClaimExpiresAtKey)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrIntrospection)
+	}
+	if hasExp && !now.Before(time.Unix(exp, 0)) {
+		return nil, util.WrapErrors(fmt.Errorf("the token expired at %s", time.Unix(exp, 0).UTC().Format(time.RFC3339)), lcom.ErrTokenInactive)
+	}
+
+	if sub, _ := mapClaims[lcom.JWTClaimSubjectKey].(string); sub == "" {
+		for _, fallback := range []string{lcom.JWTClaimUsernameKey, lcom.JWTClaimClientIDKey} {
+			if value, _ := mapClaims[fallback].(string); value != "" {
+				mapClaims[lcom.JWTClaimSubjectKey] = value
+				break
+			}
+		}
+	}
+
+	if hasExp {
+		i.mu.Lock()
+		if i.cache == nil {
+			i.cache = map[string]cachedLookup[jwt.MapClaims]{}
+		}
+		for cachedKey, entry := range i.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(i.cache, cachedKey)
+			}
+		}
+		i.cache[key] = cachedLookup[jwt.MapClaims]{value: mapClaims, expiresAt: time.Unix(exp, 0)}
+		i.mu.Unlock()
+	}
+
+	return maps.Clone(mapClaims), nil
+}
+
+// clock returns the current time, from time.Now unless a test replaced it.
+func (i *Introspector) clock() time.Time {
+	if i.now == nil {
+		return time.Now()
+	}
+
+	return i.now()
+}
+
+// post sends token to the introspection endpoint and returns its response.
+func (i *Introspector) post(ctx context.Context, token string) (jwt.MapClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrIntrospection)
+	}
+
+	// RFC 6749 section 2.3.1 form encodes the credentials before Basic
+	// authentication
+	req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	req.Header.Set(lcom.ContentTypeKey, "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := i.HTTPClient
+	if client == nil {
+		client = introspectionClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrIntrospection)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, util.WrapErrors(fmt.Errorf("unexpected status %d from %s", res.StatusCode, i.URL), lcom.ErrIntrospection)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrIntrospection)
+	}
+
+	var mapClaims jwt.MapClaims
+	err = json.Unmarshal(body, &mapClaims)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrIntrospection)
+	}
+
+	return mapClaims, nil
+}
+
+// ExtractFromRequest works like Verifier.ExtractJWTFromRequest for opaque
+// access tokens. Tokens shaped like a JWT are verified locally if the
+// Introspector has a Verifier. Rejected tokens return a 401 and endpoint
+// errors a 500.
+func (i *Introspector) ExtractFromRequest(ctx context.Context, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+	sources := i.TokenSources
+	if sources == nil {
+		var err error
+		sources, err = envTokenSources()
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	token, err := ExtractToken(req, sources...)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if i.Verifier != nil && strings.Count(token, ".") == 2 {
+		mapClaims, err := i.Verifier.Verify(ctx, token)
+		if errors.Is(err, lcom.ErrRevocationCheck) {
+			return nil, http.StatusInternalServerError, err
+		}
+		if err != nil {
+			return nil, http.StatusUnauthorized, util.WrapErrors(err, lcom.ErrVerifyJWT)
+		}
+
+		return mapClaims, http.StatusOK, nil
+	}
+
+	mapClaims, err := i.Introspect(ctx, token)
+	if errors.Is(err, lcom.ErrTokenInactive) {
+		return nil, http.StatusUnauthorized, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return mapClaims, http.StatusOK, nil
+}
@@ -0,0 +1,179 @@
+package ljwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newIntrospectionServer answers introspection reqs with the response of the
+// token and counts the reqs
+func newIntrospectionServer(t *testing.T, responses map[string]map[string]any) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "partner%3Aapi" || clientSecret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		require.Nil(t, r.ParseForm())
+		require.Equal(t, "access_token", r.PostForm.Get("token_type_hint"))
+
+		response, ok := responses[r.PostForm.Get("token")]
+		if !ok {
+			response = map[string]any{"active": false}
+		}
+
+		require.Nil(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestIntrospector(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	server, calls := newIntrospectionServer(t, map[string]map[string]any{
+		"user-token":   {"active": true, "sub": "user-42", "scope": "books:read", "client_id": "partner", "exp": now.Add(time.Hour).Unix()},
+		"client-token": {"active": true, "client_id": "partner", "exp": now.Add(time.Hour).Unix()},
+		"no-exp-token": {"active": true, "username": "jane"},
+		"stale-token":  {"active": true, "sub": "user-42", "exp": now.Add(-time.Minute).Unix()},
+	})
+
+	newIntrospector := func() *Introspector {
+		return NewIntrospector(server.URL, "partner:api", "s3cret")
+	}
+
+	t.Run("verify active responses are cached until their exp", func(t *testing.T) {
+		introspector := newIntrospector()
+		calls.Store(0)
+
+		claims, err := introspector.Introspect(ctx, "user-token")
+		require.Nil(t, err)
+		require.Equal(t, "user-42", claims[lcom.JWTClaimSubjectKey])
+		require.Equal(t, "books:read", claims[lcom.JWTClaimScopeKey])
+
+		_, err = introspector.Introspect(ctx, "user-token")
+		require.Nil(t, err)
+		require.Equal(t, int32(1), calls.Load())
+
+		introspector.now = func() time.Time { return now.Add(2 * time.Hour) }
+		_, err = introspector.Introspect(ctx, "user-token")
+		require.True(t, errors.Is(err, lcom.ErrTokenInactive))
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("verify responses without exp are not cached", func(t *testing.T) {
+		introspector := newIntrospector()
+		calls.Store(0)
+
+		claims, err := introspector.Introspect(ctx, "no-exp-token")
+		require.Nil(t, err)
+		require.Equal(t, "jane", claims[lcom.JWTClaimSubjectKey])
+
+		_, err = introspector.Introspect(ctx, "no-exp-token")
+		require.Nil(t, err)
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("verify a struct literal introspector uses the defaults", func(t *testing.T) {
+		introspector := &Introspector{URL: server.URL, ClientID: "partner:api", ClientSecret: "s3cret"}
+		calls.Store(0)
+
+		for range 2 {
+			claims, err := introspector.Introspect(ctx, "user-token")
+			require.Nil(t, err)
+			require.Equal(t, "user-42", claims[lcom.JWTClaimSubjectKey])
+		}
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("verify sub falls back to client_id", func(t *testing.T) {
+		claims, err := newIntrospector().Introspect(ctx, "client-token")
+		require.Nil(t, err)
+		require.Equal(t, "partner", claims[lcom.JWTClaimSubjectKey])
+	})
+
+	t.Run("verify inactive and expired tokens are rejected", func(t *testing.T) {
+		introspector := newIntrospector()
+
+		_, err := introspector.Introspect(ctx, "unknown-token")
+		require.True(t, errors.Is(err, lcom.ErrTokenInactive))
+
+		_, err = introspector.Introspect(ctx, "stale-token")
+		require.True(t, errors.Is(err, lcom.ErrTokenInactive))
+	})
+
+	t.Run("verify endpoint errors are not inactive tokens", func(t *testing.T) {
+		introspector := NewIntrospector(server.URL, "partner:api", "wrong")
+
+		_, err := introspector.Introspect(ctx, "user-token")
+		require.True(t, errors.Is(err, lcom.ErrIntrospection))
+		require.False(t, errors.Is(err, lcom.ErrTokenInactive))
+	})
+
+	t.Run("verify ExtractFromRequest maps errors to status codes", func(t *testing.T) {
+		introspector := newIntrospector()
+		introspector.TokenSources = []TokenSource{FromAuthorizationHeader()}
+
+		claims, httpStatus, err := introspector.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer user-token"},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Equal(t, "user-42", claims[lcom.JWTClaimSubjectKey])
+
+		_, httpStatus, err = introspector.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer unknown-token"},
+		})
+		require.True(t, errors.Is(err, lcom.ErrTokenInactive))
+		require.Equal(t, http.StatusUnauthorized, httpStatus)
+
+		_, httpStatus, err = introspector.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{})
+		require.True(t, errors.Is(err, lcom.ErrNoAuthorizationHeader))
+		require.Equal(t, http.StatusBadRequest, httpStatus)
+
+		broken := NewIntrospector(server.URL, "partner:api", "wrong")
+		broken.TokenSources = introspector.TokenSources
+		_, httpStatus, err = broken.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer user-token"},
+		})
+		require.True(t, errors.Is(err, lcom.ErrIntrospection))
+		require.Equal(t, http.StatusInternalServerError, httpStatus)
+	})
+
+	t.Run("verify JWTs are verified locally with a Verifier", func(t *testing.T) {
+		verifier, err := NewVerifier(WithHMACSecret([]byte("local secret")))
+		require.Nil(t, err)
+
+		introspector := newIntrospector()
+		introspector.TokenSources = []TokenSource{FromAuthorizationHeader()}
+		introspector.Verifier = verifier
+		calls.Store(0)
+
+		signedJWT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "local-user"}).SignedString([]byte("local secret"))
+		require.Nil(t, err)
+
+		claims, httpStatus, err := introspector.ExtractFromRequest(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"Authorization": "Bearer " + signedJWT},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Equal(t, "local-user", claims[lcom.JWTClaimSubjectKey])
+		require.Equal(t, int32(0), calls.Load())
+	})
+}
@@ -0,0 +1,318 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSRefreshInterval is the default minimum time between two fetches
+// of a JWKS document.
+const DefaultJWKSRefreshInterval = 5 * time.Minute
+
+// JWK is a single JSON Web Key as defined by RFC 7517. Only the fields
+// needed for RSA, ECDSA and Ed25519 public keys are supported.
+type JWK struct {
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	Use string `json:"use,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set document as served by identity providers
+// such as Cognito and Auth0 at their JWKS URL.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS verifies JWTs with the keys of a JWKS document. The document is
+// fetched on first use and its keys are cached, so keep the JWKS in a
+// package level variable to reuse the keys across warm invocations of the
+// Lambda. When a JWT has a kid that isn't cached the document is fetched
+// again, at most once every MinRefreshInterval, so rotated keys are picked
+// up without letting unknown kids flood the identity provider:
+//
+//	var jwks = ljwt.NewJWKS("https://cognito-idp.us-east-1.amazonaws.com/us-east-1_abc/.well-known/jwks.json")
+//
+//	claims, err := jwks.Verify(ctx, userJWT)
+//
+// Set LAMBDA_JWT_ROUTER_JWKS_URL to have VerifyJWT, and through it
+// lmw.DecodeStandardMW and lmw.DecodeExpandedMW, use a JWKS instead of the
+// HMAC secret.
+type JWKS struct {
+	// URL is the address of the JWKS document.
+	URL string
+
+	// Algorithms pins the algorithms accepted by Verify. If it is empty
+	// every algorithm that fits the key type is accepted. A key with an
+	// "alg" is always restricted to that algorithm.
+	Algorithms []string
+
+	// MinRefreshInterval is the minimum time between two fetches of the
+	// document.
+	MinRefreshInterval time.Duration
+
+	// Fetch returns the JWKS document at url. It defaults to an HTTP GET with
+	// a 10 second timeout and can be replaced to load the document from
+	// somewhere else.
+	Fetch func(ctx context.Context, url string) ([]byte, error)
+
+	mu        sync.Mutex
+	keys      map[string]jwkKey
+	lastFetch time.Time
+}
+
+type jwkKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewJWKS returns a JWKS for the document at url with the default refresh
+// interval and HTTP fetch.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		URL:                url,
+		MinRefreshInterval: DefaultJWKSRefreshInterval,
+		Fetch:              fetchJWKS,
+	}
+}
+
+// NewJWK returns the JWK for an *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey so issuers can publish their own JWKS document. alg is
+// optional and kid should be the kid the issuer puts in its JWT headers.
+func NewJWK(kid, alg string, key crypto.PublicKey) (JWK, error) {
+	jwk := JWK{Alg: alg, Kid: kid, Use: "sig"}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		point, err := k.Bytes()
+		if err != nil {
+			return JWK{}, util.WrapErrors(err, lcom.ErrInvalidKey)
+		}
+
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, util.WrapErrors(fmt.Errorf("unsupported public key type %T", key), lcom.ErrInvalidKey)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey returns the *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey the JWK describes.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrInvalidKey)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, util.WrapErrors(fmt.Errorf("invalid RSA exponent"), lcom.ErrInvalidKey)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+
+		curve, ok := curves[j.Crv]
+		if !ok {
+			return nil, util.WrapErrors(fmt.Errorf("unsupported curve %s", j.Crv), lcom.ErrInvalidKey)
+		}
+
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, util.WrapErrors(fmt.Errorf("invalid EC point"), lcom.ErrInvalidKey)
+		}
+
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, slices.Concat([]byte{4}, x, y))
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrInvalidKey)
+		}
+
+		return key, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if j.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, util.WrapErrors(fmt.Errorf("invalid Ed25519 key"), lcom.ErrInvalidKey)
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, util.WrapErrors(fmt.Errorf("unsupported key type %s", j.Kty), lcom.ErrInvalidKey)
+}
+
+// Verify verifies userJWT with the JWKS key matching its kid and returns its
+// claims. A JWT without a kid is only accepted if the JWKS has exactly one
+// key. Use NewVerifier with WithJWKS to check the issuer, audience and other
+// claims as well.
+func (j *JWKS) Verify(ctx context.Context, userJWT string) (jwt.MapClaims, error) {
+	verifier := &Verifier{opts: newOptions([]Option{WithJWKS(j)})}
+	return verifier.Verify(ctx, userJWT)
+}
+
+// keyFor returns the key to verify token with.
+func (j *JWKS) keyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := j.key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	alg := token.Method.Alg()
+	if (len(j.Algorithms) > 0 && !slices.Contains(j.Algorithms, alg)) ||
+		(key.alg != "" && key.alg != alg) ||
+		!slices.Contains(algorithmsForKey(key.key), alg) {
+		return nil, lcom.ErrUnsupportedSigningMethod
+	}
+
+	return key.key, nil
+}
+
+// key returns the cached key for kid, fetching the document again if kid is
+// unknown and the last fetch is older than MinRefreshInterval.
+func (j *JWKS) key(ctx context.Context, kid string) (jwkKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, ok := j.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+
+	if !j.lastFetch.IsZero() && time.Since(j.lastFetch) < j.MinRefreshInterval {
+		return jwkKey{}, lcom.ErrUnknownKeyID
+	}
+
+	err := j.refresh(ctx)
+	if err != nil {
+		return jwkKey{}, err
+	}
+
+	key, ok = j.cachedKey(kid)
+	if !ok {
+		return jwkKey{}, lcom.ErrUnknownKeyID
+	}
+
+	return key, nil
+}
+
+func (j *JWKS) cachedKey(kid string) (jwkKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the document and replaces the cached keys. Keys that
+// aren't signing keys or that can't be parsed are skipped.
+func (j *JWKS) refresh(ctx context.Context) error {
+	// failed fetches count towards the rate limit as well so an unreachable
+	// identity provider isn't hit on every req
+	j.lastFetch = time.Now()
+
+	fetch := j.Fetch
+	if fetch == nil {
+		fetch = fetchJWKS
+	}
+
+	body, err := fetch(ctx, j.URL)
+	if err != nil {
+		return util.WrapErrors(err, lcom.ErrJWKSFetch)
+	}
+
+	var set JWKSet
+	err = json.Unmarshal(body, &set)
+	if err != nil {
+		return util.WrapErrors(err, lcom.ErrJWKSFetch)
+	}
+
+	keys := make(map[string]jwkKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		publicKey, keyErr := jwk.PublicKey()
+		if keyErr != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = jwkKey{alg: jwk.Alg, key: publicKey}
+	}
+
+	j.keys = keys
+
+	return nil
+}
+
+// fetchJWKS is the default JWKS.Fetch and loads the document with an HTTP GET.
+func fetchJWKS(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", res.StatusCode, url)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
@@ -0,0 +1,187 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// jwksServer serves a JWKS document that can be changed during a test and
+// counts how often it was fetched
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	set     JWKSet
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	server := &jwksServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.fetches.Add(1)
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		require.Nil(t, json.NewEncoder(w).Encode(server.set))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *jwksServer) setKeys(t *testing.T, keys map[string]crypto.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set = JWKSet{}
+	for kid, key := range keys {
+		jwk, err := NewJWK(kid, "", key.Public())
+		require.Nil(t, err)
+		s.set.Keys = append(s.set.Keys, jwk)
+	}
+}
+
+// signWithKID signs claims with key and puts kid in the JWT header
+func signWithKID(t *testing.T, claims jwt.MapClaims, kid string, key crypto.Signer) string {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(algorithmsForKey(key)[0]), claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signedJWT, err := token.SignedString(key)
+	require.Nil(t, err)
+
+	return signedJWT
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.Nil(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	rotatedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	server := newJWKSServer(t)
+	server.setKeys(t, map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey, "ed": edKey})
+
+	jwks := NewJWKS(server.URL)
+	ctx := context.Background()
+
+	t.Run("verify keys are picked by kid and cached", func(t *testing.T) {
+		for kid, key := range map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey, "ed": edKey} {
+			claims := util.GenerateStandardMapClaims()
+
+			retrievedClaims, err := jwks.Verify(ctx, signWithKID(t, claims, kid, key))
+			require.Nil(t, err, kid)
+			require.Equal(t, claims[lcom.JWTClaimSubjectKey], retrievedClaims[lcom.JWTClaimSubjectKey])
+		}
+
+		require.Equal(t, int32(1), server.fetches.Load())
+	})
+	t.Run("verify a key with the wrong kid fails", func(t *testing.T) {
+		_, err := jwks.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "ec", rsaKey))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify unknown kids are rate limited", func(t *testing.T) {
+		_, err := jwks.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "unknown", rsaKey))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+		require.Equal(t, int32(1), server.fetches.Load())
+	})
+	t.Run("verify rotated keys are fetched once the refresh interval passed", func(t *testing.T) {
+		server.setKeys(t, map[string]crypto.Signer{"rotated": rotatedKey})
+
+		jwks.MinRefreshInterval = 0
+		defer func() { jwks.MinRefreshInterval = DefaultJWKSRefreshInterval }()
+
+		_, err := jwks.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "rotated", rotatedKey))
+		require.Nil(t, err)
+		require.Equal(t, int32(2), server.fetches.Load())
+
+		// keys removed from the document are dropped from the cache
+		_, err = jwks.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "rsa", rsaKey))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+
+		// a single key is used for JWTs without a kid
+		_, err = jwks.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "", rotatedKey))
+		require.Nil(t, err)
+	})
+	t.Run("verify pinned algorithms reject other algorithms", func(t *testing.T) {
+		pinned := NewJWKS(server.URL)
+		pinned.Algorithms = []string{"RS256"}
+
+		_, err := pinned.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "rotated", rotatedKey))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify the fetch is pluggable and its errors are returned", func(t *testing.T) {
+		failing := NewJWKS("https://example.com/jwks.json")
+		failing.Fetch = func(ctx context.Context, url string) ([]byte, error) {
+			require.Equal(t, "https://example.com/jwks.json", url)
+			return nil, errors.New("unreachable")
+		}
+
+		_, err := failing.Verify(ctx, signWithKID(t, util.GenerateStandardMapClaims(), "rsa", rsaKey))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+		require.Contains(t, err.Error(), "unreachable")
+	})
+	t.Run("verify VerifyJWT uses the JWKS URL from the env", func(t *testing.T) {
+		server.setKeys(t, map[string]crypto.Signer{"rsa": rsaKey})
+		t.Setenv(lcom.JWKSURLEnvKey, server.URL)
+
+		mapClaims, httpStatus, err := ExtractJWT(map[string]string{
+			"Authorization": "Bearer " + signWithKID(t, util.GenerateStandardMapClaims(), "rsa", rsaKey),
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Len(t, mapClaims, 7)
+
+		hmacJWT, err := Sign(util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+		_, err = VerifyJWT(hmacJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+}
+
+func TestJWK(t *testing.T) {
+	t.Run("verify invalid JWKs return ErrInvalidKey", func(t *testing.T) {
+		for _, jwk := range []JWK{
+			{Kty: "oct"},
+			{Kty: "RSA", N: "AQAB", E: ""},
+			{Kty: "EC", Crv: "P-256", X: "AQAB", Y: "AQAB"},
+			{Kty: "OKP", Crv: "X25519", X: "AQAB"},
+		} {
+			_, err := jwk.PublicKey()
+			require.True(t, errors.Is(err, lcom.ErrInvalidKey), jwk.Kty)
+		}
+	})
+	t.Run("verify JWKs round trip", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.Nil(t, err)
+
+		jwk, err := NewJWK("kid", "ES384", &ecKey.PublicKey)
+		require.Nil(t, err)
+		require.Equal(t, "P-384", jwk.Crv)
+
+		publicKey, err := jwk.PublicKey()
+		require.Nil(t, err)
+		require.True(t, ecKey.PublicKey.Equal(publicKey))
+	})
+}
@@ -0,0 +1,152 @@
+package ljwt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"time"
+)
+
+// HMACKey is a single HMAC secret of an HMACKeyring.
+type HMACKey struct {
+	// ID is the kid stamped into the header of JWTs signed with the key and
+	// used to find the key when verifying them. Give the secret used before
+	// the keyring an empty ID so outstanding JWTs without a kid keep working.
+	ID string
+
+	// Secret is the binary HMAC secret.
+	Secret []byte
+
+	// NotBefore is the time the key starts being used. The zero time means
+	// the key is used right away.
+	NotBefore time.Time
+
+	// RetireAfter is the time the key stops being used, both for signing and
+	// for verifying. The zero time means the key never retires.
+	RetireAfter time.Time
+
+	// VerifyOnly keys are never used to sign JWTs.
+	VerifyOnly bool
+}
+
+// active reports whether the key is inside its validity window at now.
+func (k HMACKey) active(now time.Time) bool {
+	return !now.Before(k.NotBefore) && (k.RetireAfter.IsZero() || !now.After(k.RetireAfter))
+}
+
+// HMACKeyring holds the HMAC secrets used to sign and verify JWTs so secrets
+// can be rotated without invalidating outstanding JWTs. A Signer signs with
+// the active key that isn't VerifyOnly and has the latest NotBefore, and
+// stamps its ID into the "kid" header. A Verifier looks keys up by the "kid"
+// of the JWT and only accepts keys inside their validity window.
+//
+// A zero downtime rotation adds the new key with NotBefore set to the time
+// of the switch and sets RetireAfter on the old key to the switch plus the
+// lifetime of a JWT. Deploy the keyring to every Lambda before the switch
+// and the old key keeps verifying the JWTs it signed until they expire.
+type HMACKeyring struct {
+	keys []HMACKey
+}
+
+// NewHMACKeyring returns a keyring of keys. IDs must be unique and every key
+// needs a secret.
+func NewHMACKeyring(keys ...HMACKey) (*HMACKeyring, error) {
+	if len(keys) == 0 {
+		return nil, util.WrapErrors(fmt.Errorf("no keys"), lcom.ErrInvalidKeyring)
+	}
+
+	ids := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if ids[key.ID] {
+			return nil, util.WrapErrors(fmt.Errorf("duplicate kid %q", key.ID), lcom.ErrInvalidKeyring)
+		}
+		ids[key.ID] = true
+
+		if len(key.Secret) == 0 {
+			return nil, util.WrapErrors(fmt.Errorf("key %q has no secret", key.ID), lcom.ErrInvalidKeyring)
+		}
+
+		if !key.RetireAfter.IsZero() && key.RetireAfter.Before(key.NotBefore) {
+			return nil, util.WrapErrors(fmt.Errorf("key %q retires before it starts", key.ID), lcom.ErrInvalidKeyring)
+		}
+	}
+
+	return &HMACKeyring{keys: keys}, nil
+}
+
+// ParseHMACKeyring parses a keyring from JSON such as the value of
+// LAMBDA_JWT_ROUTER_HMAC_KEYRING. Secrets are hex encoded like
+// LAMBDA_JWT_ROUTER_HMAC_SECRET and times are RFC 3339:
+//
+//	[
+//	  {"kid": "2024-01", "secret": "8f2a...", "retireAfter": "2024-02-02T00:00:00Z"},
+//	  {"kid": "2024-02", "secret": "41c7...", "notBefore": "2024-02-01T00:00:00Z"}
+//	]
+func ParseHMACKeyring(jsonBytes []byte) (*HMACKeyring, error) {
+	var jsonKeys []struct {
+		ID          string    `json:"kid"`
+		Secret      string    `json:"secret"`
+		NotBefore   time.Time `json:"notBefore"`
+		RetireAfter time.Time `json:"retireAfter"`
+		VerifyOnly  bool      `json:"verifyOnly"`
+	}
+
+	err := json.Unmarshal(jsonBytes, &jsonKeys)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidKeyring)
+	}
+
+	keys := make([]HMACKey, len(jsonKeys))
+	for i, jsonKey := range jsonKeys {
+		secret, err := hex.DecodeString(jsonKey.Secret)
+		if err != nil {
+			return nil, util.WrapErrors(fmt.Errorf("key %q: %s", jsonKey.ID, err), lcom.ErrInvalidKeyring)
+		}
+
+		keys[i] = HMACKey{
+			ID:          jsonKey.ID,
+			Secret:      secret,
+			NotBefore:   jsonKey.NotBefore,
+			RetireAfter: jsonKey.RetireAfter,
+			VerifyOnly:  jsonKey.VerifyOnly,
+		}
+	}
+
+	return NewHMACKeyring(keys...)
+}
+
+// signingKey returns the key to sign with at now.
+func (k *HMACKeyring) signingKey(now time.Time) (HMACKey, error) {
+	var signingKey HMACKey
+	var found bool
+
+	for _, key := range k.keys {
+		if key.VerifyOnly || !key.active(now) {
+			continue
+		}
+
+		if !found || key.NotBefore.After(signingKey.NotBefore) {
+			signingKey = key
+			found = true
+		}
+	}
+
+	if !found {
+		return HMACKey{}, util.WrapErrors(fmt.Errorf("no active signing key in the keyring"), lcom.ErrNoSigningKey)
+	}
+
+	return signingKey, nil
+}
+
+// verificationKey returns the key with the ID kid if it is active at now.
+func (k *HMACKeyring) verificationKey(kid string, now time.Time) (HMACKey, error) {
+	for _, key := range k.keys {
+		if key.ID == kid && key.active(now) {
+			return key, nil
+		}
+	}
+
+	return HMACKey{}, lcom.ErrUnknownKeyID
+}
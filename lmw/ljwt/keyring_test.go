@@ -0,0 +1,157 @@
+package ljwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHMACKeyring(t *testing.T) {
+	ctx := context.Background()
+	switchAt := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	keyring, err := NewHMACKeyring(
+		HMACKey{ID: "2024-01", Secret: []byte("old secret"), RetireAfter: switchAt.Add(24 * time.Hour)},
+		HMACKey{ID: "2024-02", Secret: []byte("new secret"), NotBefore: switchAt},
+		HMACKey{ID: "partner", Secret: []byte("partner secret"), VerifyOnly: true},
+	)
+	require.Nil(t, err)
+
+	// signAndVerify signs at signedAt and verifies at verifiedAt, returning
+	// the kid the JWT was signed with and the verification error
+	signAndVerify := func(signedAt, verifiedAt time.Time) (string, error) {
+		signer, err := NewSigner(WithHMACKeyring(keyring), WithClock(func() time.Time { return signedAt }))
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACKeyring(keyring), WithClock(func() time.Time { return verifiedAt }))
+		require.Nil(t, err)
+
+		claims := util.GenerateStandardMapClaims()
+		claims[lcom.JWTClaimExpiresAtKey] = signedAt.Add(time.Hour).Unix()
+		claims[lcom.JWTClaimIssuedAtKey] = signedAt.Unix()
+		claims[lcom.JWTClaimNotBeforeKey] = signedAt.Unix()
+
+		signedJWT, err := signer.Sign(claims)
+		require.Nil(t, err)
+
+		token, _, err := new(jwt.Parser).ParseUnverified(signedJWT, jwt.MapClaims{})
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, signedJWT)
+		return token.Header["kid"].(string), err
+	}
+
+	t.Run("verify the old key signs before the switch", func(t *testing.T) {
+		kid, err := signAndVerify(switchAt.Add(-time.Minute), switchAt.Add(-time.Minute))
+		require.Nil(t, err)
+		require.Equal(t, "2024-01", kid)
+	})
+	t.Run("verify the new key signs after the switch and the old key still verifies", func(t *testing.T) {
+		kid, err := signAndVerify(switchAt, switchAt)
+		require.Nil(t, err)
+		require.Equal(t, "2024-02", kid)
+
+		kid, err = signAndVerify(switchAt.Add(-time.Minute), switchAt.Add(30*time.Minute))
+		require.Nil(t, err)
+		require.Equal(t, "2024-01", kid)
+	})
+	t.Run("verify retired keys no longer verify", func(t *testing.T) {
+		old, err := NewSigner(WithHMACSecret([]byte("old secret")), WithKeyID("2024-01"))
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACKeyring(keyring), WithClock(func() time.Time { return switchAt.Add(25 * time.Hour) }))
+		require.Nil(t, err)
+
+		claims := util.GenerateStandardMapClaims()
+		delete(claims, lcom.JWTClaimIssuedAtKey)
+		delete(claims, lcom.JWTClaimNotBeforeKey)
+
+		signedJWT, err := old.Sign(claims)
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify verify only keys verify by kid", func(t *testing.T) {
+		partner, err := NewSigner(WithHMACSecret([]byte("partner secret")), WithKeyID("partner"))
+		require.Nil(t, err)
+
+		signedJWT, err := partner.Sign(util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACKeyring(keyring))
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, signedJWT)
+		require.Nil(t, err)
+
+		// the same secret under another kid is rejected
+		unknown, err := NewSigner(WithHMACSecret([]byte("partner secret")), WithKeyID("unknown"))
+		require.Nil(t, err)
+
+		signedJWT, err = unknown.Sign(util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify signing fails without an active signing key", func(t *testing.T) {
+		verifyOnly, err := NewHMACKeyring(HMACKey{ID: "partner", Secret: []byte("partner secret"), VerifyOnly: true})
+		require.Nil(t, err)
+
+		signer, err := NewSigner(WithHMACKeyring(verifyOnly))
+		require.Nil(t, err)
+
+		_, err = signer.Sign(util.GenerateStandardMapClaims())
+		require.True(t, errors.Is(err, lcom.ErrNoSigningKey))
+	})
+	t.Run("verify invalid keyrings are rejected", func(t *testing.T) {
+		for _, keys := range [][]HMACKey{
+			nil,
+			{{ID: "a", Secret: []byte("secret")}, {ID: "a", Secret: []byte("other secret")}},
+			{{ID: "a"}},
+			{{ID: "a", Secret: []byte("secret"), NotBefore: switchAt, RetireAfter: switchAt.Add(-time.Hour)}},
+		} {
+			_, err := NewHMACKeyring(keys...)
+			require.True(t, errors.Is(err, lcom.ErrInvalidKeyring))
+		}
+
+		_, err := ParseHMACKeyring([]byte(`[{"kid": "a", "secret": "not hex"}]`))
+		require.True(t, errors.Is(err, lcom.ErrInvalidKeyring))
+	})
+}
+
+func TestHMACKeyringFromEnv(t *testing.T) {
+	legacySecret := []byte("legacy secret")
+
+	// a JWT signed with the single secret before the keyring was introduced
+	legacy, err := NewSigner(WithHMACSecret(legacySecret))
+	require.Nil(t, err)
+
+	legacyJWT, err := legacy.Sign(util.GenerateStandardMapClaims())
+	require.Nil(t, err)
+
+	t.Setenv(lcom.HMACKeyringEnvKey, fmt.Sprintf(`[
+		{"kid": "", "secret": "%x", "verifyOnly": true},
+		{"kid": "2024-02", "secret": "%x"}
+	]`, legacySecret, "new secret"))
+
+	signedJWT, err := Sign(util.GenerateExpandedMapClaims())
+	require.Nil(t, err)
+
+	token, _, err := new(jwt.Parser).ParseUnverified(signedJWT, jwt.MapClaims{})
+	require.Nil(t, err)
+	require.Equal(t, "2024-02", token.Header["kid"])
+
+	_, err = VerifyJWT(signedJWT)
+	require.Nil(t, err)
+
+	_, err = VerifyJWT(legacyJWT)
+	require.Nil(t, err)
+}
@@ -0,0 +1,186 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"os"
+	"strings"
+)
+
+// hmacAlgorithms are the algorithms a Verifier accepts for an HMAC secret
+// unless WithAlgorithms says otherwise.
+var hmacAlgorithms = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+}
+
+// ParsePrivateKeyPEM parses an RSA, ECDSA or Ed25519 private key from a PKCS #1,
+// SEC 1 or PKCS #8 PEM block. Use it to load the key of the Lambda that
+// issues JWTs with SignWithKey.
+func ParsePrivateKeyPEM(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, util.WrapErrors(fmt.Errorf("no PEM block found"), lcom.ErrInvalidKey)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok || algorithmsForKey(key) == nil {
+			return nil, util.WrapErrors(fmt.Errorf("unsupported private key type %T", key), lcom.ErrInvalidKey)
+		}
+
+		return signer, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidKey)
+	}
+
+	return key, nil
+}
+
+// ParsePublicKeyPEM parses an RSA, ECDSA or Ed25519 public key from a PKIX or
+// PKCS #1 PEM block, or from a PEM encoded certificate. Use it to load the key
+// of Lambdas that only verify JWTs with VerifyWithKey.
+func ParsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, util.WrapErrors(fmt.Errorf("no PEM block found"), lcom.ErrInvalidKey)
+	}
+
+	var key crypto.PublicKey
+	var err error
+
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidKey)
+	}
+
+	if algorithmsForKey(key) == nil {
+		return nil, util.WrapErrors(fmt.Errorf("unsupported public key type %T", key), lcom.ErrInvalidKey)
+	}
+
+	return key, nil
+}
+
+// SignWithKey signs the claims with algorithm, e.g. "RS256", "ES256" or
+// "EdDSA", using an *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey
+// as returned by ParsePrivateKeyPEM. If algorithm is empty the default for
+// the key is used: RS256 for RSA, ES256, ES384 or ES512 depending on the
+// curve for ECDSA and EdDSA for Ed25519. Use NewSigner to set a kid, issuer
+// or audience as well.
+func SignWithKey(mapClaims jwt.MapClaims, algorithm string, key crypto.PrivateKey) (string, error) {
+	opts := []Option{func(o *options) { o.signingKey = key }}
+	if algorithm != "" {
+		opts = append(opts, WithAlgorithms(algorithm))
+	}
+
+	signer, err := NewSigner(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return signer.Sign(mapClaims)
+}
+
+// VerifyWithKey verifies userJWT with an *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey as returned by ParsePublicKeyPEM and returns its claims.
+// The token's "alg" header must be one of algorithms. If algorithms is empty
+// only the default algorithm for the key is accepted (see SignWithKey).
+// Pinning the algorithms prevents tokens signed with a different algorithm,
+// such as an HMAC token signed with the public key as its secret, from
+// being accepted. Use NewVerifier to check the issuer, audience and other
+// claims as well.
+func VerifyWithKey(userJWT string, key crypto.PublicKey, algorithms ...string) (jwt.MapClaims, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	verifier, err := NewVerifier(WithPublicKey(key), WithAlgorithms(algorithms...))
+	if err != nil {
+		return nil, err
+	}
+
+	return verifier.Verify(context.Background(), userJWT)
+}
+
+// algorithmsForKey returns the algorithms that can be used with key, with the
+// default algorithm first, or nil if the key type is not supported.
+func algorithmsForKey(key any) []string {
+	switch k := key.(type) {
+	case []byte:
+		return hmacAlgorithms
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return []string{
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodRS384.Alg(),
+			jwt.SigningMethodRS512.Alg(),
+			jwt.SigningMethodPS256.Alg(),
+			jwt.SigningMethodPS384.Alg(),
+			jwt.SigningMethodPS512.Alg(),
+		}
+	case *ecdsa.PrivateKey:
+		return algorithmsForKey(&k.PublicKey)
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return []string{jwt.SigningMethodES256.Alg()}
+		case elliptic.P384():
+			return []string{jwt.SigningMethodES384.Alg()}
+		case elliptic.P521():
+			return []string{jwt.SigningMethodES512.Alg()}
+		}
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return []string{jwt.SigningMethodEdDSA.Alg()}
+	}
+
+	return nil
+}
+
+// envList returns the comma separated values of the environment variable key
+// or nil if it isn't set.
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// envPEM returns the PEM stored in the environment variable key. Newlines
+// may be escaped as "\n" so the PEM fits on a single line.
+func envPEM(key string) []byte {
+	return []byte(strings.ReplaceAll(os.Getenv(key), `\n`, "\n"))
+}
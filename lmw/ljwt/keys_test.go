@@ -0,0 +1,180 @@
+package ljwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+// generatePEMKeys returns the PKCS #8 private key and PKIX public key PEMs for key
+func generatePEMKeys(t *testing.T, key crypto.Signer) ([]byte, []byte) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.Nil(t, err)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func TestSignAndVerifyWithKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm string
+	}{
+		{name: "RSA", key: rsaKey, algorithm: "RS256"},
+		{name: "ECDSA", key: ecKey, algorithm: "ES256"},
+		{name: "Ed25519", key: edKey, algorithm: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		privatePEM, publicPEM := generatePEMKeys(t, tt.key)
+
+		privateKey, err := ParsePrivateKeyPEM(privatePEM)
+		require.Nil(t, err)
+		publicKey, err := ParsePublicKeyPEM(publicPEM)
+		require.Nil(t, err)
+
+		t.Run("verify "+tt.name+" keys sign and verify with the default algorithm", func(t *testing.T) {
+			claims := util.GenerateExpandedMapClaims()
+
+			signedJWT, err := SignWithKey(claims, "", privateKey)
+			require.Nil(t, err)
+
+			token, _, err := new(jwt.Parser).ParseUnverified(signedJWT, jwt.MapClaims{})
+			require.Nil(t, err)
+			require.Equal(t, tt.algorithm, token.Method.Alg())
+
+			retrievedClaims, err := VerifyWithKey(signedJWT, publicKey)
+			require.Nil(t, err)
+			require.Equal(t, claims[lcom.JWTClaimSubjectKey], retrievedClaims[lcom.JWTClaimSubjectKey])
+		})
+		t.Run("verify "+tt.name+" keys reject JWTs signed by another key", func(t *testing.T) {
+			signedJWT, err := Sign(util.GenerateExpandedMapClaims())
+			require.Nil(t, err)
+
+			_, err = VerifyWithKey(signedJWT, publicKey)
+			require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+		})
+	}
+
+	t.Run("verify RSA keys support other pinned algorithms", func(t *testing.T) {
+		signedJWT, err := SignWithKey(util.GenerateStandardMapClaims(), "PS512", rsaKey)
+		require.Nil(t, err)
+
+		_, err = VerifyWithKey(signedJWT, &rsaKey.PublicKey)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+
+		_, err = VerifyWithKey(signedJWT, &rsaKey.PublicKey, "RS256", "PS512")
+		require.Nil(t, err)
+	})
+	t.Run("verify HMAC tokens signed with the public key are rejected", func(t *testing.T) {
+		_, publicPEM := generatePEMKeys(t, rsaKey)
+
+		// the classic algorithm confusion attack uses the public key as the HMAC secret
+		forgedJWT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, util.GenerateStandardMapClaims()).SignedString(publicPEM)
+		require.Nil(t, err)
+
+		_, err = VerifyWithKey(forgedJWT, &rsaKey.PublicKey)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+
+		_, err = VerifyWithKey(forgedJWT, &rsaKey.PublicKey, "RS256", "HS256")
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify none algorithm is rejected", func(t *testing.T) {
+		_, err := SignWithKey(util.GenerateStandardMapClaims(), "none", rsaKey)
+		require.True(t, errors.Is(err, lcom.ErrUnsupportedSigningMethod))
+
+		unsignedJWT, err := jwt.NewWithClaims(jwt.SigningMethodNone, util.GenerateStandardMapClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		require.Nil(t, err)
+
+		_, err = VerifyWithKey(unsignedJWT, &rsaKey.PublicKey)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify invalid PEMs return ErrInvalidKey", func(t *testing.T) {
+		_, err := ParsePrivateKeyPEM([]byte("not a pem"))
+		require.True(t, errors.Is(err, lcom.ErrInvalidKey))
+
+		_, err = ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")}))
+		require.True(t, errors.Is(err, lcom.ErrInvalidKey))
+	})
+	t.Run("verify PKCS #1 RSA keys are supported", func(t *testing.T) {
+		privateKey, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+		require.Nil(t, err)
+		require.True(t, rsaKey.Equal(privateKey))
+
+		publicKey, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}))
+		require.Nil(t, err)
+		require.True(t, rsaKey.PublicKey.Equal(publicKey))
+	})
+}
+
+func TestSignAndVerifyWithEnvKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	privatePEM, publicPEM := generatePEMKeys(t, ecKey)
+
+	t.Run("verify the issuer signs with the private key", func(t *testing.T) {
+		t.Setenv(lcom.PrivateKeyEnvKey, strings.ReplaceAll(string(privatePEM), "\n", `\n`))
+
+		signedJWT, err := Sign(util.GenerateExpandedMapClaims())
+		require.Nil(t, err)
+
+		token, _, err := new(jwt.Parser).ParseUnverified(signedJWT, jwt.MapClaims{})
+		require.Nil(t, err)
+		require.Equal(t, "ES384", token.Method.Alg())
+
+		t.Run("verify verifiers only need the public key", func(t *testing.T) {
+			t.Setenv(lcom.PrivateKeyEnvKey, "")
+			t.Setenv(lcom.HMACSecretEnvKey, "")
+			t.Setenv(lcom.PublicKeyEnvKey, string(publicPEM))
+
+			_, err = VerifyJWT(signedJWT)
+			require.Nil(t, err)
+		})
+		t.Run("verify algorithms outside the pinned list are rejected", func(t *testing.T) {
+			t.Setenv(lcom.PublicKeyEnvKey, string(publicPEM))
+			t.Setenv(lcom.JWTAlgorithmsEnvKey, "ES256")
+
+			_, err = VerifyJWT(signedJWT)
+			require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+		})
+	})
+	t.Run("verify the HMAC secret only accepts the pinned algorithms", func(t *testing.T) {
+		secret, err := hex.DecodeString(os.Getenv(lcom.HMACSecretEnvKey))
+		require.Nil(t, err)
+
+		hs256JWT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, util.GenerateStandardMapClaims()).SignedString(secret)
+		require.Nil(t, err)
+
+		_, err = VerifyJWT(hs256JWT)
+		require.Nil(t, err)
+
+		t.Setenv(lcom.JWTAlgorithmsEnvKey, "HS512")
+		_, err = VerifyJWT(hs256JWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+}
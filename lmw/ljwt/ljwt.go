@@ -12,14 +12,15 @@
 package ljwt
 
 import (
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/golang-jwt/jwt"
 	"github.com/seantcanavan/lambda_jwt_router/internal/util"
 	"github.com/seantcanavan/lambda_jwt_router/lcom"
-	"log"
+	"maps"
 	"net/http"
-	"os"
 	"strings"
 )
 
@@ -99,7 +100,15 @@ func ExtractCustom(mapClaims jwt.MapClaims, val any) error {
 // attempts to pull out a standard jwt.StandardClaims object from the claims map.
 // The input claims should have been generated originally by a jwt.StandardClaims
 // instance so they can be cleanly extracted back into an instance of jwt.StandardClaims.
+// An "aud" list is joined by spaces, see ParseAudience for the list itself.
 func ExtractStandard(mapClaims jwt.MapClaims, standardClaims *jwt.StandardClaims) error {
+	switch mapClaims[lcom.JWTClaimAudienceKey].(type) {
+	case nil, string:
+	default:
+		mapClaims = maps.Clone(mapClaims)
+		mapClaims[lcom.JWTClaimAudienceKey] = strings.Join(ParseAudience(mapClaims), " ")
+	}
+
 	jsonBytes, err := json.Marshal(mapClaims)
 	if err != nil {
 		return util.WrapErrors(err, lcom.ErrMarshalMapClaims)
@@ -113,64 +122,111 @@ func ExtractStandard(mapClaims jwt.MapClaims, standardClaims *jwt.StandardClaims
 	return nil
 }
 
+// StandardClaimsOf maps the registered claims of mapClaims onto
+// jwt.StandardClaims one by one. Unlike ExtractStandard it never fails: an
+// "aud" list is joined by spaces and claims of another type are left empty,
+// so claims from identity providers or introspection endpoints always fit.
+func StandardClaimsOf(mapClaims jwt.MapClaims) jwt.StandardClaims {
+	return jwt.StandardClaims{
+		Audience:  strings.Join(ParseAudience(mapClaims), " "),
+		ExpiresAt: int64Claim(mapClaims, lcom.JWTClaimExpiresAtKey),
+		Id:        stringClaim(mapClaims, lcom.JWTClaimIDKey),
+		IssuedAt:  int64Claim(mapClaims, lcom.JWTClaimIssuedAtKey),
+		Issuer:    stringClaim(mapClaims, lcom.JWTClaimIssuerKey),
+		NotBefore: int64Claim(mapClaims, lcom.JWTClaimNotBeforeKey),
+		Subject:   stringClaim(mapClaims, lcom.JWTClaimSubjectKey),
+	}
+}
+
+// ExpandedClaimsOf maps mapClaims onto ExpandedClaims like StandardClaimsOf.
+func ExpandedClaimsOf(mapClaims jwt.MapClaims) ExpandedClaims {
+	standardClaims := StandardClaimsOf(mapClaims)
+
+	return ExpandedClaims{
+		Audience:  standardClaims.Audience,
+		Email:     stringClaim(mapClaims, lcom.JWTClaimEmailKey),
+		ExpiresAt: standardClaims.ExpiresAt,
+		FirstName: stringClaim(mapClaims, lcom.JWTClaimFirstNameKey),
+		FullName:  stringClaim(mapClaims, lcom.JWTClaimFullNameKey),
+		ID:        standardClaims.Id,
+		IssuedAt:  standardClaims.IssuedAt,
+		Issuer:    standardClaims.Issuer,
+		Level:     stringClaim(mapClaims, lcom.JWTClaimLevelKey),
+		NotBefore: standardClaims.NotBefore,
+		Subject:   standardClaims.Subject,
+		UserType:  stringClaim(mapClaims, lcom.JWTClaimUserTypeKey),
+	}
+}
+
+// stringClaim returns the claim key if it is a string.
+func stringClaim(mapClaims jwt.MapClaims, key string) string {
+	value, _ := mapClaims[key].(string)
+	return value
+}
+
+// int64Claim returns the claim key if it is a number.
+func int64Claim(mapClaims jwt.MapClaims, key string) int64 {
+	value, _, _ := numericClaim(mapClaims, key)
+	return value
+}
+
 // Sign accepts a final set of claims, either jwt.StandardClaims, ExpandedClaims,
 // or something entirely custom that you have created yourself. It will sign the
 // claims using the HMAC value loaded from environment variables and return the
 // signed JWT if no error, otherwise the empty string and an error. To convert
 // a GoLang struct to a claims object use ExtendStandard or ExtendExpanded
 // to get started.
+//
+// If LAMBDA_JWT_ROUTER_PRIVATE_KEY contains an RSA, ECDSA or Ed25519 PEM
+// private key the claims are signed with it instead, using the first
+// algorithm in LAMBDA_JWT_ROUTER_JWT_ALGORITHMS or the default algorithm
+// for the key. See SignWithKey. If LAMBDA_JWT_ROUTER_HMAC_KEYRING is set the
+// claims are signed with the active key of that keyring and its kid is put
+// into the JWT header, see HMACKeyring. A missing or malformed key or secret returns
+// lcom.ErrInvalidKey or lcom.ErrInvalidHMACSecret. Use NewSigner to sign
+// without environment variables.
 func Sign(mapClaims jwt.MapClaims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, mapClaims)
-
-	// Sign and get the complete encoded token as a string using the secret
-	encodedToken, err := token.SignedString(getBinarySecret())
+	signer, err := signerFromEnv()
 	if err != nil {
-		return "", util.WrapErrors(err, lcom.ErrUnableToSignToken)
+		return "", err
 	}
 
-	return encodedToken, nil
+	return signer.Sign(mapClaims)
 }
 
 // VerifyJWT accepts the user JWT from the Authorization header
 // and returns the MapClaims or nil and an error set.
+//
+// If LAMBDA_JWT_ROUTER_JWKS_URL is set the JWT is verified with the keys of
+// that JWKS document, see JWKS. Otherwise, if LAMBDA_JWT_ROUTER_PUBLIC_KEY
+// contains an RSA, ECDSA or Ed25519 PEM public key the JWT is verified with
+// it, so Lambdas that only verify JWTs never hold the signing key. Otherwise
+// the key of LAMBDA_JWT_ROUTER_HMAC_KEYRING matching the kid of the JWT, or
+// the HMAC secret, is used. Only the algorithms in
+// LAMBDA_JWT_ROUTER_JWT_ALGORITHMS are accepted; if it isn't set the
+// algorithms of the JWKS keys, the default algorithm for the public key or
+// HS256, HS384 and HS512 for the HMAC secret are accepted. A missing or
+// malformed key or secret returns lcom.ErrInvalidKey or
+// lcom.ErrInvalidHMACSecret. Use NewVerifier to verify without environment
+// variables.
 func VerifyJWT(userJWT string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(userJWT, keyFunc)
+	verifier, err := verifierFromEnv()
 	if err != nil {
-		return nil, util.WrapErrors(err, lcom.ErrInvalidJWT)
-	}
-
-	if !token.Valid {
-		return nil, lcom.ErrInvalidToken
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, lcom.ErrInvalidTokenClaims
+	return verifier.Verify(context.Background(), userJWT)
 }
 
-func getBinarySecret() []byte {
-	secret := os.Getenv(lcom.HMACSecretEnvKey)
-	if secret == "" {
-		log.Fatalf("cannot encode / decode with an empty secret")
-	}
-
-	data, err := hex.DecodeString(secret)
+// VerifyClaims works like Verifier.VerifyClaims with the Verifier built
+// from the same environment variables VerifyJWT uses.
+func VerifyClaims(ctx context.Context, claims jwt.MapClaims) error {
+	verifier, err := verifierFromEnv()
 	if err != nil {
-		log.Fatalf("cannot decode the secret")
-	}
-
-	return data
-}
-
-func keyFunc(token *jwt.Token) (interface{}, error) {
-	// Don't forget to validate the alg is what you expect:
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, lcom.ErrUnsupportedSigningMethod
+		return err
 	}
 
-	return getBinarySecret(), nil
+	return verifier.VerifyClaims(ctx, claims)
 }
 
 // ExtractJWT will attempt to extract the JWT value and retrieve the map claims from an
@@ -178,18 +234,33 @@ func keyFunc(token *jwt.Token) (interface{}, error) {
 // along with an appropriate HTTP status code as an integer. If everything goes right
 // then error will be nil and the int will be http.StatusOK
 func ExtractJWT(headers map[string]string) (jwt.MapClaims, int, error) {
-	authorizationHeader := headers["Authorization"]
-	if authorizationHeader == "" {
-		return nil, http.StatusBadRequest, lcom.ErrNoAuthorizationHeader
+	return ExtractJWTFromRequest(events.APIGatewayProxyRequest{Headers: headers})
+}
+
+// ExtractJWTFromRequest works like ExtractJWT but looks for the JWT in the
+// token sources of LAMBDA_JWT_ROUTER_TOKEN_SOURCES, see ParseTokenSources,
+// which may include cookies and query parameters. If it isn't set the
+// "Authorization: Bearer" header is used.
+func ExtractJWTFromRequest(req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+	sources, err := envTokenSources()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
 	}
 
-	if !strings.HasPrefix(authorizationHeader, "Bearer ") {
-		return nil, http.StatusBadRequest, lcom.ErrNoBearerPrefix
+	userJWT, err := ExtractToken(req, sources...)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
 	}
 
-	userJwt := strings.TrimPrefix(authorizationHeader, "Bearer ")
+	verifier, err := verifierFromEnv()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
 
-	mapClaims, err := VerifyJWT(userJwt)
+	mapClaims, err := verifier.Verify(context.Background(), userJWT)
+	if errors.Is(err, lcom.ErrRevocationCheck) {
+		return nil, http.StatusInternalServerError, err
+	}
 	if err != nil {
 		return nil, http.StatusUnauthorized, util.WrapErrors(err, lcom.ErrVerifyJWT)
 	}
@@ -131,6 +131,34 @@ func TestExtractStandardClaims(t *testing.T) {
 		require.Equal(t, customClaims[lcom.JWTClaimNotBeforeKey], standardClaims.NotBefore)
 		require.Equal(t, customClaims[lcom.JWTClaimSubjectKey], standardClaims.Subject)
 	})
+	t.Run("verify ExtractStandard joins an aud list", func(t *testing.T) {
+		var standardClaims jwt.StandardClaims
+		err := ExtractStandard(jwt.MapClaims{lcom.JWTClaimAudienceKey: []any{"books", "authors"}}, &standardClaims)
+		require.Nil(t, err)
+		require.Equal(t, "books authors", standardClaims.Audience)
+	})
+	t.Run("verify StandardClaimsOf and ExpandedClaimsOf skip claims of another type", func(t *testing.T) {
+		mapClaims := jwt.MapClaims{
+			lcom.JWTClaimAudienceKey:  []any{"books", "authors"},
+			lcom.JWTClaimExpiresAtKey: float64(1700000000),
+			lcom.JWTClaimSubjectKey:   "user-42",
+			lcom.JWTClaimIssuerKey:    42,
+			lcom.JWTClaimEmailKey:     []any{"a@example.com"},
+			lcom.JWTClaimUserTypeKey:  "admin",
+		}
+
+		require.Equal(t, jwt.StandardClaims{
+			Audience:  "books authors",
+			ExpiresAt: 1700000000,
+			Subject:   "user-42",
+		}, StandardClaimsOf(mapClaims))
+		require.Equal(t, ExpandedClaims{
+			Audience:  "books authors",
+			ExpiresAt: 1700000000,
+			Subject:   "user-42",
+			UserType:  "admin",
+		}, ExpandedClaimsOf(mapClaims))
+	})
 }
 
 func TestSign(t *testing.T) {
@@ -215,21 +243,27 @@ func TestExtractJWT(t *testing.T) {
 		require.NotNil(t, extractErr)
 		require.True(t, errors.Is(extractErr, lcom.ErrNoAuthorizationHeader))
 	})
-	t.Run("verify ExtractJWT returns err for Authorization header misspelled - all caps", func(t *testing.T) {
-		headers := map[string]string{"AUTHORIZATION": signedJWT}
+	t.Run("verify ExtractJWT accepts the Authorization header in all caps", func(t *testing.T) {
+		headers := map[string]string{"AUTHORIZATION": "Bearer " + signedJWT}
 		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
-		require.True(t, len(mapClaims) == 0)
-		require.Equal(t, http.StatusBadRequest, httpStatus)
-		require.NotNil(t, extractErr)
-		require.True(t, errors.Is(extractErr, lcom.ErrNoAuthorizationHeader))
+		require.True(t, len(mapClaims) == 7)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Nil(t, extractErr)
+	})
+	t.Run("verify ExtractJWT accepts the Authorization header in lowercase", func(t *testing.T) {
+		headers := map[string]string{"authorization": "Bearer " + signedJWT}
+		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
+		require.True(t, len(mapClaims) == 7)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Nil(t, extractErr)
 	})
-	t.Run("verify ExtractJWT returns err for Authorization header misspelled - lowercase", func(t *testing.T) {
+	t.Run("verify ExtractJWT returns err for lowercase Authorization header without bearer prefix", func(t *testing.T) {
 		headers := map[string]string{"authorization": signedJWT}
 		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
 		require.True(t, len(mapClaims) == 0)
 		require.Equal(t, http.StatusBadRequest, httpStatus)
 		require.NotNil(t, extractErr)
-		require.True(t, errors.Is(extractErr, lcom.ErrNoAuthorizationHeader))
+		require.True(t, errors.Is(extractErr, lcom.ErrNoBearerPrefix))
 	})
 	t.Run("verify ExtractJWT returns err for bearer prefix not used", func(t *testing.T) {
 		headers := map[string]string{"Authorization": signedJWT}
@@ -239,17 +273,23 @@ func TestExtractJWT(t *testing.T) {
 		require.NotNil(t, extractErr)
 		require.True(t, errors.Is(extractErr, lcom.ErrNoBearerPrefix))
 	})
-	t.Run("verify ExtractJWT returns err for bearer not camel cased", func(t *testing.T) {
+	t.Run("verify ExtractJWT accepts bearer not camel cased", func(t *testing.T) {
 		headers := map[string]string{"Authorization": "bearer " + signedJWT}
 		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
-		require.True(t, len(mapClaims) == 0)
-		require.Equal(t, http.StatusBadRequest, httpStatus)
-		require.NotNil(t, extractErr)
-		require.True(t, errors.Is(extractErr, lcom.ErrNoBearerPrefix))
+		require.True(t, len(mapClaims) == 7)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Nil(t, extractErr)
 	})
-	t.Run("verify ExtractJWT returns err for BEARER all caps", func(t *testing.T) {
+	t.Run("verify ExtractJWT accepts BEARER all caps", func(t *testing.T) {
 		headers := map[string]string{"Authorization": "BEARER " + signedJWT}
 		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
+		require.True(t, len(mapClaims) == 7)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Nil(t, extractErr)
+	})
+	t.Run("verify ExtractJWT returns err for another scheme", func(t *testing.T) {
+		headers := map[string]string{"Authorization": "Basic " + signedJWT}
+		mapClaims, httpStatus, extractErr := ExtractJWT(headers)
 		require.True(t, len(mapClaims) == 0)
 		require.Equal(t, http.StatusBadRequest, httpStatus)
 		require.NotNil(t, extractErr)
@@ -279,4 +319,13 @@ func TestExtractJWT(t *testing.T) {
 		require.Equal(t, mapClaims[lcom.JWTClaimNotBeforeKey], mapClaims[lcom.JWTClaimNotBeforeKey])
 		require.Equal(t, mapClaims[lcom.JWTClaimSubjectKey], mapClaims[lcom.JWTClaimSubjectKey])
 	})
+	t.Run("verify ExtractJWT returns 500 when the revocation check fails", func(t *testing.T) {
+		DefaultRevocationStore = &failingRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore()}
+		defer func() { DefaultRevocationStore = nil }()
+
+		headers := map[string]string{"Authorization": "Bearer " + signedJWT}
+		_, httpStatus, extractErr := ExtractJWT(headers)
+		require.Equal(t, http.StatusInternalServerError, httpStatus)
+		require.True(t, errors.Is(extractErr, lcom.ErrRevocationCheck))
+	})
 }
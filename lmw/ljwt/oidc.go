@@ -0,0 +1,383 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCDiscoveryPath is appended to the issuer to find its OIDC discovery
+// document.
+const OIDCDiscoveryPath = "/.well-known/openid-configuration"
+
+// OIDCDiscovery holds the fields of an OIDC discovery document the
+// OIDCVerifier uses.
+type OIDCDiscovery struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// IDTokenClaims are the claims of a verified OIDC ID token. Claims holds all
+// of them, including the ones without a field.
+type IDTokenClaims struct {
+	Issuer          string
+	Subject         string
+	Audience        []string
+	AuthorizedParty string
+	ExpiresAt       int64
+	IssuedAt        int64
+	AuthTime        int64
+	Nonce           string
+	AccessTokenHash string
+	Email           string
+	EmailVerified   bool
+	Name            string
+	GivenName       string
+	FamilyName      string
+	Claims          jwt.MapClaims
+}
+
+// ExpandedClaims returns the ExpandedClaims of the user the ID token was
+// issued for so it can be exchanged for one of our own JWTs. The email is
+// only copied if the identity provider verified it. Set the issuer,
+// audience, times and the rest of the claims yourself before signing:
+//
+//	expanded := idClaims.ExpandedClaims()
+//	expanded.UserType = "member"
+//	expanded.ExpiresAt = time.Now().Add(time.Hour).Unix()
+//	userJWT, err := ljwt.Sign(ljwt.ExtendExpanded(expanded))
+func (c IDTokenClaims) ExpandedClaims() ExpandedClaims {
+	expanded := ExpandedClaims{
+		FirstName: c.GivenName,
+		FullName:  c.Name,
+		Subject:   c.Subject,
+	}
+
+	if expanded.FullName == "" {
+		expanded.FullName = strings.TrimSpace(c.GivenName + " " + c.FamilyName)
+	}
+
+	if c.EmailVerified {
+		expanded.Email = c.Email
+	}
+
+	return expanded
+}
+
+// IDTokenChecks are the values of the authentication request an ID token is
+// checked against.
+type IDTokenChecks struct {
+	// Nonce is the nonce sent with the authentication request. If it is set
+	// the ID token must carry the same nonce.
+	Nonce string
+
+	// AccessToken is the access token returned along with the ID token. If
+	// it is set and the ID token has an "at_hash" claim the hash must match.
+	AccessToken string
+}
+
+// OIDCVerifier verifies the ID tokens of an OpenID Connect identity provider
+// such as Cognito, Auth0 or Google. The discovery document and the JWKS it
+// points to are fetched on first use and cached, so keep the OIDCVerifier in
+// a package level variable:
+//
+//	var oidc = ljwt.NewOIDCVerifier("https://cognito-idp.us-east-1.amazonaws.com/us-east-1_abc", "my-client-id")
+//
+//	idClaims, err := oidc.Verify(ctx, idToken, ljwt.IDTokenChecks{Nonce: nonce})
+//
+// Besides the signature, "exp" and "iat" it checks that "iss" is the issuer,
+// that "aud" contains one of the client IDs and that "azp", if set or if
+// there are several audiences, is one of them. Set the exported fields
+// before the first Verify; they are read once.
+type OIDCVerifier struct {
+	// Issuer is the exact "iss" of the identity provider.
+	Issuer string
+
+	// ClientIDs are the client IDs ID tokens may be issued to.
+	ClientIDs []string
+
+	// DiscoveryURL is the address of the discovery document. It defaults
+	// to Issuer followed by OIDCDiscoveryPath.
+	DiscoveryURL string
+
+	// JWKSURL overrides the "jwks_uri" of the discovery document. If it is
+	// set the discovery document isn't fetched at all, which is handy for
+	// local test servers.
+	JWKSURL string
+
+	// MaxAge is the max_age of the authentication request. If it is set the
+	// ID token must have an "auth_time" no older than MaxAge.
+	MaxAge time.Duration
+
+	// Leeway is the clock skew tolerated for all time based claims.
+	Leeway time.Duration
+
+	// Fetch returns the document at url and is used for the discovery
+	// document and the JWKS. It defaults to an HTTP GET with a 10 second
+	// timeout.
+	Fetch func(ctx context.Context, url string) ([]byte, error)
+
+	// Revocations is checked for revoked ID tokens. Unlike Verifier it
+	// doesn't fall back to DefaultRevocationStore, whose subjects are those
+	// of the JWTs you issue and not those of the identity provider, so ID
+	// tokens aren't checked for revocation while it is nil.
+	Revocations RevocationStore
+
+	mu       sync.Mutex
+	verifier *Verifier
+	now      func() time.Time
+}
+
+// NewOIDCVerifier returns an OIDCVerifier for the ID tokens issuer issues to
+// clientIDs.
+func NewOIDCVerifier(issuer string, clientIDs ...string) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuer:       issuer,
+		ClientIDs:    clientIDs,
+		DiscoveryURL: strings.TrimSuffix(issuer, "/") + OIDCDiscoveryPath,
+		Fetch:        fetchJWKS,
+		now:          time.Now,
+	}
+}
+
+// Verify verifies idToken and checks it against the authentication request
+// described by checks. Rejected ID tokens return lcom.ErrInvalidIDToken
+// along with the reason, such as lcom.ErrInvalidNonce or
+// lcom.ErrTokenExpired. Discovery and configuration problems return
+// lcom.ErrOIDCConfig.
+func (v *OIDCVerifier) Verify(ctx context.Context, idToken string, checks IDTokenChecks) (IDTokenClaims, error) {
+	verifier, err := v.load(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	mapClaims, err := verifier.Verify(ctx, idToken)
+	if err != nil {
+		return IDTokenClaims{}, util.WrapErrors(err, lcom.ErrInvalidIDToken)
+	}
+
+	claims, err := idTokenClaims(mapClaims)
+	if err != nil {
+		return IDTokenClaims{}, util.WrapErrors(err, lcom.ErrInvalidIDToken)
+	}
+
+	err = v.check(idToken, claims, checks)
+	if err != nil {
+		return IDTokenClaims{}, util.WrapErrors(err, lcom.ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// load returns the Verifier for the ID tokens, fetching the discovery
+// document the first time. Failures aren't cached so the next call tries
+// again.
+func (v *OIDCVerifier) load(ctx context.Context) (*Verifier, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.verifier != nil {
+		return v.verifier, nil
+	}
+
+	if v.Issuer == "" || len(v.ClientIDs) == 0 {
+		return nil, util.WrapErrors(fmt.Errorf("an issuer and at least one client ID are required"), lcom.ErrOIDCConfig)
+	}
+
+	fetch := v.Fetch
+	if fetch == nil {
+		fetch = fetchJWKS
+	}
+
+	discoveryURL := v.DiscoveryURL
+	if discoveryURL == "" {
+		discoveryURL = strings.TrimSuffix(v.Issuer, "/") + OIDCDiscoveryPath
+	}
+
+	discovery := OIDCDiscovery{Issuer: v.Issuer, JWKSURI: v.JWKSURL}
+	if v.JWKSURL == "" {
+		body, err := fetch(ctx, discoveryURL)
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrOIDCConfig)
+		}
+
+		err = json.Unmarshal(body, &discovery)
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrOIDCConfig)
+		}
+
+		// OIDC Discovery 1.0 section 4.3
+		if discovery.Issuer != v.Issuer {
+			return nil, util.WrapErrors(fmt.Errorf("the discovery document is for issuer %q instead of %q", discovery.Issuer, v.Issuer), lcom.ErrOIDCConfig)
+		}
+
+		if discovery.JWKSURI == "" {
+			return nil, util.WrapErrors(fmt.Errorf("the discovery document has no jwks_uri"), lcom.ErrOIDCConfig)
+		}
+	}
+
+	jwks := NewJWKS(discovery.JWKSURI)
+	jwks.Fetch = fetch
+
+	// ID tokens are verified with the provider's public keys, so HMAC and
+	// "none" are never accepted even if the provider supports them
+	var algorithms []string
+	for _, alg := range discovery.IDTokenSigningAlgValuesSupported {
+		if alg != "none" && !slices.Contains(hmacAlgorithms, alg) {
+			algorithms = append(algorithms, alg)
+		}
+	}
+
+	revocations := v.Revocations
+	if revocations == nil {
+		revocations = noRevocationStore{}
+	}
+
+	verifier, err := NewVerifier(
+		WithJWKS(jwks),
+		WithAlgorithms(algorithms...),
+		WithIssuer(v.Issuer),
+		WithAudience(v.ClientIDs...),
+		WithLeeway(v.Leeway),
+		WithRequiredClaims(lcom.JWTClaimSubjectKey, lcom.JWTClaimExpiresAtKey, lcom.JWTClaimIssuedAtKey),
+		WithClock(v.clock),
+		WithRevocationStore(revocations),
+	)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrOIDCConfig)
+	}
+
+	v.verifier = verifier
+
+	return verifier, nil
+}
+
+// clock returns the current time, from time.Now unless a test replaced it.
+func (v *OIDCVerifier) clock() time.Time {
+	if v.now == nil {
+		return time.Now()
+	}
+
+	return v.now()
+}
+
+// check runs the ID token validation steps of OIDC Core 1.0 section 3.1.3.7
+// the Verifier doesn't cover.
+func (v *OIDCVerifier) check(idToken string, claims IDTokenClaims, checks IDTokenChecks) error {
+	if claims.AuthorizedParty != "" || len(claims.Audience) > 1 {
+		if !slices.Contains(v.ClientIDs, claims.AuthorizedParty) {
+			return util.WrapErrors(fmt.Errorf("azp %q is not one of %s", claims.AuthorizedParty, strings.Join(v.ClientIDs, ", ")), lcom.ErrInvalidAuthorizedParty)
+		}
+	}
+
+	if checks.Nonce != "" && subtle.ConstantTimeCompare([]byte(checks.Nonce), []byte(claims.Nonce)) != 1 {
+		return util.WrapErrors(fmt.Errorf("the ID token nonce does not match"), lcom.ErrInvalidNonce)
+	}
+
+	if v.MaxAge > 0 {
+		if claims.AuthTime == 0 {
+			return util.WrapErrors(fmt.Errorf("token is missing the required claim %q", "auth_time"), lcom.ErrMissingClaim)
+		}
+
+		authTime := time.Unix(claims.AuthTime, 0)
+		if v.clock().After(authTime.Add(v.MaxAge + v.Leeway)) {
+			return util.WrapErrors(fmt.Errorf("the user authenticated at %s", authTime.UTC().Format(time.RFC3339)), lcom.ErrAuthTooOld)
+		}
+	}
+
+	if checks.AccessToken != "" && claims.AccessTokenHash != "" {
+		token, _, err := new(jwt.Parser).ParseUnverified(idToken, jwt.MapClaims{})
+		if err != nil {
+			return err
+		}
+
+		atHash, err := AccessTokenHash(token.Method.Alg(), checks.AccessToken)
+		if err != nil {
+			return util.WrapErrors(err, lcom.ErrInvalidAccessTokenHash)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(atHash), []byte(claims.AccessTokenHash)) != 1 {
+			return util.WrapErrors(fmt.Errorf("the at_hash claim does not match"), lcom.ErrInvalidAccessTokenHash)
+		}
+	}
+
+	return nil
+}
+
+// AccessTokenHash returns the "at_hash" of accessToken for an ID token
+// signed with alg: the base64url encoded left half of the access token's
+// hash, using the hash function of alg.
+func AccessTokenHash(alg, accessToken string) (string, error) {
+	var hash crypto.Hash
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "512"), alg == jwt.SigningMethodEdDSA.Alg():
+		hash = crypto.SHA512
+	default:
+		return "", util.WrapErrors(fmt.Errorf("no hash function for %q", alg), lcom.ErrUnsupportedSigningMethod)
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(accessToken))
+	sum := hasher.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// idTokenClaims converts verified mapClaims into IDTokenClaims.
+func idTokenClaims(mapClaims jwt.MapClaims) (IDTokenClaims, error) {
+	stringClaim := func(key string) string {
+		value, _ := mapClaims[key].(string)
+		return value
+	}
+
+	claims := IDTokenClaims{
+		Issuer:          stringClaim(lcom.JWTClaimIssuerKey),
+		Subject:         stringClaim(lcom.JWTClaimSubjectKey),
+		Audience:        ParseAudience(mapClaims),
+		AuthorizedParty: stringClaim("azp"),
+		Nonce:           stringClaim("nonce"),
+		AccessTokenHash: stringClaim("at_hash"),
+		Email:           stringClaim(lcom.JWTClaimEmailKey),
+		Name:            stringClaim("name"),
+		GivenName:       stringClaim("given_name"),
+		FamilyName:      stringClaim("family_name"),
+		Claims:          mapClaims,
+	}
+
+	// Cognito sends email_verified as a string
+	switch verified := mapClaims["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+
+	var err error
+	for key, value := range map[string]*int64{
+		lcom.JWTClaimExpiresAtKey: &claims.ExpiresAt,
+		lcom.JWTClaimIssuedAtKey:  &claims.IssuedAt,
+		"auth_time":               &claims.AuthTime,
+	} {
+		*value, _, err = numericClaim(mapClaims, key)
+		if err != nil {
+			return IDTokenClaims{}, err
+		}
+	}
+
+	return claims, nil
+}
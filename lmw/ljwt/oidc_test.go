@@ -0,0 +1,212 @@
+package ljwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newOIDCServer serves a discovery document and the JWKS of key under
+// the kid "idp"
+func newOIDCServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	jwk, err := NewJWK("idp", "RS256", key.Public())
+	require.Nil(t, err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc(OIDCDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                           server.URL,
+			JWKSURI:                          server.URL + "/jwks.json",
+			IDTokenSigningAlgValuesSupported: []string{"RS256", "HS256", "none"},
+		}))
+	})
+	mux.HandleFunc("/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		require.Nil(t, json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}}))
+	})
+
+	return server
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	server := newOIDCServer(t, key)
+	verifier := NewOIDCVerifier(server.URL, "web-client", "mobile-client")
+
+	now := time.Now()
+	idClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            server.URL,
+			"sub":            "user-42",
+			"aud":            "web-client",
+			"exp":            now.Add(time.Hour).Unix(),
+			"iat":            now.Unix(),
+			"auth_time":      now.Add(-time.Minute).Unix(),
+			"nonce":          "n-0S6_WzA2Mj",
+			"email":          "jane@example.com",
+			"email_verified": "true",
+			"given_name":     "Jane",
+			"family_name":    "Doe",
+		}
+	}
+
+	t.Run("verify a valid ID token is accepted", func(t *testing.T) {
+		claims, err := verifier.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{Nonce: "n-0S6_WzA2Mj"})
+		require.Nil(t, err)
+		require.Equal(t, "user-42", claims.Subject)
+		require.Equal(t, []string{"web-client"}, claims.Audience)
+		require.True(t, claims.EmailVerified)
+		require.Equal(t, now.Add(-time.Minute).Unix(), claims.AuthTime)
+
+		expanded := claims.ExpandedClaims()
+		require.Equal(t, "user-42", expanded.Subject)
+		require.Equal(t, "jane@example.com", expanded.Email)
+		require.Equal(t, "Jane", expanded.FirstName)
+		require.Equal(t, "Jane Doe", expanded.FullName)
+	})
+
+	t.Run("verify a wrong or missing nonce is rejected", func(t *testing.T) {
+		_, err := verifier.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{Nonce: "replayed"})
+		require.True(t, errors.Is(err, lcom.ErrInvalidNonce))
+		require.True(t, errors.Is(err, lcom.ErrInvalidIDToken))
+
+		claims := idClaims()
+		delete(claims, "nonce")
+		_, err = verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{Nonce: "n-0S6_WzA2Mj"})
+		require.True(t, errors.Is(err, lcom.ErrInvalidNonce))
+	})
+
+	t.Run("verify the issuer and audience are checked", func(t *testing.T) {
+		claims := idClaims()
+		claims["iss"] = "https://evil.example.com"
+		_, err := verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrInvalidIssuer))
+
+		claims = idClaims()
+		claims["aud"] = "other-client"
+		_, err = verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrInvalidAudience))
+	})
+
+	t.Run("verify azp is required for several audiences and must be a client ID", func(t *testing.T) {
+		claims := idClaims()
+		claims["aud"] = []string{"web-client", "api"}
+		_, err := verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrInvalidAuthorizedParty))
+
+		claims["azp"] = "api"
+		_, err = verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrInvalidAuthorizedParty))
+
+		claims["azp"] = "mobile-client"
+		_, err = verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.Nil(t, err)
+	})
+
+	t.Run("verify at_hash must match the access token", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("access-token"))
+		claims := idClaims()
+		claims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:16])
+		idToken := signWithKID(t, claims, "idp", key)
+
+		_, err := verifier.Verify(ctx, idToken, IDTokenChecks{AccessToken: "access-token"})
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, idToken, IDTokenChecks{AccessToken: "other-token"})
+		require.True(t, errors.Is(err, lcom.ErrInvalidAccessTokenHash))
+	})
+
+	t.Run("verify auth_time is checked against the max age", func(t *testing.T) {
+		maxAgeVerifier := NewOIDCVerifier(server.URL, "web-client")
+		maxAgeVerifier.MaxAge = 5 * time.Minute
+
+		_, err := maxAgeVerifier.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.Nil(t, err)
+
+		claims := idClaims()
+		claims["auth_time"] = now.Add(-time.Hour).Unix()
+		_, err = maxAgeVerifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrAuthTooOld))
+
+		delete(claims, "auth_time")
+		_, err = maxAgeVerifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrMissingClaim))
+	})
+
+	t.Run("verify expired and HMAC signed ID tokens are rejected", func(t *testing.T) {
+		claims := idClaims()
+		claims["exp"] = now.Add(-time.Hour).Unix()
+		_, err := verifier.Verify(ctx, signWithKID(t, claims, "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrTokenExpired))
+
+		hmacJWT, err := jwt.NewWithClaims(jwt.SigningMethodHS256, idClaims()).SignedString([]byte("web-client-secret"))
+		require.Nil(t, err)
+		_, err = verifier.Verify(ctx, hmacJWT, IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrInvalidIDToken))
+	})
+
+	t.Run("verify a discovery document for another issuer is rejected", func(t *testing.T) {
+		wrongIssuer := NewOIDCVerifier(server.URL+"/tenant", "web-client")
+		wrongIssuer.DiscoveryURL = server.URL + OIDCDiscoveryPath
+
+		_, err := wrongIssuer.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrOIDCConfig))
+	})
+
+	t.Run("verify a struct literal verifier uses the defaults", func(t *testing.T) {
+		literal := &OIDCVerifier{Issuer: server.URL, ClientIDs: []string{"web-client"}, MaxAge: 5 * time.Minute}
+
+		_, err := literal.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.Nil(t, err)
+	})
+
+	t.Run("verify only the Revocations store is checked for revoked ID tokens", func(t *testing.T) {
+		DefaultRevocationStore = NewMemoryRevocationStore()
+		defer func() { DefaultRevocationStore = nil }()
+		require.Nil(t, RevokeSubject(ctx, DefaultRevocationStore, "user-42", now.Add(time.Minute), time.Hour))
+
+		_, err := verifier.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.Nil(t, err)
+
+		revoking := NewOIDCVerifier(server.URL, "web-client")
+		revoking.Revocations = DefaultRevocationStore
+		_, err = revoking.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.True(t, errors.Is(err, lcom.ErrTokenRevoked))
+	})
+
+	t.Run("verify JWKSURL skips discovery", func(t *testing.T) {
+		direct := NewOIDCVerifier(server.URL, "web-client")
+		direct.DiscoveryURL = server.URL + "/missing"
+		direct.JWKSURL = server.URL + "/jwks.json"
+
+		_, err := direct.Verify(ctx, signWithKID(t, idClaims(), "idp", key), IDTokenChecks{})
+		require.Nil(t, err)
+	})
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	// OIDC Core 1.0 appendix A.3
+	atHash, err := AccessTokenHash("RS256", "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y")
+	require.Nil(t, err)
+	require.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", atHash)
+
+	_, err = AccessTokenHash("none", "token")
+	require.True(t, errors.Is(err, lcom.ErrUnsupportedSigningMethod))
+}
@@ -0,0 +1,278 @@
+package ljwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"maps"
+	"sync"
+	"time"
+)
+
+// DefaultAccessTokenTTL is the default lifetime of the access tokens a
+// TokenIssuer signs.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// DefaultRefreshTokenTTL is the default lifetime of the refresh tokens a
+// TokenIssuer issues.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshToken is the record a RefreshStore keeps for every refresh token.
+// The refresh token itself is never stored, only its SHA-256 hash.
+type RefreshToken struct {
+	// ID is the hex encoded SHA-256 hash of the refresh token.
+	ID string `json:"id"`
+
+	// FamilyID is shared by every refresh token rotated from the same login.
+	FamilyID string `json:"familyId"`
+
+	// Claims are the claims of the access tokens the refresh token mints.
+	Claims jwt.MapClaims `json:"claims"`
+
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RefreshStore persists refresh tokens for a TokenIssuer. Implement it on top
+// of DynamoDB, Redis or similar to share refresh tokens across Lambdas; use
+// MemoryRefreshStore in tests.
+type RefreshStore interface {
+	// Save stores a newly issued refresh token.
+	Save(ctx context.Context, token RefreshToken) error
+
+	// Use marks the refresh token id as used and returns it. It must be
+	// atomic so a refresh token can only be used once. If the token was used
+	// before it returns the token and lcom.ErrRefreshTokenReused. If it
+	// doesn't exist or was revoked it returns lcom.ErrInvalidRefreshToken.
+	Use(ctx context.Context, id string) (RefreshToken, error)
+
+	// RevokeFamily revokes every refresh token of the family familyID.
+	RevokeFamily(ctx context.Context, familyID string) error
+}
+
+// TokenPair is an access token and the refresh token to get the next one
+// with. It marshals to the OAuth 2.0 token response.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+}
+
+// TokenIssuer issues short lived access tokens together with refresh tokens
+// and rotates the refresh token every time it is used. Using a refresh token
+// a second time, which means it was stolen or replayed, revokes every
+// refresh token of its family so the session has to log in again.
+type TokenIssuer struct {
+	// AccessTTL is the lifetime of the access tokens.
+	AccessTTL time.Duration
+
+	// RefreshTTL is the lifetime of each refresh token. Every rotation
+	// issues a refresh token with a fresh lifetime.
+	RefreshTTL time.Duration
+
+	signer *Signer
+	store  RefreshStore
+	now    func() time.Time
+}
+
+// NewTokenIssuer returns a TokenIssuer that signs access tokens with signer
+// and keeps refresh tokens in store. A nil signer signs like Sign does, with
+// the key material from environment variables.
+func NewTokenIssuer(signer *Signer, store RefreshStore) *TokenIssuer {
+	return &TokenIssuer{
+		AccessTTL:  DefaultAccessTokenTTL,
+		RefreshTTL: DefaultRefreshTokenTTL,
+		signer:     signer,
+		store:      store,
+		now:        time.Now,
+	}
+}
+
+// Issue starts a new token family for a login and returns its first access
+// and refresh token. The access tokens get a fresh "jti", "iat", "nbf" and
+// "exp" every time they are signed, all other claims are kept as is.
+func (i *TokenIssuer) Issue(ctx context.Context, mapClaims jwt.MapClaims) (TokenPair, error) {
+	familyID, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return i.issue(ctx, familyID, maps.Clone(mapClaims))
+}
+
+// Refresh rotates refreshToken and returns a new access and refresh token.
+// An unknown, expired or revoked refresh token returns
+// lcom.ErrInvalidRefreshToken. A refresh token that was already used revokes
+// its family and returns lcom.ErrRefreshTokenReused.
+func (i *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	token, err := i.store.Use(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, lcom.ErrRefreshTokenReused) {
+		revokeErr := i.store.RevokeFamily(ctx, token.FamilyID)
+		if revokeErr != nil {
+			return TokenPair{}, revokeErr
+		}
+
+		return TokenPair{}, util.WrapErrors(lcom.ErrRefreshTokenReused, lcom.ErrInvalidRefreshToken)
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if !i.now().Before(token.ExpiresAt) {
+		return TokenPair{}, util.WrapErrors(fmt.Errorf("refresh token expired at %s", token.ExpiresAt.UTC().Format(time.RFC3339)), lcom.ErrInvalidRefreshToken)
+	}
+
+	return i.issue(ctx, token.FamilyID, token.Claims)
+}
+
+// issue signs an access token for mapClaims and saves a new refresh token of
+// the family familyID.
+func (i *TokenIssuer) issue(ctx context.Context, familyID string, mapClaims jwt.MapClaims) (TokenPair, error) {
+	now := i.now()
+
+	jti, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	accessClaims := maps.Clone(mapClaims)
+	if accessClaims == nil {
+		accessClaims = jwt.MapClaims{}
+	}
+	accessClaims[lcom.JWTClaimIDKey] = jti
+	accessClaims[lcom.JWTClaimIssuedAtKey] = now.Unix()
+	accessClaims[lcom.JWTClaimNotBeforeKey] = now.Unix()
+	accessClaims[lcom.JWTClaimExpiresAtKey] = now.Add(i.AccessTTL).Unix()
+
+	var accessToken string
+	if i.signer != nil {
+		accessToken, err = i.signer.Sign(accessClaims)
+	} else {
+		accessToken, err = Sign(accessClaims)
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	err = i.store.Save(ctx, RefreshToken{
+		ID:        hashRefreshToken(refreshToken),
+		FamilyID:  familyID,
+		Claims:    mapClaims,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(i.RefreshTTL),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		ExpiresIn:    int64(i.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+	}, nil
+}
+
+// MemoryRefreshStore is a RefreshStore that keeps refresh tokens in memory.
+// It is meant for tests and single instance development servers since
+// Lambdas don't share memory. Expired tokens are dropped on Save.
+type MemoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]*memoryRefreshToken
+}
+
+type memoryRefreshToken struct {
+	token   RefreshToken
+	used    bool
+	revoked bool
+}
+
+// NewMemoryRefreshStore returns an empty MemoryRefreshStore.
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{tokens: map[string]*memoryRefreshToken{}}
+}
+
+// Save implements RefreshStore.
+func (s *MemoryRefreshStore) Save(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, stored := range s.tokens {
+		if now.After(stored.token.ExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[token.ID] = &memoryRefreshToken{token: token}
+
+	return nil
+}
+
+// Use implements RefreshStore.
+func (s *MemoryRefreshStore) Use(ctx context.Context, id string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tokens[id]
+	if !ok {
+		return RefreshToken{}, util.WrapErrors(fmt.Errorf("unknown refresh token"), lcom.ErrInvalidRefreshToken)
+	}
+
+	if stored.revoked {
+		return RefreshToken{}, util.WrapErrors(fmt.Errorf("revoked refresh token"), lcom.ErrInvalidRefreshToken)
+	}
+
+	if stored.used {
+		return stored.token, lcom.ErrRefreshTokenReused
+	}
+
+	stored.used = true
+
+	return stored.token, nil
+}
+
+// RevokeFamily implements RefreshStore.
+func (s *MemoryRefreshStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.tokens {
+		if stored.token.FamilyID == familyID {
+			stored.revoked = true
+		}
+	}
+
+	return nil
+}
+
+// randomToken returns 32 random bytes encoded as unpadded base64url.
+func randomToken() (string, error) {
+	data := make([]byte, 32)
+
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// hashRefreshToken returns the RefreshToken.ID of refreshToken.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package ljwt
+
+import (
+	"context"
+	"errors"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	secret := []byte("token issuer secret")
+	ctx := context.Background()
+
+	signer, err := NewSigner(WithHMACSecret(secret))
+	require.Nil(t, err)
+
+	verifier, err := NewVerifier(WithHMACSecret(secret))
+	require.Nil(t, err)
+
+	t.Run("verify issued access tokens verify and carry fresh claims", func(t *testing.T) {
+		issuer := NewTokenIssuer(signer, NewMemoryRefreshStore())
+
+		claims := util.GenerateExpandedMapClaims()
+		tokenPair, err := issuer.Issue(ctx, claims)
+		require.Nil(t, err)
+		require.Equal(t, "Bearer", tokenPair.TokenType)
+		require.Equal(t, int64(DefaultAccessTokenTTL.Seconds()), tokenPair.ExpiresIn)
+		require.NotEmpty(t, tokenPair.RefreshToken)
+
+		accessClaims, err := verifier.Verify(ctx, tokenPair.AccessToken)
+		require.Nil(t, err)
+		require.Equal(t, claims[lcom.JWTClaimEmailKey], accessClaims[lcom.JWTClaimEmailKey])
+		require.NotEqual(t, claims[lcom.JWTClaimIDKey], accessClaims[lcom.JWTClaimIDKey])
+
+		refreshedPair, err := issuer.Refresh(ctx, tokenPair.RefreshToken)
+		require.Nil(t, err)
+		require.NotEqual(t, tokenPair.RefreshToken, refreshedPair.RefreshToken)
+
+		refreshedClaims, err := verifier.Verify(ctx, refreshedPair.AccessToken)
+		require.Nil(t, err)
+		require.Equal(t, claims[lcom.JWTClaimEmailKey], refreshedClaims[lcom.JWTClaimEmailKey])
+		require.NotEqual(t, accessClaims[lcom.JWTClaimIDKey], refreshedClaims[lcom.JWTClaimIDKey])
+	})
+	t.Run("verify reusing a refresh token revokes its family", func(t *testing.T) {
+		issuer := NewTokenIssuer(signer, NewMemoryRefreshStore())
+
+		firstPair, err := issuer.Issue(ctx, util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		otherPair, err := issuer.Issue(ctx, util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		secondPair, err := issuer.Refresh(ctx, firstPair.RefreshToken)
+		require.Nil(t, err)
+
+		_, err = issuer.Refresh(ctx, firstPair.RefreshToken)
+		require.True(t, errors.Is(err, lcom.ErrRefreshTokenReused))
+		require.True(t, errors.Is(err, lcom.ErrInvalidRefreshToken))
+
+		// the rotated refresh token belongs to the revoked family
+		_, err = issuer.Refresh(ctx, secondPair.RefreshToken)
+		require.True(t, errors.Is(err, lcom.ErrInvalidRefreshToken))
+		require.False(t, errors.Is(err, lcom.ErrRefreshTokenReused))
+
+		// other families are untouched
+		_, err = issuer.Refresh(ctx, otherPair.RefreshToken)
+		require.Nil(t, err)
+	})
+	t.Run("verify unknown and expired refresh tokens are rejected", func(t *testing.T) {
+		issuer := NewTokenIssuer(signer, NewMemoryRefreshStore())
+
+		_, err := issuer.Refresh(ctx, "unknown")
+		require.True(t, errors.Is(err, lcom.ErrInvalidRefreshToken))
+
+		tokenPair, err := issuer.Issue(ctx, util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		issuer.now = func() time.Time { return time.Now().Add(DefaultRefreshTokenTTL) }
+		_, err = issuer.Refresh(ctx, tokenPair.RefreshToken)
+		require.True(t, errors.Is(err, lcom.ErrInvalidRefreshToken))
+	})
+	t.Run("verify a nil signer signs with the env key material", func(t *testing.T) {
+		issuer := NewTokenIssuer(nil, NewMemoryRefreshStore())
+		issuer.AccessTTL = time.Minute
+
+		tokenPair, err := issuer.Issue(ctx, util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+		require.Equal(t, int64(60), tokenPair.ExpiresIn)
+
+		_, err = VerifyJWT(tokenPair.AccessToken)
+		require.Nil(t, err)
+	})
+}
@@ -0,0 +1,316 @@
+package ljwt
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"sync"
+	"time"
+)
+
+// DefaultRevocationStore is checked by every Verifier created without
+// WithRevocationStore, which includes VerifyJWT and the decode middleware.
+// Set it once during init; revocation checks are skipped while it is nil.
+var DefaultRevocationStore RevocationStore
+
+// RevocationStore keeps track of revoked JWTs. Entries only need to be kept
+// until the revoked JWTs expire, so implementations on top of DynamoDB or
+// Redis can use the expiresAt values as their TTL.
+type RevocationStore interface {
+	// RevokeID revokes the JWT with the "jti" jti until expiresAt.
+	RevokeID(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// RevokeSubject revokes every JWT of subject issued before
+	// issuedBefore or in the same second. The entry is kept until
+	// expiresAt. Revoking a subject again keeps the later issuedBefore.
+	RevokeSubject(ctx context.Context, subject string, issuedBefore, expiresAt time.Time) error
+
+	// IDRevoked reports whether the JWT with the "jti" jti is revoked.
+	IDRevoked(ctx context.Context, jti string) (bool, error)
+
+	// SubjectRevokedBefore returns the time before which the JWTs of subject
+	// are revoked or the zero time if none are.
+	SubjectRevokedBefore(ctx context.Context, subject string) (time.Time, error)
+}
+
+// RevokeJWT revokes the JWT of mapClaims by its "jti" until its "exp", for
+// example when the user logs out. A JWT without "exp" stays revoked forever.
+func RevokeJWT(ctx context.Context, store RevocationStore, mapClaims jwt.MapClaims) error {
+	jti, _ := mapClaims[lcom.JWTClaimIDKey].(string)
+	if jti == "" {
+		return util.WrapErrors(fmt.Errorf("the JWT has no %q claim to revoke it by", lcom.JWTClaimIDKey), lcom.ErrMissingClaim)
+	}
+
+	exp, ok, err := numericClaim(mapClaims, lcom.JWTClaimExpiresAtKey)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time
+	if ok {
+		expiresAt = time.Unix(exp, 0)
+	}
+
+	return store.RevokeID(ctx, jti, expiresAt)
+}
+
+// RevokeSubject revokes every JWT of subject issued before issuedBefore or in
+// the same second, for example to log a user out everywhere after a password
+// change. Pass the
+// longest lifetime of the JWTs you issue as maxTokenLifetime so the entry is
+// dropped once all of them expired.
+func RevokeSubject(ctx context.Context, store RevocationStore, subject string, issuedBefore time.Time, maxTokenLifetime time.Duration) error {
+	return store.RevokeSubject(ctx, subject, issuedBefore, issuedBefore.Add(maxTokenLifetime))
+}
+
+// checkRevoked returns lcom.ErrTokenRevoked if claims were revoked by their
+// "jti" or "sub". "iat" only has second precision, so a JWT issued in the
+// second of the revocation is revoked along with its subject, and so is a JWT
+// without "iat" since it can't prove it was issued afterwards.
+func (v *Verifier) checkRevoked(ctx context.Context, claims jwt.MapClaims) error {
+	store := v.opts.revocations
+	if store == nil {
+		store = DefaultRevocationStore
+	}
+	if store == nil {
+		return nil
+	}
+
+	if jti, _ := claims[lcom.JWTClaimIDKey].(string); jti != "" {
+		revoked, err := store.IDRevoked(ctx, jti)
+		if err != nil {
+			return util.WrapErrors(err, lcom.ErrRevocationCheck)
+		}
+		if revoked {
+			return util.WrapErrors(util.WrapErrors(fmt.Errorf("token %q was revoked", jti), lcom.ErrTokenRevoked), lcom.ErrInvalidJWT)
+		}
+	}
+
+	if sub, _ := claims[lcom.JWTClaimSubjectKey].(string); sub != "" {
+		revokedBefore, err := store.SubjectRevokedBefore(ctx, sub)
+		if err != nil {
+			return util.WrapErrors(err, lcom.ErrRevocationCheck)
+		}
+
+		iat, ok, _ := numericClaim(claims, lcom.JWTClaimIssuedAtKey)
+		if !revokedBefore.IsZero() && (!ok || iat <= revokedBefore.Unix()) {
+			return util.WrapErrors(util.WrapErrors(fmt.Errorf("tokens of %q issued before %s were revoked", sub, revokedBefore.UTC().Format(time.RFC3339)), lcom.ErrTokenRevoked), lcom.ErrInvalidJWT)
+		}
+	}
+
+	return nil
+}
+
+// noRevocationStore is a RevocationStore that never revokes anything. It
+// keeps a Verifier from falling back to DefaultRevocationStore.
+type noRevocationStore struct{}
+
+func (noRevocationStore) RevokeID(context.Context, string, time.Time) error { return nil }
+
+func (noRevocationStore) RevokeSubject(context.Context, string, time.Time, time.Time) error {
+	return nil
+}
+
+func (noRevocationStore) IDRevoked(context.Context, string) (bool, error) { return false, nil }
+
+func (noRevocationStore) SubjectRevokedBefore(context.Context, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+// MemoryRevocationStore is a RevocationStore that keeps revocations in
+// memory until the revoked JWTs expire. Every Lambda instance has its own
+// memory, so use it in tests, development servers or for revocations that
+// are loaded into every instance, and a shared store otherwise.
+type MemoryRevocationStore struct {
+	mu       sync.Mutex
+	ids      map[string]time.Time
+	subjects map[string]subjectRevocation
+	now      func() time.Time
+}
+
+type subjectRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// NewMemoryRevocationStore returns an empty MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		ids:      map[string]time.Time{},
+		subjects: map[string]subjectRevocation{},
+		now:      time.Now,
+	}
+}
+
+// RevokeID implements RevocationStore.
+func (s *MemoryRevocationStore) RevokeID(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	s.ids[jti] = expiresAt
+
+	return nil
+}
+
+// RevokeSubject implements RevocationStore.
+func (s *MemoryRevocationStore) RevokeSubject(ctx context.Context, subject string, issuedBefore, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	if existing, ok := s.subjects[subject]; ok && existing.issuedBefore.After(issuedBefore) {
+		return nil
+	}
+	s.subjects[subject] = subjectRevocation{issuedBefore: issuedBefore, expiresAt: expiresAt}
+
+	return nil
+}
+
+// IDRevoked implements RevocationStore.
+func (s *MemoryRevocationStore) IDRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.ids[jti]
+
+	return ok && !s.expired(expiresAt), nil
+}
+
+// SubjectRevokedBefore implements RevocationStore.
+func (s *MemoryRevocationStore) SubjectRevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revocation, ok := s.subjects[subject]
+	if !ok || s.expired(revocation.expiresAt) {
+		return time.Time{}, nil
+	}
+
+	return revocation.issuedBefore, nil
+}
+
+// prune drops the entries of JWTs that expired. s.mu must be held.
+func (s *MemoryRevocationStore) prune() {
+	for jti, expiresAt := range s.ids {
+		if s.expired(expiresAt) {
+			delete(s.ids, jti)
+		}
+	}
+
+	for subject, revocation := range s.subjects {
+		if s.expired(revocation.expiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
+
+// expired reports whether an entry kept until expiresAt can be dropped. The
+// zero time never expires.
+func (s *MemoryRevocationStore) expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && s.now().After(expiresAt)
+}
+
+// CachedRevocationStore caches the lookups of a shared RevocationStore for a
+// TTL so warm Lambdas don't query it for every request. A JWT revoked
+// through another instance is rejected at most TTL later; revocations made
+// through the CachedRevocationStore itself apply immediately.
+type CachedRevocationStore struct {
+	store    RevocationStore
+	ttl      time.Duration
+	mu       sync.Mutex
+	ids      map[string]cachedLookup[bool]
+	subjects map[string]cachedLookup[time.Time]
+	now      func() time.Time
+}
+
+type cachedLookup[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+// NewCachedRevocationStore returns a CachedRevocationStore that caches the
+// lookups of store for ttl.
+func NewCachedRevocationStore(store RevocationStore, ttl time.Duration) *CachedRevocationStore {
+	return &CachedRevocationStore{
+		store:    store,
+		ttl:      ttl,
+		ids:      map[string]cachedLookup[bool]{},
+		subjects: map[string]cachedLookup[time.Time]{},
+		now:      time.Now,
+	}
+}
+
+// RevokeID implements RevocationStore.
+func (s *CachedRevocationStore) RevokeID(ctx context.Context, jti string, expiresAt time.Time) error {
+	err := s.store.RevokeID(ctx, jti, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, jti)
+
+	return nil
+}
+
+// RevokeSubject implements RevocationStore.
+func (s *CachedRevocationStore) RevokeSubject(ctx context.Context, subject string, issuedBefore, expiresAt time.Time) error {
+	err := s.store.RevokeSubject(ctx, subject, issuedBefore, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subjects, subject)
+
+	return nil
+}
+
+// IDRevoked implements RevocationStore.
+func (s *CachedRevocationStore) IDRevoked(ctx context.Context, jti string) (bool, error) {
+	return cachedLookupOf(s, s.ids, jti, func() (bool, error) {
+		return s.store.IDRevoked(ctx, jti)
+	})
+}
+
+// SubjectRevokedBefore implements RevocationStore.
+func (s *CachedRevocationStore) SubjectRevokedBefore(ctx context.Context, subject string) (time.Time, error) {
+	return cachedLookupOf(s, s.subjects, subject, func() (time.Time, error) {
+		return s.store.SubjectRevokedBefore(ctx, subject)
+	})
+}
+
+// cachedLookupOf returns the cached value of key in cache or looks it up and
+// caches it for s.ttl. Errors aren't cached.
+func cachedLookupOf[T any](s *CachedRevocationStore, cache map[string]cachedLookup[T], key string, lookup func() (T, error)) (T, error) {
+	s.mu.Lock()
+	cached, ok := cache[key]
+	s.mu.Unlock()
+
+	now := s.now()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	value, err := lookup()
+	if err != nil {
+		return value, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cachedKey, entry := range cache {
+		if !now.Before(entry.expiresAt) {
+			delete(cache, cachedKey)
+		}
+	}
+	cache[key] = cachedLookup[T]{value: value, expiresAt: now.Add(s.ttl)}
+
+	return value, nil
+}
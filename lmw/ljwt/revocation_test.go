@@ -0,0 +1,180 @@
+package ljwt
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failingRevocationStore is a RevocationStore whose lookups always fail
+type failingRevocationStore struct {
+	*MemoryRevocationStore
+	lookups int
+}
+
+func (s *failingRevocationStore) IDRevoked(ctx context.Context, jti string) (bool, error) {
+	s.lookups++
+	return false, errors.New("store unavailable")
+}
+
+func TestRevocation(t *testing.T) {
+	secret := []byte("revocation secret")
+	ctx := context.Background()
+
+	signer, err := NewSigner(WithHMACSecret(secret))
+	require.Nil(t, err)
+
+	// signJWT signs claims with the given "iat" and returns the JWT and its claims
+	signJWT := func(t *testing.T, sub string, issuedAt time.Time) (string, jwt.MapClaims) {
+		claims := util.GenerateStandardMapClaims()
+		claims[lcom.JWTClaimSubjectKey] = sub
+		claims[lcom.JWTClaimIssuedAtKey] = issuedAt.Unix()
+		claims[lcom.JWTClaimNotBeforeKey] = issuedAt.Unix()
+
+		signedJWT, err := signer.Sign(claims)
+		require.Nil(t, err)
+
+		return signedJWT, claims
+	}
+
+	t.Run("verify a single JWT is revoked by its jti", func(t *testing.T) {
+		store := NewMemoryRevocationStore()
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithRevocationStore(store))
+		require.Nil(t, err)
+
+		revokedJWT, revokedClaims := signJWT(t, "user", time.Now())
+		otherJWT, _ := signJWT(t, "user", time.Now())
+
+		err = RevokeJWT(ctx, store, revokedClaims)
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, revokedJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenRevoked))
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+
+		_, err = verifier.Verify(ctx, otherJWT)
+		require.Nil(t, err)
+
+		delete(revokedClaims, lcom.JWTClaimIDKey)
+		err = RevokeJWT(ctx, store, revokedClaims)
+		require.True(t, errors.Is(err, lcom.ErrMissingClaim))
+	})
+	t.Run("verify every JWT of a subject issued before a time is revoked", func(t *testing.T) {
+		store := NewMemoryRevocationStore()
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithRevocationStore(store))
+		require.Nil(t, err)
+
+		logout := time.Now().Add(-time.Minute)
+		oldJWT, _ := signJWT(t, "user", logout.Add(-time.Minute))
+		sameSecondJWT, _ := signJWT(t, "user", logout)
+		newJWT, _ := signJWT(t, "user", logout.Add(time.Second))
+		otherJWT, _ := signJWT(t, "other user", logout.Add(-time.Minute))
+
+		err = RevokeSubject(ctx, store, "user", logout, time.Hour)
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, oldJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenRevoked))
+
+		// iat is truncated to the second, so it can't tell whether the JWT
+		// was issued before or after the revocation
+		_, err = verifier.Verify(ctx, sameSecondJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenRevoked))
+
+		_, err = verifier.Verify(ctx, newJWT)
+		require.Nil(t, err)
+
+		_, err = verifier.Verify(ctx, otherJWT)
+		require.Nil(t, err)
+
+		// an earlier revocation doesn't undo a later one
+		err = RevokeSubject(ctx, store, "user", logout.Add(-time.Hour), time.Hour)
+		require.Nil(t, err)
+		_, err = verifier.Verify(ctx, oldJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenRevoked))
+	})
+	t.Run("verify entries expire with the revoked JWTs", func(t *testing.T) {
+		store := NewMemoryRevocationStore()
+		now := time.Now()
+
+		err := store.RevokeID(ctx, "expiring", now.Add(time.Minute))
+		require.Nil(t, err)
+		err = store.RevokeID(ctx, "forever", time.Time{})
+		require.Nil(t, err)
+		err = store.RevokeSubject(ctx, "user", now, now.Add(time.Minute))
+		require.Nil(t, err)
+
+		store.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+		revoked, err := store.IDRevoked(ctx, "expiring")
+		require.Nil(t, err)
+		require.False(t, revoked)
+
+		revoked, err = store.IDRevoked(ctx, "forever")
+		require.Nil(t, err)
+		require.True(t, revoked)
+
+		revokedBefore, err := store.SubjectRevokedBefore(ctx, "user")
+		require.Nil(t, err)
+		require.True(t, revokedBefore.IsZero())
+
+		err = store.RevokeID(ctx, "other", time.Time{})
+		require.Nil(t, err)
+		require.Len(t, store.ids, 2)
+		require.Empty(t, store.subjects)
+	})
+	t.Run("verify cached lookups expire after the TTL", func(t *testing.T) {
+		shared := NewMemoryRevocationStore()
+		cached := NewCachedRevocationStore(shared, time.Minute)
+		now := time.Now()
+		cached.now = func() time.Time { return now }
+
+		revoked, err := cached.IDRevoked(ctx, "jti")
+		require.Nil(t, err)
+		require.False(t, revoked)
+
+		// revoked through another instance
+		err = shared.RevokeID(ctx, "jti", time.Time{})
+		require.Nil(t, err)
+
+		revoked, err = cached.IDRevoked(ctx, "jti")
+		require.Nil(t, err)
+		require.False(t, revoked)
+
+		cached.now = func() time.Time { return now.Add(2 * time.Minute) }
+		revoked, err = cached.IDRevoked(ctx, "jti")
+		require.Nil(t, err)
+		require.True(t, revoked)
+
+		// revoked through the cached store itself
+		err = cached.RevokeSubject(ctx, "user", now, time.Time{})
+		require.Nil(t, err)
+		revokedBefore, err := cached.SubjectRevokedBefore(ctx, "user")
+		require.Nil(t, err)
+		require.True(t, revokedBefore.Equal(now))
+	})
+	t.Run("verify failing lookups respond 500", func(t *testing.T) {
+		store := &failingRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore()}
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithRevocationStore(NewCachedRevocationStore(store, time.Minute)))
+		require.Nil(t, err)
+
+		signedJWT, _ := signJWT(t, "user", time.Now())
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+
+		for range 2 {
+			_, httpStatus, err := verifier.ExtractJWTFromRequest(ctx, req)
+			require.True(t, errors.Is(err, lcom.ErrRevocationCheck))
+			require.Equal(t, http.StatusInternalServerError, httpStatus)
+		}
+
+		// errors aren't cached
+		require.Equal(t, 2, store.lookups)
+	})
+}
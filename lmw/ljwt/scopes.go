@@ -0,0 +1,45 @@
+package ljwt
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"slices"
+	"strings"
+)
+
+// ParseScopes returns the OAuth 2.0 scopes of mapClaims. Both the
+// space-delimited "scope" claim of RFC 8693 and the "scp" claim used by
+// Okta and Azure AD, as an array or a space-delimited string, are read and
+// merged without duplicates.
+func ParseScopes(mapClaims jwt.MapClaims) []string {
+	var scopes []string
+	for _, key := range []string{lcom.JWTClaimScopeKey, lcom.JWTClaimScpKey} {
+		for _, scope := range scopeValues(mapClaims[key]) {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return scopes
+}
+
+// scopeValues returns the scopes of a "scope" or "scp" claim value.
+func scopeValues(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []string:
+		return value
+	case []any:
+		var scopes []string
+		for _, item := range value {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, strings.Fields(scope)...)
+			}
+		}
+		return scopes
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package ljwt
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	t.Run("verify scopes are parsed from scope and scp", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			claims   jwt.MapClaims
+			expected []string
+		}{
+			{name: "space delimited scope", claims: jwt.MapClaims{"scope": "books:read  books:write"}, expected: []string{"books:read", "books:write"}},
+			{name: "scp array", claims: jwt.MapClaims{"scp": []any{"books:read", "books:write"}}, expected: []string{"books:read", "books:write"}},
+			{name: "scp string", claims: jwt.MapClaims{"scp": "books:read"}, expected: []string{"books:read"}},
+			{name: "both without duplicates", claims: jwt.MapClaims{"scope": "books:read", "scp": []string{"books:read", "admin"}}, expected: []string{"books:read", "admin"}},
+			{name: "no scopes", claims: util.GenerateExpandedMapClaims(), expected: nil},
+			{name: "not a scope list", claims: jwt.MapClaims{"scope": 42}, expected: nil},
+		}
+
+		for _, tt := range tests {
+			require.Equal(t, tt.expected, ParseScopes(tt.claims), tt.name)
+		}
+	})
+	t.Run("verify scopes survive signing and verifying", func(t *testing.T) {
+		claims := util.GenerateStandardMapClaims()
+		claims["scp"] = []string{"books:read", "books:write"}
+
+		signedJWT, err := Sign(claims)
+		require.Nil(t, err)
+
+		retrievedClaims, err := VerifyJWT(signedJWT)
+		require.Nil(t, err)
+		require.Equal(t, []string{"books:read", "books:write"}, ParseScopes(retrievedClaims))
+	})
+}
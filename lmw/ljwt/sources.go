@@ -0,0 +1,195 @@
+package ljwt
+
+import (
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TokenSource returns the JWT a req carries in one particular place, such as
+// a header or a cookie. It returns an error if the req doesn't carry a JWT
+// there or carries a malformed one.
+type TokenSource func(req events.APIGatewayProxyRequest) (string, error)
+
+// FromAuthorizationHeader returns the JWT of an "Authorization: Bearer"
+// header. Both the header name and the "Bearer" scheme are matched
+// regardless of case since HTTP APIs and many proxies lowercase headers.
+func FromAuthorizationHeader() TokenSource {
+	return func(req events.APIGatewayProxyRequest) (string, error) {
+		authorizationHeader := headerValue(req, lcom.AuthorizationHeaderKey)
+		if authorizationHeader == "" {
+			return "", lcom.ErrNoAuthorizationHeader
+		}
+
+		scheme, token, _ := strings.Cut(strings.TrimSpace(authorizationHeader), " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return "", lcom.ErrNoBearerPrefix
+		}
+
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return "", util.WrapErrors(fmt.Errorf("empty bearer token"), lcom.ErrNoToken)
+		}
+
+		return token, nil
+	}
+}
+
+// FromHeader returns the JWT of the header name, which is matched regardless
+// of case. The header holds the JWT itself without a scheme.
+func FromHeader(name string) TokenSource {
+	return func(req events.APIGatewayProxyRequest) (string, error) {
+		token := strings.TrimSpace(headerValue(req, name))
+		if token == "" {
+			return "", util.WrapErrors(fmt.Errorf("no %s header", name), lcom.ErrNoToken)
+		}
+
+		return token, nil
+	}
+}
+
+// FromCookie returns the JWT of the cookie name. Use it for browser clients
+// that keep the JWT in an HttpOnly cookie.
+func FromCookie(name string) TokenSource {
+	return func(req events.APIGatewayProxyRequest) (string, error) {
+		for _, line := range headerValues(req, lcom.CookieHeaderKey) {
+			cookies, err := http.ParseCookie(line)
+			if err != nil {
+				continue
+			}
+
+			for _, cookie := range cookies {
+				if cookie.Name == name && cookie.Value != "" {
+					return cookie.Value, nil
+				}
+			}
+		}
+
+		return "", util.WrapErrors(fmt.Errorf("no %s cookie", name), lcom.ErrNoToken)
+	}
+}
+
+// FromQueryParam returns the JWT of the query parameter name. Use it for
+// WebSocket connections and download links, which can't set headers, and
+// keep the JWTs short lived since URLs end up in logs.
+func FromQueryParam(name string) TokenSource {
+	return func(req events.APIGatewayProxyRequest) (string, error) {
+		token := req.QueryStringParameters[name]
+		if token == "" && len(req.MultiValueQueryStringParameters[name]) > 0 {
+			token = req.MultiValueQueryStringParameters[name][0]
+		}
+
+		if token == "" {
+			return "", util.WrapErrors(fmt.Errorf("no %s query parameter", name), lcom.ErrNoToken)
+		}
+
+		return token, nil
+	}
+}
+
+// ExtractToken returns the JWT of the first of sources that finds one. If
+// none does the error of the first source is returned, so with the default
+// FromAuthorizationHeader a req without a JWT returns
+// lcom.ErrNoAuthorizationHeader. Without sources FromAuthorizationHeader is
+// used.
+func ExtractToken(req events.APIGatewayProxyRequest, sources ...TokenSource) (string, error) {
+	if len(sources) == 0 {
+		sources = []TokenSource{FromAuthorizationHeader()}
+	}
+
+	var firstErr error
+	for _, source := range sources {
+		token, err := source(req)
+		if err == nil {
+			return token, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return "", firstErr
+}
+
+// ParseTokenSources parses a comma separated list of token sources such as
+// the value of LAMBDA_JWT_ROUTER_TOKEN_SOURCES. Each source is
+// "authorization", "header:<name>", "cookie:<name>" or "query:<name>":
+//
+//	authorization, cookie:session, query:access_token
+func ParseTokenSources(value string) ([]TokenSource, error) {
+	var sources []TokenSource
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		kind, name, _ := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "authorization":
+			sources = append(sources, FromAuthorizationHeader())
+			continue
+		case "header":
+			if name != "" {
+				sources = append(sources, FromHeader(name))
+				continue
+			}
+		case "cookie":
+			if name != "" {
+				sources = append(sources, FromCookie(name))
+				continue
+			}
+		case "query":
+			if name != "" {
+				sources = append(sources, FromQueryParam(name))
+				continue
+			}
+		}
+
+		return nil, util.WrapErrors(fmt.Errorf("unknown token source %q", spec), lcom.ErrInvalidTokenSource)
+	}
+
+	return sources, nil
+}
+
+// envTokenSources returns the sources of LAMBDA_JWT_ROUTER_TOKEN_SOURCES or
+// nil if it isn't set.
+func envTokenSources() ([]TokenSource, error) {
+	return ParseTokenSources(os.Getenv(lcom.TokenSourcesEnvKey))
+}
+
+// headerValue returns the first value of the header name regardless of the
+// case of its key.
+func headerValue(req events.APIGatewayProxyRequest, name string) string {
+	values := headerValues(req, name)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// headerValues returns the values of the header name regardless of the case
+// of its key, preferring the single value headers.
+func headerValues(req events.APIGatewayProxyRequest, name string) []string {
+	for key, value := range req.Headers {
+		if strings.EqualFold(key, name) {
+			return []string{value}
+		}
+	}
+
+	for key, values := range req.MultiValueHeaders {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+
+	return nil
+}
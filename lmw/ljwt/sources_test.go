@@ -0,0 +1,146 @@
+package ljwt
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestTokenSources(t *testing.T) {
+	t.Run("verify each source finds its token", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			source TokenSource
+			req    events.APIGatewayProxyRequest
+		}{
+			{
+				name:   "lowercase authorization header",
+				source: FromAuthorizationHeader(),
+				req:    events.APIGatewayProxyRequest{Headers: map[string]string{"authorization": "bearer   token "}},
+			},
+			{
+				name:   "multi value authorization header",
+				source: FromAuthorizationHeader(),
+				req:    events.APIGatewayProxyRequest{MultiValueHeaders: map[string][]string{"Authorization": {"Bearer token"}}},
+			},
+			{
+				name:   "custom header",
+				source: FromHeader("X-Access-Token"),
+				req:    events.APIGatewayProxyRequest{Headers: map[string]string{"x-access-token": "token"}},
+			},
+			{
+				name:   "cookie",
+				source: FromCookie("session"),
+				req:    events.APIGatewayProxyRequest{Headers: map[string]string{"cookie": "theme=dark; session=token"}},
+			},
+			{
+				name:   "query param",
+				source: FromQueryParam("access_token"),
+				req:    events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"access_token": "token"}},
+			},
+		}
+
+		for _, tt := range tests {
+			token, err := tt.source(tt.req)
+			require.Nil(t, err, tt.name)
+			require.Equal(t, "token", token, tt.name)
+		}
+	})
+	t.Run("verify missing tokens return ErrNoToken", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Cookie": "theme=dark"}}
+
+		for _, source := range []TokenSource{FromHeader("X-Access-Token"), FromCookie("session"), FromQueryParam("access_token")} {
+			_, err := source(req)
+			require.True(t, errors.Is(err, lcom.ErrNoToken))
+		}
+
+		_, err := FromAuthorizationHeader()(events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer "}})
+		require.True(t, errors.Is(err, lcom.ErrNoToken))
+	})
+	t.Run("verify the first source with a token wins", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			Headers:               map[string]string{"Authorization": "Basic dXNlcjpwYXNz", "Cookie": "session=cookie-token"},
+			QueryStringParameters: map[string]string{"access_token": "query-token"},
+		}
+
+		token, err := ExtractToken(req, FromAuthorizationHeader(), FromCookie("session"), FromQueryParam("access_token"))
+		require.Nil(t, err)
+		require.Equal(t, "cookie-token", token)
+
+		token, err = ExtractToken(req, FromQueryParam("access_token"), FromCookie("session"))
+		require.Nil(t, err)
+		require.Equal(t, "query-token", token)
+
+		// the error of the first source is returned when none has a token
+		_, err = ExtractToken(req, FromAuthorizationHeader(), FromHeader("X-Access-Token"))
+		require.True(t, errors.Is(err, lcom.ErrNoBearerPrefix))
+
+		_, err = ExtractToken(events.APIGatewayProxyRequest{})
+		require.True(t, errors.Is(err, lcom.ErrNoAuthorizationHeader))
+	})
+	t.Run("verify token sources are parsed", func(t *testing.T) {
+		sources, err := ParseTokenSources("authorization, Cookie:session,header:X-Access-Token, query:access_token")
+		require.Nil(t, err)
+		require.Len(t, sources, 4)
+
+		sources, err = ParseTokenSources("")
+		require.Nil(t, err)
+		require.Empty(t, sources)
+
+		for _, value := range []string{"cookie", "query:", "body:token"} {
+			_, err = ParseTokenSources(value)
+			require.True(t, errors.Is(err, lcom.ErrInvalidTokenSource), value)
+		}
+	})
+}
+
+func TestExtractJWTFromRequest(t *testing.T) {
+	signedJWT, err := Sign(util.GenerateStandardMapClaims())
+	require.Nil(t, err)
+
+	cookieReq := events.APIGatewayProxyRequest{Headers: map[string]string{"Cookie": "session=" + signedJWT}}
+
+	t.Run("verify the env token sources are used", func(t *testing.T) {
+		_, httpStatus, err := ExtractJWTFromRequest(cookieReq)
+		require.True(t, errors.Is(err, lcom.ErrNoAuthorizationHeader))
+		require.Equal(t, http.StatusBadRequest, httpStatus)
+
+		t.Setenv(lcom.TokenSourcesEnvKey, "authorization,cookie:session")
+		mapClaims, httpStatus, err := ExtractJWTFromRequest(cookieReq)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Len(t, mapClaims, 7)
+
+		t.Setenv(lcom.TokenSourcesEnvKey, "body:token")
+		_, httpStatus, err = ExtractJWTFromRequest(cookieReq)
+		require.True(t, errors.Is(err, lcom.ErrInvalidTokenSource))
+		require.Equal(t, http.StatusInternalServerError, httpStatus)
+	})
+	t.Run("verify the verifier token sources are used", func(t *testing.T) {
+		secret := []byte("token sources secret")
+
+		signer, err := NewSigner(WithHMACSecret(secret))
+		require.Nil(t, err)
+
+		signedJWT, err := signer.Sign(util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithTokenSources(FromQueryParam("access_token")))
+		require.Nil(t, err)
+
+		_, httpStatus, err := verifier.ExtractJWT(context.Background(), map[string]string{"Authorization": "Bearer " + signedJWT})
+		require.True(t, errors.Is(err, lcom.ErrNoToken))
+		require.Equal(t, http.StatusBadRequest, httpStatus)
+
+		_, httpStatus, err = verifier.ExtractJWTFromRequest(context.Background(), events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"access_token": signedJWT},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+	})
+}
@@ -0,0 +1,670 @@
+package ljwt
+
+import (
+	"context"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option configures a Signer or a Verifier. Options that only apply to one
+// of them, such as WithLeeway for a Signer, are ignored by the other.
+type Option func(*options)
+
+type options struct {
+	algorithms      []string
+	audience        []string
+	issuer          string
+	jwks            *JWKS
+	keyID           string
+	keyring         *HMACKeyring
+	leeway          time.Duration
+	now             func() time.Time
+	requiredClaims  []string
+	revocations     RevocationStore
+	signingKey      any
+	tokenSources    []TokenSource
+	verificationKey any
+}
+
+// WithHMACSecret signs and verifies JWTs with an HMAC secret. The Signer
+// uses HS512 unless WithAlgorithms says otherwise, the Verifier accepts
+// HS256, HS384 and HS512.
+func WithHMACSecret(secret []byte) Option {
+	return func(o *options) {
+		o.signingKey = secret
+		o.verificationKey = secret
+	}
+}
+
+// WithPrivateKey signs JWTs with an *rsa.PrivateKey, *ecdsa.PrivateKey or
+// ed25519.PrivateKey, see ParsePrivateKeyPEM. A Verifier uses its public key.
+func WithPrivateKey(key crypto.Signer) Option {
+	return func(o *options) {
+		o.signingKey = key
+		o.verificationKey = key.Public()
+	}
+}
+
+// WithPublicKey verifies JWTs with an *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey, see ParsePublicKeyPEM.
+func WithPublicKey(key crypto.PublicKey) Option {
+	return func(o *options) {
+		o.verificationKey = key
+	}
+}
+
+// WithHMACKeyring signs and verifies JWTs with the keys of keyring, see
+// HMACKeyring. The kid of the signing key replaces WithKeyID.
+func WithHMACKeyring(keyring *HMACKeyring) Option {
+	return func(o *options) {
+		o.keyring = keyring
+	}
+}
+
+// WithJWKS verifies JWTs with the keys of a JWKS document, see JWKS. It
+// takes precedence over any other key.
+func WithJWKS(jwks *JWKS) Option {
+	return func(o *options) {
+		o.jwks = jwks
+	}
+}
+
+// WithKeyID stamps kid into the header of every JWT the Signer signs.
+func WithKeyID(kid string) Option {
+	return func(o *options) {
+		o.keyID = kid
+	}
+}
+
+// WithAlgorithms pins the algorithms a Verifier accepts. A Signer signs with
+// the first one. Without it the defaults for the key are used, see
+// SignWithKey.
+func WithAlgorithms(algorithms ...string) Option {
+	return func(o *options) {
+		o.algorithms = algorithms
+	}
+}
+
+// WithIssuer makes the Verifier require an "iss" claim equal to issuer. The
+// Signer sets "iss" to issuer if the claims don't have one.
+func WithIssuer(issuer string) Option {
+	return func(o *options) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience makes the Verifier require an "aud" claim containing at least
+// one of audience. The Signer sets "aud" to audience if the claims don't
+// have one.
+func WithAudience(audience ...string) Option {
+	return func(o *options) {
+		o.audience = audience
+	}
+}
+
+// WithLeeway allows for clock skew between the issuer and the Verifier when
+// checking the "exp", "nbf" and "iat" claims.
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *options) {
+		o.leeway = leeway
+	}
+}
+
+// WithRequiredClaims makes the Verifier reject JWTs, and the Signer refuse
+// to sign claims, that are missing any of claims.
+func WithRequiredClaims(claims ...string) Option {
+	return func(o *options) {
+		o.requiredClaims = claims
+	}
+}
+
+// WithClock replaces time.Now as the Verifier's source of the current time.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithTokenSources makes the Verifier look for the JWT of a req in sources,
+// in order, instead of only the "Authorization: Bearer" header.
+func WithTokenSources(sources ...TokenSource) Option {
+	return func(o *options) {
+		o.tokenSources = sources
+	}
+}
+
+// WithRevocationStore makes the Verifier reject JWTs revoked in store, see
+// RevokeJWT and RevokeSubject. Without it DefaultRevocationStore is used.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(o *options) {
+		o.revocations = store
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Signer signs JWTs with the key material and claims it was created with.
+// Create one with NewSigner and reuse it across invocations.
+type Signer struct {
+	opts   options
+	method jwt.SigningMethod
+}
+
+// NewSigner returns a Signer for the given options. One of WithHMACSecret,
+// WithHMACKeyring and WithPrivateKey is required:
+//
+//	signer, err := ljwt.NewSigner(
+//	    ljwt.WithPrivateKey(privateKey),
+//	    ljwt.WithKeyID("2024-01"),
+//	    ljwt.WithIssuer("https://auth.example.com"),
+//	)
+func NewSigner(opts ...Option) (*Signer, error) {
+	o := newOptions(opts)
+	if o.signingKey == nil && o.keyring == nil {
+		return nil, lcom.ErrNoSigningKey
+	}
+
+	allowed := algorithmsForKey(o.signingKey)
+	if o.keyring != nil {
+		allowed = hmacAlgorithms
+	}
+
+	if allowed == nil {
+		return nil, util.WrapErrors(fmt.Errorf("unsupported signing key type %T", o.signingKey), lcom.ErrInvalidKey)
+	}
+
+	var algorithm string
+	switch {
+	case len(o.algorithms) > 0:
+		algorithm = o.algorithms[0]
+	case slices.Equal(allowed, hmacAlgorithms):
+		algorithm = jwt.SigningMethodHS512.Alg()
+	default:
+		algorithm = allowed[0]
+	}
+
+	if !slices.Contains(allowed, algorithm) {
+		return nil, util.WrapErrors(fmt.Errorf("algorithm %q can't be used with a %T", algorithm, o.signingKey), lcom.ErrUnsupportedSigningMethod)
+	}
+
+	return &Signer{opts: o, method: jwt.GetSigningMethod(algorithm)}, nil
+}
+
+// Sign signs a copy of mapClaims, adding the configured issuer and audience
+// if they are missing, and returns the encoded JWT.
+func (s *Signer) Sign(mapClaims jwt.MapClaims) (string, error) {
+	claims := maps.Clone(mapClaims)
+	if claims == nil {
+		claims = jwt.MapClaims{}
+	}
+
+	if _, ok := claims[lcom.JWTClaimIssuerKey]; !ok && s.opts.issuer != "" {
+		claims[lcom.JWTClaimIssuerKey] = s.opts.issuer
+	}
+
+	if _, ok := claims[lcom.JWTClaimAudienceKey]; !ok && len(s.opts.audience) > 0 {
+		if len(s.opts.audience) == 1 {
+			claims[lcom.JWTClaimAudienceKey] = s.opts.audience[0]
+		} else {
+			claims[lcom.JWTClaimAudienceKey] = s.opts.audience
+		}
+	}
+
+	err := s.opts.checkRequired(claims)
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrUnableToSignToken)
+	}
+
+	key, kid := s.opts.signingKey, s.opts.keyID
+	if s.opts.keyring != nil {
+		hmacKey, keyErr := s.opts.keyring.signingKey(s.opts.now())
+		if keyErr != nil {
+			return "", keyErr
+		}
+		key, kid = hmacKey.Secret, hmacKey.ID
+	}
+
+	token := jwt.NewWithClaims(s.method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	encodedToken, err := token.SignedString(key)
+	if err != nil {
+		return "", util.WrapErrors(err, lcom.ErrUnableToSignToken)
+	}
+
+	return encodedToken, nil
+}
+
+// Verifier verifies JWTs and their claims with the key material and rules it
+// was created with. Create one with NewVerifier, reuse it across invocations
+// and pass it to lmw.NewDecodeStandardMW or lmw.NewDecodeExpandedMW.
+type Verifier struct {
+	opts options
+}
+
+// NewVerifier returns a Verifier for the given options. One of
+// WithHMACSecret, WithHMACKeyring, WithPrivateKey, WithPublicKey and WithJWKS
+// is required:
+//
+//	verifier, err := ljwt.NewVerifier(
+//	    ljwt.WithPublicKey(publicKey),
+//	    ljwt.WithIssuer("https://auth.example.com"),
+//	    ljwt.WithAudience("books-api"),
+//	    ljwt.WithLeeway(30*time.Second),
+//	)
+func NewVerifier(opts ...Option) (*Verifier, error) {
+	o := newOptions(opts)
+	if o.jwks == nil && o.keyring == nil {
+		if o.verificationKey == nil {
+			return nil, lcom.ErrNoVerificationKey
+		}
+
+		if algorithmsForKey(o.verificationKey) == nil {
+			return nil, util.WrapErrors(fmt.Errorf("unsupported verification key type %T", o.verificationKey), lcom.ErrInvalidKey)
+		}
+	}
+
+	return &Verifier{opts: o}, nil
+}
+
+// Verify verifies the signature of userJWT and its "exp", "nbf" and "iat"
+// claims as well as the configured issuer, audience and required claims,
+// checks that it wasn't revoked and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, userJWT string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods:         v.algorithms(),
+		SkipClaimsValidation: true,
+	}
+
+	token, err := parser.Parse(userJWT, func(token *jwt.Token) (interface{}, error) {
+		if v.opts.jwks != nil {
+			return v.opts.jwks.keyFor(ctx, token)
+		}
+
+		if v.opts.keyring != nil {
+			return v.keyringKeyFor(token)
+		}
+
+		if !slices.Contains(algorithmsForKey(v.opts.verificationKey), token.Method.Alg()) {
+			return nil, lcom.ErrUnsupportedSigningMethod
+		}
+
+		return v.opts.verificationKey, nil
+	})
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidJWT)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, lcom.ErrInvalidTokenClaims
+	}
+
+	err = v.VerifyClaims(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// VerifyClaims runs every check of Verify but the signature on claims that
+// were verified elsewhere, such as by a Lambda authorizer: the "exp", "nbf"
+// and "iat" claims, the configured issuer, audience and required claims and
+// revocation.
+func (v *Verifier) VerifyClaims(ctx context.Context, claims jwt.MapClaims) error {
+	err := v.validate(claims)
+	if err != nil {
+		return util.WrapErrors(err, lcom.ErrInvalidJWT)
+	}
+
+	return v.checkRevoked(ctx, claims)
+}
+
+// ExtractJWT works like the package level ExtractJWT but verifies the JWT
+// with the Verifier.
+func (v *Verifier) ExtractJWT(ctx context.Context, headers map[string]string) (jwt.MapClaims, int, error) {
+	return v.ExtractJWTFromRequest(ctx, events.APIGatewayProxyRequest{Headers: headers})
+}
+
+// ExtractJWTFromRequest works like the package level ExtractJWTFromRequest
+// but looks for the JWT in the sources of WithTokenSources and verifies it
+// with the Verifier.
+func (v *Verifier) ExtractJWTFromRequest(ctx context.Context, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+	userJWT, err := ExtractToken(req, v.opts.tokenSources...)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	mapClaims, err := v.Verify(ctx, userJWT)
+	if errors.Is(err, lcom.ErrRevocationCheck) {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err != nil {
+		return nil, http.StatusUnauthorized, util.WrapErrors(err, lcom.ErrVerifyJWT)
+	}
+
+	return mapClaims, http.StatusOK, nil
+}
+
+// algorithms returns the algorithms the Verifier accepts. With a JWKS and
+// no pinned algorithms every algorithm that fits the key is accepted.
+func (v *Verifier) algorithms() []string {
+	if len(v.opts.algorithms) > 0 {
+		return v.opts.algorithms
+	}
+
+	if v.opts.jwks != nil {
+		return nil
+	}
+
+	if v.opts.keyring != nil {
+		return hmacAlgorithms
+	}
+
+	allowed := algorithmsForKey(v.opts.verificationKey)
+	if slices.Equal(allowed, hmacAlgorithms) {
+		return allowed
+	}
+
+	return allowed[:1]
+}
+
+// keyringKeyFor returns the keyring secret matching the kid of token.
+func (v *Verifier) keyringKeyFor(token *jwt.Token) (interface{}, error) {
+	if !slices.Contains(hmacAlgorithms, token.Method.Alg()) {
+		return nil, lcom.ErrUnsupportedSigningMethod
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := v.opts.keyring.verificationKey(kid, v.opts.now())
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Secret, nil
+}
+
+// validate checks the time based claims with the configured leeway, and the
+// configured issuer, audience and required claims.
+func (v *Verifier) validate(claims jwt.MapClaims) error {
+	now := v.opts.now()
+
+	exp, ok, err := numericClaim(claims, lcom.JWTClaimExpiresAtKey)
+	if err != nil {
+		return err
+	}
+	if ok && now.After(time.Unix(exp, 0).Add(v.opts.leeway)) {
+		return util.WrapErrors(fmt.Errorf("token expired at %s", time.Unix(exp, 0).UTC().Format(time.RFC3339)), lcom.ErrTokenExpired)
+	}
+
+	nbf, ok, err := numericClaim(claims, lcom.JWTClaimNotBeforeKey)
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.opts.leeway).Before(time.Unix(nbf, 0)) {
+		return util.WrapErrors(fmt.Errorf("token is valid from %s", time.Unix(nbf, 0).UTC().Format(time.RFC3339)), lcom.ErrTokenNotValidYet)
+	}
+
+	iat, ok, err := numericClaim(claims, lcom.JWTClaimIssuedAtKey)
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.opts.leeway).Before(time.Unix(iat, 0)) {
+		return util.WrapErrors(fmt.Errorf("token issued at %s", time.Unix(iat, 0).UTC().Format(time.RFC3339)), lcom.ErrTokenIssuedInFuture)
+	}
+
+	if v.opts.issuer != "" {
+		iss, _ := claims[lcom.JWTClaimIssuerKey].(string)
+		if iss != v.opts.issuer {
+			return util.WrapErrors(fmt.Errorf("token issuer %q is not %q", iss, v.opts.issuer), lcom.ErrInvalidIssuer)
+		}
+	}
+
+	if len(v.opts.audience) > 0 {
+		if !slices.ContainsFunc(ParseAudience(claims), func(aud string) bool {
+			return slices.Contains(v.opts.audience, aud)
+		}) {
+			return util.WrapErrors(fmt.Errorf("token audience is not one of %s", strings.Join(v.opts.audience, ", ")), lcom.ErrInvalidAudience)
+		}
+	}
+
+	return v.opts.checkRequired(claims)
+}
+
+// checkRequired returns an error if claims is missing a required claim.
+func (o options) checkRequired(claims jwt.MapClaims) error {
+	for _, claim := range o.requiredClaims {
+		if value, ok := claims[claim]; !ok || value == nil || value == "" {
+			return util.WrapErrors(fmt.Errorf("token is missing the required claim %q", claim), lcom.ErrMissingClaim)
+		}
+	}
+
+	return nil
+}
+
+// numericClaim returns the claim key as Unix seconds and whether it was set.
+func numericClaim(claims jwt.MapClaims, key string) (int64, bool, error) {
+	switch value := claims[key].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return int64(value), true, nil
+	case int64:
+		return value, true, nil
+	case int:
+		return int64(value), true, nil
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return 0, false, util.WrapErrors(fmt.Errorf("claim %q is not a number", key), lcom.ErrInvalidTokenClaims)
+		}
+		return int64(number), true, nil
+	}
+
+	return 0, false, util.WrapErrors(fmt.Errorf("claim %q is not a number", key), lcom.ErrInvalidTokenClaims)
+}
+
+// ParseAudience returns the audiences of the "aud" claim of claims, which
+// may be a string or a list of strings.
+func ParseAudience(claims jwt.MapClaims) []string {
+	switch aud := claims[lcom.JWTClaimAudienceKey].(type) {
+	case string:
+		return []string{aud}
+	case []string:
+		return aud
+	case []interface{}:
+		audience := make([]string, 0, len(aud))
+		for _, value := range aud {
+			if str, ok := value.(string); ok {
+				audience = append(audience, str)
+			}
+		}
+		return audience
+	}
+
+	return nil
+}
+
+// envSigners and envVerifiers cache the Signer and Verifier built from each
+// set of environment variable values so keys are only parsed once
+var envSigners, envVerifiers sync.Map
+
+// signerFromEnv returns the Signer described by LAMBDA_JWT_ROUTER_PRIVATE_KEY,
+// LAMBDA_JWT_ROUTER_HMAC_KEYRING or LAMBDA_JWT_ROUTER_HMAC_SECRET and
+// LAMBDA_JWT_ROUTER_JWT_ALGORITHMS.
+func signerFromEnv() (*Signer, error) {
+	cacheKey := envCacheKey(lcom.PrivateKeyEnvKey, lcom.HMACKeyringEnvKey, lcom.HMACSecretEnvKey, lcom.JWTAlgorithmsEnvKey)
+	if cached, ok := envSigners.Load(cacheKey); ok {
+		return cached.(*Signer), nil
+	}
+
+	var opts []Option
+	if algorithms := envList(lcom.JWTAlgorithmsEnvKey); len(algorithms) > 0 {
+		opts = append(opts, WithAlgorithms(algorithms[0]))
+	}
+
+	if os.Getenv(lcom.PrivateKeyEnvKey) != "" {
+		key, err := ParsePrivateKeyPEM(envPEM(lcom.PrivateKeyEnvKey))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPrivateKey(key))
+	} else {
+		opt, err := hmacOptionFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+
+	signer, err := NewSigner(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	envSigners.Store(cacheKey, signer)
+
+	return signer, nil
+}
+
+// verifierFromEnv returns the Verifier described by
+// LAMBDA_JWT_ROUTER_JWKS_URL, LAMBDA_JWT_ROUTER_PUBLIC_KEY,
+// LAMBDA_JWT_ROUTER_HMAC_KEYRING or LAMBDA_JWT_ROUTER_HMAC_SECRET and the
+// claim options of envClaimOptions.
+func verifierFromEnv() (*Verifier, error) {
+	cacheKey := envCacheKey(
+		lcom.JWKSURLEnvKey,
+		lcom.PublicKeyEnvKey,
+		lcom.HMACKeyringEnvKey,
+		lcom.HMACSecretEnvKey,
+		lcom.JWTAlgorithmsEnvKey,
+		lcom.JWTAudienceEnvKey,
+		lcom.JWTIssuerEnvKey,
+		lcom.JWTLeewayEnvKey,
+		lcom.JWTRequiredClaimsEnvKey,
+	)
+	if cached, ok := envVerifiers.Load(cacheKey); ok {
+		return cached.(*Verifier), nil
+	}
+
+	opts, err := envClaimOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	if jwksURL := os.Getenv(lcom.JWKSURLEnvKey); jwksURL != "" {
+		opts = append(opts, WithJWKS(NewJWKS(jwksURL)))
+	} else if os.Getenv(lcom.PublicKeyEnvKey) != "" {
+		key, err := ParsePublicKeyPEM(envPEM(lcom.PublicKeyEnvKey))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPublicKey(key))
+	} else {
+		opt, err := hmacOptionFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+
+	verifier, err := NewVerifier(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, _ := envVerifiers.LoadOrStore(cacheKey, verifier)
+
+	return cached.(*Verifier), nil
+}
+
+// envClaimOptions returns the options for LAMBDA_JWT_ROUTER_JWT_ALGORITHMS,
+// LAMBDA_JWT_ROUTER_JWT_ISSUER, LAMBDA_JWT_ROUTER_JWT_AUDIENCE,
+// LAMBDA_JWT_ROUTER_JWT_LEEWAY and LAMBDA_JWT_ROUTER_JWT_REQUIRED_CLAIMS.
+// Lists are comma separated and the leeway is a time.Duration such as "30s".
+func envClaimOptions() ([]Option, error) {
+	opts := []Option{
+		WithAlgorithms(envList(lcom.JWTAlgorithmsEnvKey)...),
+		WithAudience(envList(lcom.JWTAudienceEnvKey)...),
+		WithIssuer(os.Getenv(lcom.JWTIssuerEnvKey)),
+		WithRequiredClaims(envList(lcom.JWTRequiredClaimsEnvKey)...),
+	}
+
+	if leeway := os.Getenv(lcom.JWTLeewayEnvKey); leeway != "" {
+		duration, err := time.ParseDuration(leeway)
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrInvalidLeeway)
+		}
+		opts = append(opts, WithLeeway(duration))
+	}
+
+	return opts, nil
+}
+
+// hmacOptionFromEnv returns WithHMACKeyring for LAMBDA_JWT_ROUTER_HMAC_KEYRING
+// if it is set and WithHMACSecret for LAMBDA_JWT_ROUTER_HMAC_SECRET otherwise.
+func hmacOptionFromEnv() (Option, error) {
+	if keyringJSON := os.Getenv(lcom.HMACKeyringEnvKey); keyringJSON != "" {
+		keyring, err := ParseHMACKeyring([]byte(keyringJSON))
+		if err != nil {
+			return nil, err
+		}
+		return WithHMACKeyring(keyring), nil
+	}
+
+	secret, err := hmacSecretFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return WithHMACSecret(secret), nil
+}
+
+// hmacSecretFromEnv hex decodes LAMBDA_JWT_ROUTER_HMAC_SECRET.
+func hmacSecretFromEnv() ([]byte, error) {
+	secret := os.Getenv(lcom.HMACSecretEnvKey)
+	if secret == "" {
+		return nil, util.WrapErrors(fmt.Errorf("%s is not set", lcom.HMACSecretEnvKey), lcom.ErrInvalidHMACSecret)
+	}
+
+	data, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidHMACSecret)
+	}
+
+	return data, nil
+}
+
+func envCacheKey(keys ...string) string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = os.Getenv(key)
+	}
+
+	return strings.Join(values, "\x00")
+}
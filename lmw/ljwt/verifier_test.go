@@ -0,0 +1,227 @@
+package ljwt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSignerAndVerifier(t *testing.T) {
+	secret := []byte("signer and verifier secret")
+	ctx := context.Background()
+
+	t.Run("verify a key is required", func(t *testing.T) {
+		_, err := NewSigner(WithIssuer("issuer"))
+		require.True(t, errors.Is(err, lcom.ErrNoSigningKey))
+
+		_, err = NewVerifier(WithIssuer("issuer"))
+		require.True(t, errors.Is(err, lcom.ErrNoVerificationKey))
+
+		_, err = NewSigner(WithHMACSecret(secret), WithAlgorithms("RS256"))
+		require.True(t, errors.Is(err, lcom.ErrUnsupportedSigningMethod))
+	})
+	t.Run("verify the signer stamps the kid, issuer and audience", func(t *testing.T) {
+		signer, err := NewSigner(WithHMACSecret(secret), WithKeyID("2024-01"), WithIssuer("issuer"), WithAudience("books"))
+		require.Nil(t, err)
+
+		claims := util.GenerateStandardMapClaims()
+		delete(claims, lcom.JWTClaimIssuerKey)
+		delete(claims, lcom.JWTClaimAudienceKey)
+
+		signedJWT, err := signer.Sign(claims)
+		require.Nil(t, err)
+		require.NotContains(t, claims, lcom.JWTClaimIssuerKey)
+
+		token, _, err := new(jwt.Parser).ParseUnverified(signedJWT, jwt.MapClaims{})
+		require.Nil(t, err)
+		require.Equal(t, "HS512", token.Method.Alg())
+		require.Equal(t, "2024-01", token.Header["kid"])
+
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithIssuer("issuer"), WithAudience("movies", "books"))
+		require.Nil(t, err)
+
+		retrievedClaims, err := verifier.Verify(ctx, signedJWT)
+		require.Nil(t, err)
+		require.Equal(t, "issuer", retrievedClaims[lcom.JWTClaimIssuerKey])
+		require.Equal(t, "books", retrievedClaims[lcom.JWTClaimAudienceKey])
+	})
+	t.Run("verify the issuer, audience and required claims are checked", func(t *testing.T) {
+		signer, err := NewSigner(WithHMACSecret(secret))
+		require.Nil(t, err)
+
+		signedJWT, err := signer.Sign(util.GenerateStandardMapClaims())
+		require.Nil(t, err)
+
+		tests := []struct {
+			opt         Option
+			expectedErr error
+		}{
+			{opt: WithIssuer("issuer"), expectedErr: lcom.ErrInvalidIssuer},
+			{opt: WithAudience("books"), expectedErr: lcom.ErrInvalidAudience},
+			{opt: WithRequiredClaims(lcom.JWTClaimEmailKey), expectedErr: lcom.ErrMissingClaim},
+		}
+
+		for _, tt := range tests {
+			verifier, err := NewVerifier(WithHMACSecret(secret), tt.opt)
+			require.Nil(t, err)
+
+			_, err = verifier.Verify(ctx, signedJWT)
+			require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+			require.True(t, errors.Is(err, tt.expectedErr), err)
+		}
+	})
+	t.Run("verify the leeway allows for clock skew", func(t *testing.T) {
+		signer, err := NewSigner(WithHMACSecret(secret))
+		require.Nil(t, err)
+
+		now := time.Now()
+		claims := util.GenerateStandardMapClaims()
+		claims[lcom.JWTClaimExpiresAtKey] = now.Add(-10 * time.Second).Unix()
+		claims[lcom.JWTClaimIssuedAtKey] = now.Add(-time.Minute).Unix()
+		claims[lcom.JWTClaimNotBeforeKey] = now.Add(-time.Minute).Unix()
+
+		signedJWT, err := signer.Sign(claims)
+		require.Nil(t, err)
+
+		strict, err := NewVerifier(WithHMACSecret(secret), WithClock(func() time.Time { return now }))
+		require.Nil(t, err)
+		_, err = strict.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenExpired))
+
+		lenient, err := NewVerifier(WithHMACSecret(secret), WithClock(func() time.Time { return now }), WithLeeway(30*time.Second))
+		require.Nil(t, err)
+		_, err = lenient.Verify(ctx, signedJWT)
+		require.Nil(t, err)
+
+		// a JWT issued in the future is only accepted within the leeway
+		claims[lcom.JWTClaimExpiresAtKey] = now.Add(time.Hour).Unix()
+		claims[lcom.JWTClaimIssuedAtKey] = now.Add(time.Minute).Unix()
+		signedJWT, err = signer.Sign(claims)
+		require.Nil(t, err)
+		_, err = lenient.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenIssuedInFuture))
+
+		claims[lcom.JWTClaimIssuedAtKey] = now.Unix()
+		claims[lcom.JWTClaimNotBeforeKey] = now.Add(time.Minute).Unix()
+		signedJWT, err = signer.Sign(claims)
+		require.Nil(t, err)
+		_, err = lenient.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenNotValidYet))
+	})
+	t.Run("verify required claims are checked when signing and verifying", func(t *testing.T) {
+		claims := util.GenerateStandardMapClaims()
+		delete(claims, lcom.JWTClaimSubjectKey)
+
+		signer, err := NewSigner(WithHMACSecret(secret), WithRequiredClaims(lcom.JWTClaimSubjectKey))
+		require.Nil(t, err)
+		_, err = signer.Sign(claims)
+		require.True(t, errors.Is(err, lcom.ErrUnableToSignToken))
+
+		signer, err = NewSigner(WithHMACSecret(secret))
+		require.Nil(t, err)
+		signedJWT, err := signer.Sign(claims)
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithHMACSecret(secret), WithRequiredClaims(lcom.JWTClaimSubjectKey))
+		require.Nil(t, err)
+		_, err = verifier.Verify(ctx, signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidJWT))
+	})
+	t.Run("verify private keys verify with their public key", func(t *testing.T) {
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+
+		signer, err := NewSigner(WithPrivateKey(edKey))
+		require.Nil(t, err)
+		signedJWT, err := signer.Sign(util.GenerateExpandedMapClaims())
+		require.Nil(t, err)
+
+		verifier, err := NewVerifier(WithPrivateKey(edKey))
+		require.Nil(t, err)
+
+		mapClaims, httpStatus, err := verifier.ExtractJWT(ctx, map[string]string{"Authorization": "Bearer " + signedJWT})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, httpStatus)
+		require.Len(t, mapClaims, 12)
+	})
+}
+
+func TestEnvSecretErrors(t *testing.T) {
+	t.Run("verify a missing HMAC secret returns an error", func(t *testing.T) {
+		t.Setenv(lcom.HMACSecretEnvKey, "")
+
+		_, err := Sign(util.GenerateStandardMapClaims())
+		require.True(t, errors.Is(err, lcom.ErrInvalidHMACSecret))
+
+		_, httpStatus, err := ExtractJWT(map[string]string{"Authorization": "Bearer token"})
+		require.True(t, errors.Is(err, lcom.ErrInvalidHMACSecret))
+		require.Equal(t, http.StatusInternalServerError, httpStatus)
+	})
+	t.Run("verify an HMAC secret that isn't hex encoded returns an error", func(t *testing.T) {
+		t.Setenv(lcom.HMACSecretEnvKey, "not hex")
+
+		_, err := VerifyJWT("token")
+		require.True(t, errors.Is(err, lcom.ErrInvalidHMACSecret))
+	})
+	t.Run("verify an invalid private key returns an error", func(t *testing.T) {
+		t.Setenv(lcom.PrivateKeyEnvKey, "not a pem")
+
+		_, err := Sign(util.GenerateStandardMapClaims())
+		require.True(t, errors.Is(err, lcom.ErrInvalidKey))
+	})
+}
+
+func TestVerifyJWTClaimOptionsFromEnv(t *testing.T) {
+	claims := util.GenerateStandardMapClaims()
+	claims[lcom.JWTClaimIssuerKey] = "https://auth.example.com"
+	claims[lcom.JWTClaimAudienceKey] = "books"
+	claims[lcom.JWTClaimExpiresAtKey] = time.Now().Add(-10 * time.Second).Unix()
+
+	signedJWT, err := Sign(claims)
+	require.Nil(t, err)
+
+	t.Setenv(lcom.JWTIssuerEnvKey, "https://auth.example.com")
+	t.Setenv(lcom.JWTAudienceEnvKey, "movies, books")
+	t.Setenv(lcom.JWTRequiredClaimsEnvKey, lcom.JWTClaimSubjectKey)
+
+	t.Run("verify the leeway is read from the env", func(t *testing.T) {
+		_, err := VerifyJWT(signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrTokenExpired))
+
+		t.Setenv(lcom.JWTLeewayEnvKey, "1m")
+		_, err = VerifyJWT(signedJWT)
+		require.Nil(t, err)
+
+		t.Setenv(lcom.JWTLeewayEnvKey, "a minute")
+		_, httpStatus, err := ExtractJWT(map[string]string{"Authorization": "Bearer " + signedJWT})
+		require.True(t, errors.Is(err, lcom.ErrInvalidLeeway))
+		require.Equal(t, http.StatusInternalServerError, httpStatus)
+	})
+	t.Run("verify the issuer, audience and required claims are read from the env", func(t *testing.T) {
+		t.Setenv(lcom.JWTLeewayEnvKey, "1m")
+
+		t.Setenv(lcom.JWTIssuerEnvKey, "https://staging.example.com")
+		_, err := VerifyJWT(signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidIssuer))
+		t.Setenv(lcom.JWTIssuerEnvKey, "https://auth.example.com")
+
+		t.Setenv(lcom.JWTAudienceEnvKey, "movies")
+		_, err = VerifyJWT(signedJWT)
+		require.True(t, errors.Is(err, lcom.ErrInvalidAudience))
+		t.Setenv(lcom.JWTAudienceEnvKey, "books")
+
+		t.Setenv(lcom.JWTRequiredClaimsEnvKey, "sub,email")
+		_, httpStatus, err := ExtractJWT(map[string]string{"Authorization": "Bearer " + signedJWT})
+		require.True(t, errors.Is(err, lcom.ErrMissingClaim))
+		require.True(t, errors.Is(err, lcom.ErrVerifyJWT))
+		require.Equal(t, http.StatusUnauthorized, httpStatus)
+	})
+}
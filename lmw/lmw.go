@@ -3,9 +3,11 @@ package lmw
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/golang-jwt/jwt"
 	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
 	"github.com/seantcanavan/lambda_jwt_router/lcom"
 	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
 	"github.com/seantcanavan/lambda_jwt_router/lreq"
@@ -126,32 +128,41 @@ func AllowOptionsMW() lcom.Handler {
 // (JWT) then an error message and appropriate HTTP status code will be returned. If the JWT
 // is correctly set and contains a StandardClaim then the values from that standard claim
 // will be added to the context object for others to use during their processing.
+// Set LAMBDA_JWT_ROUTER_TOKEN_SOURCES, or pass a verifier using
+// ljwt.WithTokenSources to NewDecodeStandardMW, to look for the JWT in
+// cookies, other headers or query parameters as well.
+// A JWT that is expired, not valid yet, issued in the future, from another
+// issuer or audience or missing a required claim is rejected with a 401 whose
+// message is lcom.ErrTokenExpired, lcom.ErrTokenNotValidYet,
+// lcom.ErrTokenIssuedInFuture, lcom.ErrInvalidIssuer, lcom.ErrInvalidAudience
+// or lcom.ErrMissingClaim.
 func DecodeStandardMW(next lcom.Handler) lcom.Handler {
-	return func(ctx context.Context, req events.APIGatewayProxyRequest) (
-		res events.APIGatewayProxyResponse,
-		err error,
-	) {
-		mapClaims, httpStatus, err := ljwt.ExtractJWT(req.Headers)
-		if err != nil {
-			return lres.StatusAndError(httpStatus, err)
-		}
+	return NewDecodeStandardMW(nil)(next)
+}
 
-		var standardClaims jwt.StandardClaims
-		err = ljwt.ExtractStandard(mapClaims, &standardClaims)
-		if err != nil {
-			return lres.StatusAndError(http.StatusInternalServerError, err)
-		}
+// NewDecodeStandardMW returns DecodeStandardMW verifying JWTs with verifier
+// instead of the key material from environment variables. A nil verifier
+// uses environment variables like DecodeStandardMW.
+func NewDecodeStandardMW(verifier *ljwt.Verifier) lcom.Middleware {
+	return newDecodeMW(verifierExtractor(verifier), injectStandard)
+}
 
-		ctx = context.WithValue(ctx, lcom.JWTClaimAudienceKey, standardClaims.Audience)
-		ctx = context.WithValue(ctx, lcom.JWTClaimExpiresAtKey, standardClaims.ExpiresAt)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIDKey, standardClaims.Id)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIssuedAtKey, standardClaims.IssuedAt)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIssuerKey, standardClaims.Issuer)
-		ctx = context.WithValue(ctx, lcom.JWTClaimNotBeforeKey, standardClaims.NotBefore)
-		ctx = context.WithValue(ctx, lcom.JWTClaimSubjectKey, standardClaims.Subject)
+// injectStandard adds the jwt.StandardClaims of mapClaims to ctx under the
+// bare string keys and for Claims. The claims are mapped one by one with
+// ljwt.StandardClaimsOf, so an "aud" list, as Auth0 and Cognito send it, is
+// joined by spaces instead of failing the req.
+func injectStandard(ctx context.Context, mapClaims jwt.MapClaims) (context.Context, error) {
+	standardClaims := ljwt.StandardClaimsOf(mapClaims)
 
-		return next(ctx, req)
-	}
+	ctx = context.WithValue(ctx, lcom.JWTClaimAudienceKey, standardClaims.Audience)
+	ctx = context.WithValue(ctx, lcom.JWTClaimExpiresAtKey, standardClaims.ExpiresAt)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIDKey, standardClaims.Id)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIssuedAtKey, standardClaims.IssuedAt)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIssuerKey, standardClaims.Issuer)
+	ctx = context.WithValue(ctx, lcom.JWTClaimNotBeforeKey, standardClaims.NotBefore)
+	ctx = context.WithValue(ctx, lcom.JWTClaimSubjectKey, standardClaims.Subject)
+
+	return WithClaims(ctx, standardClaims), nil
 }
 
 // DecodeExpandedMW attempts to parse a Json Web Token from the request's "Authorization"
@@ -159,35 +170,155 @@ func DecodeStandardMW(next lcom.Handler) lcom.Handler {
 // (JWT) then an error message and appropriate HTTP status code will be returned. If the JWT
 // is correctly set and contains an instance of ExpandedClaims then the values from
 // that standard claim will be added to the context object for others to use during their processing.
+// Token sources and rejected JWTs are handled like DecodeStandardMW handles them.
 func DecodeExpandedMW(next lcom.Handler) lcom.Handler {
-	return func(ctx context.Context, req events.APIGatewayProxyRequest) (
-		res events.APIGatewayProxyResponse,
-		err error,
-	) {
-		mapClaims, httpStatus, err := ljwt.ExtractJWT(req.Headers)
-		if err != nil {
-			return lres.StatusAndError(httpStatus, err)
+	return NewDecodeExpandedMW(nil)(next)
+}
+
+// NewDecodeExpandedMW returns DecodeExpandedMW verifying JWTs with verifier
+// instead of the key material from environment variables. A nil verifier
+// uses environment variables like DecodeExpandedMW.
+func NewDecodeExpandedMW(verifier *ljwt.Verifier) lcom.Middleware {
+	return newDecodeMW(verifierExtractor(verifier), injectExpanded)
+}
+
+// injectExpanded adds the ljwt.ExpandedClaims of mapClaims to ctx under the
+// bare string keys and for Claims, mapped like injectStandard maps them.
+func injectExpanded(ctx context.Context, mapClaims jwt.MapClaims) (context.Context, error) {
+	extendedClaims := ljwt.ExpandedClaimsOf(mapClaims)
+
+	ctx = context.WithValue(ctx, lcom.JWTClaimAudienceKey, extendedClaims.Audience)
+	ctx = context.WithValue(ctx, lcom.JWTClaimEmailKey, extendedClaims.Email)
+	ctx = context.WithValue(ctx, lcom.JWTClaimExpiresAtKey, extendedClaims.ExpiresAt)
+	ctx = context.WithValue(ctx, lcom.JWTClaimFirstNameKey, extendedClaims.FirstName)
+	ctx = context.WithValue(ctx, lcom.JWTClaimFullNameKey, extendedClaims.FullName)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIDKey, extendedClaims.ID)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIssuedAtKey, extendedClaims.IssuedAt)
+	ctx = context.WithValue(ctx, lcom.JWTClaimIssuerKey, extendedClaims.Issuer)
+	ctx = context.WithValue(ctx, lcom.JWTClaimLevelKey, extendedClaims.Level)
+	ctx = context.WithValue(ctx, lcom.JWTClaimNotBeforeKey, extendedClaims.NotBefore)
+	ctx = context.WithValue(ctx, lcom.JWTClaimSubjectKey, extendedClaims.Subject)
+	ctx = context.WithValue(ctx, lcom.JWTClaimUserTypeKey, extendedClaims.UserType)
+
+	return WithClaims(ctx, extendedClaims), nil
+}
+
+// extractor returns the verified claims of the token in a req along with the
+// HTTP status to respond with if it fails.
+type extractor func(context.Context, events.APIGatewayProxyRequest) (jwt.MapClaims, int, error)
+
+// verifierExtractor returns the extractor verifying JWTs with verifier, or
+// with the token sources and key material from environment variables if
+// verifier is nil.
+func verifierExtractor(verifier *ljwt.Verifier) extractor {
+	if verifier == nil {
+		return authorizerExtractor(ljwt.VerifyClaims, func(ctx context.Context, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+			return ljwt.ExtractJWTFromRequest(req)
+		})
+	}
+
+	return authorizerExtractor(verifier.VerifyClaims, verifier.ExtractJWTFromRequest)
+}
+
+// authorizerExtractor returns the claims AuthorizerContextMW took from a
+// Lambda authorizer once verifyClaims accepted them, and uses extract for
+// all other reqs. The authorizer checked the signature at the edge already,
+// but the route's verifier may require another issuer, audience or claims
+// than the authorizer did, and JWTs may be revoked while API Gateway caches
+// the authorizer's result. Only plain JWT verification may be skipped like
+// this: introspection and DPoP check more than the authorizer does, so their
+// extractors always run.
+func authorizerExtractor(verifyClaims func(context.Context, jwt.MapClaims) error, extract extractor) extractor {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+		if ctx == nil {
+			return extract(ctx, req)
 		}
 
-		var extendedClaims ljwt.ExpandedClaims
-		err = ljwt.ExtractCustom(mapClaims, &extendedClaims)
+		mapClaims, ok := ctx.Value(authorizerClaimsKey{}).(jwt.MapClaims)
+		if !ok {
+			return extract(ctx, req)
+		}
+
+		err := verifyClaims(ctx, mapClaims)
+		if errors.Is(err, lcom.ErrInvalidJWT) {
+			return nil, http.StatusUnauthorized, util.WrapErrors(err, lcom.ErrVerifyJWT)
+		}
 		if err != nil {
-			return lres.StatusAndError(http.StatusInternalServerError, err)
+			return nil, http.StatusInternalServerError, err
 		}
 
-		ctx = context.WithValue(ctx, lcom.JWTClaimAudienceKey, extendedClaims.Audience)
-		ctx = context.WithValue(ctx, lcom.JWTClaimEmailKey, extendedClaims.Email)
-		ctx = context.WithValue(ctx, lcom.JWTClaimExpiresAtKey, extendedClaims.ExpiresAt)
-		ctx = context.WithValue(ctx, lcom.JWTClaimFirstNameKey, extendedClaims.FirstName)
-		ctx = context.WithValue(ctx, lcom.JWTClaimFullNameKey, extendedClaims.FullName)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIDKey, extendedClaims.ID)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIssuedAtKey, extendedClaims.IssuedAt)
-		ctx = context.WithValue(ctx, lcom.JWTClaimIssuerKey, extendedClaims.Issuer)
-		ctx = context.WithValue(ctx, lcom.JWTClaimLevelKey, extendedClaims.Level)
-		ctx = context.WithValue(ctx, lcom.JWTClaimNotBeforeKey, extendedClaims.NotBefore)
-		ctx = context.WithValue(ctx, lcom.JWTClaimSubjectKey, extendedClaims.Subject)
-		ctx = context.WithValue(ctx, lcom.JWTClaimUserTypeKey, extendedClaims.UserType)
+		return mapClaims, http.StatusOK, nil
+	}
+}
 
-		return next(ctx, req)
+// newDecodeMW returns middleware that extracts the claims of the req with
+// extract and calls next with the context inject builds from them. The
+// context also holds the jwt.MapClaims for Claims and policies and the
+// JWT's scopes for RequireScopes and RequireAnyScope.
+func newDecodeMW(extract extractor, inject func(context.Context, jwt.MapClaims) (context.Context, error)) lcom.Middleware {
+	return func(next lcom.Handler) lcom.Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			res events.APIGatewayProxyResponse,
+			err error,
+		) {
+			mapClaims, httpStatus, err := extractJWT(ctx, extract, req)
+			var dpopErr *ljwt.DPoPError
+			if errors.As(err, &dpopErr) {
+				return lres.Custom(httpStatus, map[string]string{lcom.WWWAuthenticateHeaderKey: dpopErr.Challenge()}, lres.HTTPError{
+					Status:  httpStatus,
+					Message: rejection(dpopErr.Err).Error(),
+				})
+			}
+			if err != nil {
+				return lres.StatusAndError(httpStatus, err)
+			}
+
+			ctx, err = inject(WithClaims(ctx, mapClaims), mapClaims)
+			if err != nil {
+				return lres.StatusAndError(http.StatusInternalServerError, err)
+			}
+
+			return next(WithScopes(ctx, ljwt.ParseScopes(mapClaims)), req)
+		}
+	}
+}
+
+// jwtRejections are the reasons a correctly signed JWT is rejected. The decode
+// middleware responds with the matching error so the caller knows whether to
+// refresh its JWT or that it was issued for somebody else.
+var jwtRejections = []error{
+	lcom.ErrTokenExpired,
+	lcom.ErrTokenNotValidYet,
+	lcom.ErrTokenIssuedInFuture,
+	lcom.ErrInvalidIssuer,
+	lcom.ErrInvalidAudience,
+	lcom.ErrMissingClaim,
+	lcom.ErrTokenRevoked,
+	lcom.ErrTokenInactive,
+	lcom.ErrDPoPProofReplayed,
+	lcom.ErrInvalidDPoPProof,
+	lcom.ErrDPoPKeyMismatch,
+}
+
+// extractJWT extracts the claims of req with extract and maps rejected JWTs
+// to their jwtRejections sentinel.
+func extractJWT(ctx context.Context, extract extractor, req events.APIGatewayProxyRequest) (jwt.MapClaims, int, error) {
+	mapClaims, httpStatus, err := extract(ctx, req)
+	var dpopErr *ljwt.DPoPError
+	if err != nil && httpStatus == http.StatusUnauthorized && !errors.As(err, &dpopErr) {
+		return nil, httpStatus, rejection(err)
 	}
+
+	return mapClaims, httpStatus, err
+}
+
+// rejection returns the jwtRejections sentinel err wraps, or err itself.
+func rejection(err error) error {
+	for _, rejection := range jwtRejections {
+		if errors.Is(err, rejection) {
+			return rejection
+		}
+	}
+
+	return err
 }
@@ -2,6 +2,9 @@ package lmw
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
@@ -15,6 +18,7 @@ import (
 	"github.com/seantcanavan/lambda_jwt_router/lres"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"testing"
@@ -293,6 +297,175 @@ func generateSuccessHandlerAndMapStandardContext(t *testing.T) lcom.Handler {
 	}
 }
 
+func TestNewDecodeMW(t *testing.T) {
+	verifier, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("verifier secret")), ljwt.WithIssuer("issuer"))
+	require.Nil(t, err)
+
+	signer, err := ljwt.NewSigner(ljwt.WithHMACSecret([]byte("verifier secret")))
+	require.Nil(t, err)
+
+	t.Run("verify context is returned by NewDecodeStandardMW with the verifier", func(t *testing.T) {
+		standardClaims := util.GenerateStandardMapClaims()
+		standardClaims[lcom.JWTClaimIssuerKey] = "issuer"
+
+		signedJWT, err := signer.Sign(standardClaims)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+		res, err := NewDecodeStandardMW(verifier)(generateSuccessHandlerAndMapStandardContext(t))(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		// the env secret doesn't verify JWTs signed by the verifier's secret
+		res, err = DecodeStandardMW(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+	t.Run("verify NewDecodeExpandedMW rejects JWTs from another issuer", func(t *testing.T) {
+		signedJWT, err := signer.Sign(util.GenerateExpandedMapClaims())
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+		res, err := NewDecodeExpandedMW(verifier)(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+	t.Run("verify JWTs signed for two audiences are decoded", func(t *testing.T) {
+		audienceSigner, err := ljwt.NewSigner(ljwt.WithHMACSecret([]byte("verifier secret")), ljwt.WithAudience("books", "authors"))
+		require.Nil(t, err)
+		audienceVerifier, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("verifier secret")), ljwt.WithAudience("authors"))
+		require.Nil(t, err)
+
+		claims := util.GenerateExpandedMapClaims()
+		delete(claims, lcom.JWTClaimAudienceKey)
+
+		signedJWT, err := audienceSigner.Sign(claims)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+		for _, mw := range []lcom.Middleware{NewDecodeStandardMW(audienceVerifier), NewDecodeExpandedMW(audienceVerifier)} {
+			res, err := mw(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				require.Equal(t, "books authors", ctx.Value(lcom.JWTClaimAudienceKey))
+
+				mapClaims, ok := Claims[jwt.MapClaims](ctx)
+				require.True(t, ok)
+				require.Equal(t, []string{"books", "authors"}, ljwt.ParseAudience(mapClaims))
+
+				return lres.Empty()
+			})(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+	t.Run("verify JWKS access tokens with an aud list are decoded", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.Nil(t, err)
+		jwk, err := ljwt.NewJWK("auth0", "ES256", key.Public())
+		require.Nil(t, err)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Nil(t, json.NewEncoder(w).Encode(ljwt.JWKSet{Keys: []ljwt.JWK{jwk}}))
+		}))
+		defer server.Close()
+
+		jwksVerifier, err := ljwt.NewVerifier(ljwt.WithJWKS(ljwt.NewJWKS(server.URL)), ljwt.WithAudience("https://books.example.com"))
+		require.Nil(t, err)
+
+		// Auth0 lists the API and its userinfo endpoint as audiences
+		claims := util.GenerateExpandedMapClaims()
+		claims[lcom.JWTClaimAudienceKey] = []string{"https://books.example.com", "https://tenant.auth0.com/userinfo"}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "auth0"
+		signedJWT, err := token.SignedString(key)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+		for _, mw := range []lcom.Middleware{NewDecodeStandardMW(jwksVerifier), NewDecodeExpandedMW(jwksVerifier), NewDecodeClaimsMW[ljwt.ExpandedClaims](jwksVerifier)} {
+			res, err := mw(generateEmptySuccessHandler())(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+	t.Run("verify rejected JWTs are reported with a precise reason", func(t *testing.T) {
+		strict, err := ljwt.NewVerifier(
+			ljwt.WithHMACSecret([]byte("verifier secret")),
+			ljwt.WithAudience("books"),
+			ljwt.WithRequiredClaims(lcom.JWTClaimEmailKey),
+		)
+		require.Nil(t, err)
+
+		expiredClaims := util.GenerateStandardMapClaims()
+		expiredClaims[lcom.JWTClaimExpiresAtKey] = time.Now().Add(-time.Minute).Unix()
+
+		booksClaims := util.GenerateStandardMapClaims()
+		booksClaims[lcom.JWTClaimAudienceKey] = "books"
+
+		tests := []struct {
+			claims      jwt.MapClaims
+			expectedErr error
+		}{
+			{claims: expiredClaims, expectedErr: lcom.ErrTokenExpired},
+			{claims: util.GenerateStandardMapClaims(), expectedErr: lcom.ErrInvalidAudience},
+			{claims: booksClaims, expectedErr: lcom.ErrMissingClaim},
+		}
+
+		for _, tt := range tests {
+			signedJWT, err := signer.Sign(tt.claims)
+			require.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+			res, err := NewDecodeStandardMW(strict)(generateEmptySuccessHandler())(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+			var responseBody lres.HTTPError
+			err = lres.Unmarshal(res, &responseBody)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedErr.Error(), responseBody.Message)
+		}
+	})
+	t.Run("verify revoked JWTs are rejected", func(t *testing.T) {
+		store := ljwt.NewMemoryRevocationStore()
+		ljwt.DefaultRevocationStore = store
+		defer func() { ljwt.DefaultRevocationStore = nil }()
+
+		claims := util.GenerateStandardMapClaims()
+		signedJWT, err := ljwt.Sign(claims)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+		res, err := DecodeStandardMW(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		err = ljwt.RevokeJWT(context.Background(), store, claims)
+		require.Nil(t, err)
+
+		res, err = DecodeStandardMW(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrTokenRevoked.Error(), responseBody.Message)
+	})
+	t.Run("verify a missing env secret returns an error instead of exiting", func(t *testing.T) {
+		t.Setenv(lcom.HMACSecretEnvKey, "")
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer token"}}
+		res, err := DecodeExpandedMW(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Contains(t, responseBody.Message, lcom.ErrInvalidHMACSecret.Error())
+	})
+}
+
 func TestLogRequestMW(t *testing.T) {
 	// Setup Zerolog to write to a file
 	logFile := "test_log.txt"
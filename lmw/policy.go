@@ -0,0 +1,341 @@
+package lmw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Rule reports whether a req is allowed. Rules run after the decode
+// middleware so they can compare the req with the JWT claims in ctx.
+type Rule func(ctx context.Context, req events.APIGatewayProxyRequest) bool
+
+// RequirePolicy returns a middleware that only allows reqs satisfying
+// policy. It must run after one of the decode middleware. All other reqs get
+// a 403. A policy compares values with "==" or "!=" and combines the
+// comparisons with "OR" and "AND" (or "||" and "&&"), where AND binds
+// tighter:
+//
+//	router.Route(http.MethodGet, "/users/:userId/books", books.ListLambda,
+//	    lmw.DecodeExpandedMW,
+//	    lmw.RequirePolicy("path.userId == claims.sub OR claims.userType == admin"))
+//
+// Values are "path.<name>", "query.<name>", "header.<name>" or "body.<name>"
+// for the req's path parameters, query parameters, headers and top level
+// JSON body fields, "claims.<name>" for the JWT claims verified by a decode
+// middleware and literals, which must be quoted if they contain a dot, a
+// space or one of "=!&|". Missing values never compare equal, not even to
+// each other. Always name the source of a value explicitly since a user
+// controls all but the path of their own req.
+//
+// RequirePolicy panics if policy is invalid, see ParsePolicy.
+func RequirePolicy(policy string) lcom.Middleware {
+	rule, err := ParsePolicy(policy)
+	if err != nil {
+		panic(fmt.Sprintf("RequirePolicy: %s", err))
+	}
+
+	return RequireRules(rule)
+}
+
+// RequireOwner returns a middleware that only allows reqs where the value
+// of param, such as "path.userId", is the "sub" claim of the JWT. It's
+// RequirePolicy(param + " == claims.sub").
+func RequireOwner(param string) lcom.Middleware {
+	return RequirePolicy(param + " == claims.sub")
+}
+
+// RequireRules returns a middleware that only allows reqs for which at least
+// one of rules returns true. All other reqs get a 403. Use it for checks a
+// policy can't express:
+//
+//	lmw.RequireRules(func(ctx context.Context, req events.APIGatewayProxyRequest) bool {
+//	    claims, ok := lmw.Claims[BookClaims](ctx)
+//	    return ok && slices.Contains(claims.Shelves, req.PathParameters["shelf"])
+//	})
+func RequireRules(rules ...Rule) lcom.Middleware {
+	return func(next lcom.Handler) lcom.Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			for _, rule := range rules {
+				if rule(ctx, req) {
+					return next(ctx, req)
+				}
+			}
+
+			return lres.StatusAndError(http.StatusForbidden, lcom.ErrPolicyNotAllowed)
+		}
+	}
+}
+
+// ParsePolicy parses a policy as described by RequirePolicy into a Rule. It
+// returns lcom.ErrInvalidPolicy for malformed policies and unknown value
+// sources.
+func ParsePolicy(policy string) (Rule, error) {
+	tokens, err := tokenizePolicy(policy)
+	if err != nil {
+		return nil, util.WrapErrors(err, lcom.ErrInvalidPolicy)
+	}
+
+	// a policy is a list of AND groups separated by OR
+	var anyOf [][]comparison
+	var allOf []comparison
+	for len(tokens) > 0 {
+		if len(tokens) < 3 {
+			return nil, util.WrapErrors(fmt.Errorf("incomplete comparison %q", strings.Join(tokens, " ")), lcom.ErrInvalidPolicy)
+		}
+
+		cmp, err := parseComparison(tokens[0], tokens[1], tokens[2])
+		if err != nil {
+			return nil, util.WrapErrors(err, lcom.ErrInvalidPolicy)
+		}
+		allOf = append(allOf, cmp)
+		tokens = tokens[3:]
+
+		if len(tokens) == 0 {
+			break
+		}
+
+		switch strings.ToUpper(tokens[0]) {
+		case "AND", "&&":
+		case "OR", "||":
+			anyOf = append(anyOf, allOf)
+			allOf = nil
+		default:
+			return nil, util.WrapErrors(fmt.Errorf("expected AND or OR instead of %q", tokens[0]), lcom.ErrInvalidPolicy)
+		}
+
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil, util.WrapErrors(fmt.Errorf("policy %q ends with an operator", policy), lcom.ErrInvalidPolicy)
+		}
+	}
+
+	if len(allOf) == 0 {
+		return nil, util.WrapErrors(fmt.Errorf("empty policy"), lcom.ErrInvalidPolicy)
+	}
+	anyOf = append(anyOf, allOf)
+
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) bool {
+		input := &policyInput{ctx: ctx, req: req}
+
+		for _, group := range anyOf {
+			allowed := true
+			for _, cmp := range group {
+				if !cmp.eval(input) {
+					allowed = false
+					break
+				}
+			}
+
+			if allowed {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// policyInput holds what a policy is evaluated against. The body is only
+// decoded if the policy uses it.
+type policyInput struct {
+	ctx         context.Context
+	req         events.APIGatewayProxyRequest
+	body        map[string]any
+	bodyDecoded bool
+}
+
+// policyValue is one side of a comparison, either a literal or the name of
+// a value in one of the sources.
+type policyValue struct {
+	source  string
+	name    string
+	literal string
+}
+
+type comparison struct {
+	left, right policyValue
+	equal       bool
+}
+
+// eval compares both values of cmp. A comparison with a missing value is
+// always false.
+func (cmp comparison) eval(input *policyInput) bool {
+	left, ok := cmp.left.resolve(input)
+	if !ok {
+		return false
+	}
+
+	right, ok := cmp.right.resolve(input)
+	if !ok {
+		return false
+	}
+
+	return (left == right) == cmp.equal
+}
+
+// resolve returns the value of v as a string and whether it exists.
+func (v policyValue) resolve(input *policyInput) (string, bool) {
+	var value any
+	switch v.source {
+	case "":
+		return v.literal, true
+	case "path":
+		value = input.req.PathParameters[v.name]
+	case "query":
+		value = input.req.QueryStringParameters[v.name]
+		if value == "" && len(input.req.MultiValueQueryStringParameters[v.name]) > 0 {
+			value = input.req.MultiValueQueryStringParameters[v.name][0]
+		}
+	case "header":
+		for key, headerValue := range input.req.Headers {
+			if strings.EqualFold(key, v.name) {
+				value = headerValue
+				break
+			}
+		}
+	case "body":
+		if !input.bodyDecoded {
+			input.bodyDecoded = true
+			_ = json.Unmarshal([]byte(input.req.Body), &input.body)
+		}
+		value = input.body[v.name]
+	case "claims":
+		// only verified claims count, the bare context keys may come from
+		// the req itself, see InjectLambdaContextMW
+		mapClaims, _ := Claims[jwt.MapClaims](input.ctx)
+		value = mapClaims[v.name]
+	}
+
+	return policyString(value)
+}
+
+// policyString converts the values found in reqs and claims to strings so
+// they can be compared. Numbers are formatted without exponents so a
+// numeric claim can match a path parameter.
+func policyString(value any) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, value != ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	case int:
+		return strconv.Itoa(value), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+
+	return "", false
+}
+
+func parseComparison(left, operator, right string) (comparison, error) {
+	var cmp comparison
+	switch operator {
+	case "==":
+		cmp.equal = true
+	case "!=":
+	default:
+		return comparison{}, fmt.Errorf("expected == or != instead of %q", operator)
+	}
+
+	var err error
+	cmp.left, err = parsePolicyValue(left)
+	if err != nil {
+		return comparison{}, err
+	}
+
+	cmp.right, err = parsePolicyValue(right)
+	if err != nil {
+		return comparison{}, err
+	}
+
+	return cmp, nil
+}
+
+func parsePolicyValue(token string) (policyValue, error) {
+	if len(token) >= 2 && (token[0] == '"' || token[0] == '\'') {
+		return policyValue{literal: token[1 : len(token)-1]}, nil
+	}
+
+	switch token {
+	case "==", "!=", "&&", "||":
+		return policyValue{}, fmt.Errorf("expected a value instead of %q", token)
+	}
+
+	source, name, ok := strings.Cut(token, ".")
+	if !ok {
+		return policyValue{literal: token}, nil
+	}
+
+	switch source {
+	case "path", "query", "header", "body", "claims":
+		if name == "" {
+			return policyValue{}, fmt.Errorf("%q has no name", token)
+		}
+		return policyValue{source: source, name: name}, nil
+	}
+
+	return policyValue{}, fmt.Errorf("unknown value source %q, quote literals containing a dot", source)
+}
+
+// tokenizePolicy splits policy into values, quoted literals and operators.
+func tokenizePolicy(policy string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(policy); {
+		switch c := policy[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(policy[i+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated literal %s", policy[i:])
+			}
+			tokens = append(tokens, policy[i:i+end+2])
+			i += end + 2
+		case isPolicyOperator(policy[i:]):
+			tokens = append(tokens, policy[i:i+2])
+			i += 2
+		default:
+			end := i
+			for end < len(policy) && !strings.ContainsRune(" \t\n\"'", rune(policy[end])) && !isPolicyOperator(policy[end:]) {
+				end++
+			}
+
+			token := policy[i:end]
+			if strings.Trim(token, "=!&|") == "" {
+				return nil, fmt.Errorf("unexpected %q", policy[i:])
+			}
+			if j := strings.IndexAny(token, "=!&|"); j != -1 {
+				return nil, fmt.Errorf("literal %q contains %q, quote it", token, token[j])
+			}
+			tokens = append(tokens, token)
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// isPolicyOperator reports whether s starts with "==", "!=", "&&" or "||".
+func isPolicyOperator(s string) bool {
+	switch {
+	case strings.HasPrefix(s, "=="), strings.HasPrefix(s, "!="),
+		strings.HasPrefix(s, "&&"), strings.HasPrefix(s, "||"):
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package lmw
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestRequirePolicy(t *testing.T) {
+	ownerCtx := WithClaims(context.Background(), jwt.MapClaims{
+		lcom.JWTClaimSubjectKey:  "user-1",
+		lcom.JWTClaimUserTypeKey: "member",
+		lcom.JWTClaimLevelKey:    float64(3),
+	})
+	adminCtx := WithClaims(context.Background(), jwt.MapClaims{
+		lcom.JWTClaimSubjectKey:  "user-2",
+		lcom.JWTClaimUserTypeKey: "admin",
+	})
+
+	ownerReq := events.APIGatewayProxyRequest{PathParameters: map[string]string{"userId": "user-1"}}
+	otherReq := events.APIGatewayProxyRequest{PathParameters: map[string]string{"userId": "user-3"}}
+
+	t.Run("verify owners and admins are allowed", func(t *testing.T) {
+		policy := RequirePolicy("path.userId == claims.sub OR claims.userType == admin")
+
+		tests := []struct {
+			name           string
+			ctx            context.Context
+			req            events.APIGatewayProxyRequest
+			expectedStatus int
+		}{
+			{name: "owner", ctx: ownerCtx, req: ownerReq, expectedStatus: http.StatusOK},
+			{name: "admin", ctx: adminCtx, req: otherReq, expectedStatus: http.StatusOK},
+			{name: "somebody else", ctx: ownerCtx, req: otherReq, expectedStatus: http.StatusForbidden},
+			{name: "no claims", ctx: context.Background(), req: ownerReq, expectedStatus: http.StatusForbidden},
+		}
+
+		for _, tt := range tests {
+			res, err := policy(generateEmptySuccessHandler())(tt.ctx, tt.req)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedStatus, res.StatusCode, tt.name)
+
+			if tt.expectedStatus == http.StatusForbidden {
+				var responseBody lres.HTTPError
+				err = lres.Unmarshal(res, &responseBody)
+				require.Nil(t, err)
+				require.Equal(t, lcom.ErrPolicyNotAllowed.Error(), responseBody.Message)
+			}
+		}
+	})
+	t.Run("verify AND binds tighter than OR", func(t *testing.T) {
+		rule, err := ParsePolicy("claims.userType == admin || path.userId == claims.sub && query.view != 'all users'")
+		require.Nil(t, err)
+
+		req := ownerReq
+		req.QueryStringParameters = map[string]string{"view": "all users"}
+		require.False(t, rule(ownerCtx, req))
+		require.True(t, rule(adminCtx, req))
+
+		req.QueryStringParameters = map[string]string{"view": "mine"}
+		require.True(t, rule(ownerCtx, req))
+	})
+	t.Run("verify values come from every source", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			MultiValueQueryStringParameters: map[string][]string{"owner": {"user-1"}},
+			Headers:                         map[string]string{"x-tenant": "books"},
+			Body:                            `{"userId": "user-1", "level": 3}`,
+		}
+
+		for _, policy := range []string{
+			"query.owner == claims.sub",
+			"query.owner==claims.sub",
+			"header.X-Tenant == books",
+			`body.userId == claims.sub AND body.level == claims.level`,
+			`claims.level == "3"`,
+		} {
+			rule, err := ParsePolicy(policy)
+			require.Nil(t, err, policy)
+			require.True(t, rule(ownerCtx, req), policy)
+		}
+	})
+	t.Run("verify missing values never match", func(t *testing.T) {
+		for _, policy := range []string{"path.missing == claims.missing", "path.missing != claims.sub", `path.userId == ""`} {
+			rule, err := ParsePolicy(policy)
+			require.Nil(t, err, policy)
+			require.False(t, rule(ownerCtx, ownerReq), policy)
+		}
+	})
+	t.Run("verify bare context keys aren't claims", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), lcom.JWTClaimSubjectKey, "user-1")
+
+		res, err := RequireOwner("path.userId")(generateEmptySuccessHandler())(ctx, ownerReq)
+		require.Nil(t, err)
+		requireForbidden(t, res, lcom.ErrPolicyNotAllowed)
+	})
+	t.Run("verify the decode middleware provide the claims", func(t *testing.T) {
+		claims := util.GenerateStandardMapClaims()
+		claims["tenant"] = "books"
+
+		signedJWT, err := ljwt.Sign(claims)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{
+			Headers:        map[string]string{"Authorization": "Bearer " + signedJWT},
+			PathParameters: map[string]string{"userId": claims[lcom.JWTClaimSubjectKey].(string), "tenant": "books"},
+		}
+
+		mw := RequirePolicy("path.userId == claims.sub AND path.tenant == claims.tenant")
+		for _, decodeMW := range []lcom.Middleware{DecodeStandardMW, DecodeExpandedMW, DecodeClaimsMW[shelfClaims]()} {
+			res, err := decodeMW(mw(generateEmptySuccessHandler()))(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+	t.Run("verify invalid policies are rejected", func(t *testing.T) {
+		for _, policy := range []string{
+			"",
+			"path.userId",
+			"path.userId = claims.sub",
+			"path.userId == claims.sub OR",
+			"path.userId == claims.sub XOR claims.userType == admin",
+			"paths.userId == claims.sub",
+			"path. == claims.sub",
+			"path.userId == 'claims.sub",
+		} {
+			_, err := ParsePolicy(policy)
+			require.True(t, errors.Is(err, lcom.ErrInvalidPolicy), policy)
+		}
+
+		require.Panics(t, func() { RequirePolicy("path.userId") })
+
+		for _, policy := range []string{"claims.role == a!b", "claims.role == a=b", "claims.role == a&b||c"} {
+			_, err := ParsePolicy(policy)
+			require.True(t, errors.Is(err, lcom.ErrInvalidPolicy), policy)
+			require.Contains(t, err.Error(), "quote it", policy)
+		}
+	})
+	t.Run("verify any passing rule allows the req", func(t *testing.T) {
+		deny := func(ctx context.Context, req events.APIGatewayProxyRequest) bool { return false }
+		allow := func(ctx context.Context, req events.APIGatewayProxyRequest) bool { return true }
+
+		res, err := RequireRules(deny, allow)(generateEmptySuccessHandler())(context.Background(), ownerReq)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = RequireRules(deny)(generateEmptySuccessHandler())(context.Background(), ownerReq)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+}
@@ -0,0 +1,51 @@
+package lmw
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lreq"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"net/http"
+)
+
+// RefreshTokenRequest is the body RefreshTokenHandler expects.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler returns a handler for a route such as
+// POST /token/refresh that rotates the refresh token of its JSON body,
+// {"refresh_token": "..."}, with issuer and responds with the new
+// ljwt.TokenPair. An invalid, expired, revoked or reused refresh token
+// returns http.StatusUnauthorized; a reused one also revokes its whole token
+// family.
+func RefreshTokenHandler(issuer *ljwt.TokenIssuer) lcom.Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+		res events.APIGatewayProxyResponse,
+		err error,
+	) {
+		var input RefreshTokenRequest
+		err = lreq.UnmarshalReq(req, true, &input)
+		if err != nil {
+			return lres.StatusAndError(http.StatusBadRequest, err)
+		}
+
+		if input.RefreshToken == "" {
+			return lres.StatusAndError(http.StatusBadRequest, lcom.ErrNoRefreshToken)
+		}
+
+		tokenPair, err := issuer.Refresh(ctx, input.RefreshToken)
+		if errors.Is(err, lcom.ErrInvalidRefreshToken) {
+			return lres.StatusAndError(http.StatusUnauthorized, err)
+		}
+		if err != nil {
+			return lres.StatusAndError(http.StatusInternalServerError, err)
+		}
+
+		// token responses must not be cached, see RFC 6749 section 5.1
+		return lres.Custom(http.StatusOK, map[string]string{"Cache-Control": "no-store"}, tokenPair)
+	}
+}
@@ -0,0 +1,85 @@
+package lmw
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+// generateRefreshReq returns a req with refreshToken in its body
+func generateRefreshReq(t *testing.T, refreshToken string) events.APIGatewayProxyRequest {
+	body, err := json.Marshal(RefreshTokenRequest{RefreshToken: refreshToken})
+	require.Nil(t, err)
+
+	return events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/token/refresh", Body: string(body)}
+}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	issuer := ljwt.NewTokenIssuer(nil, ljwt.NewMemoryRefreshStore())
+	handler := RefreshTokenHandler(issuer)
+
+	tokenPair, err := issuer.Issue(context.Background(), util.GenerateExpandedMapClaims())
+	require.Nil(t, err)
+
+	t.Run("verify the refresh token is rotated", func(t *testing.T) {
+		res, err := handler(context.Background(), generateRefreshReq(t, tokenPair.RefreshToken))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "no-store", res.Headers["Cache-Control"])
+
+		var refreshedPair ljwt.TokenPair
+		err = lres.Unmarshal(res, &refreshedPair)
+		require.Nil(t, err)
+		require.NotEqual(t, tokenPair.RefreshToken, refreshedPair.RefreshToken)
+
+		// the access token works with the decode middleware
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + refreshedPair.AccessToken}}
+		res, err = DecodeExpandedMW(generateEmptySuccessHandler())(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("verify a reused refresh token is unauthorized", func(t *testing.T) {
+		res, err := handler(context.Background(), generateRefreshReq(t, tokenPair.RefreshToken))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		var httpError lres.HTTPError
+		err = lres.Unmarshal(res, &httpError)
+		require.Nil(t, err)
+		require.Contains(t, httpError.Message, "already used")
+	})
+	t.Run("verify malformed bodies return 400", func(t *testing.T) {
+		for _, body := range []string{`{"refreshToken":`, `["refresh-token"]`} {
+			res, err := handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Body: body})
+			require.Nil(t, err)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+			var httpError lres.HTTPError
+			err = lres.Unmarshal(res, &httpError)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusBadRequest, httpError.Status)
+			require.Contains(t, httpError.Message, "invalid req body")
+		}
+	})
+	t.Run("verify bad bodies are rejected", func(t *testing.T) {
+		res, err := handler(context.Background(), events.APIGatewayProxyRequest{Body: "not json"})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res, err = handler(context.Background(), generateRefreshReq(t, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		var httpError lres.HTTPError
+		err = lres.Unmarshal(res, &httpError)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrNoRefreshToken.Error(), httpError.Message)
+	})
+}
@@ -0,0 +1,87 @@
+package lmw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// scopesKey is the context key for the scopes of the decoded JWT.
+type scopesKey struct{}
+
+// RequireScopes returns a middleware that only allows reqs whose JWT has
+// every one of scopes in its "scope" or "scp" claim. It must run after one of
+// the decode middleware, which add the scopes to the context. All other reqs
+// get a 403 with a "WWW-Authenticate: Bearer error="insufficient_scope""
+// header as described in RFC 6750. Register it with the RequireScopes method
+// of the route's lrtr.Endpoint so its scopes are listed in the OpenAPI
+// document as well:
+//
+//	router.Endpoint(http.MethodDelete, "/books/:id", books.DeleteLambda).
+//	    Authenticate(lmw.DecodeStandardMW).
+//	    RequireScopes("books:write")
+func RequireScopes(scopes ...string) lcom.Middleware {
+	required := slices.Clone(scopes)
+
+	return requireScopes(required, func(scopes []string) bool {
+		for _, scope := range required {
+			if !slices.Contains(scopes, scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAnyScope returns a middleware that only allows reqs whose JWT has at
+// least one of scopes. It works like RequireScopes otherwise.
+func RequireAnyScope(scopes ...string) lcom.Middleware {
+	accepted := slices.Clone(scopes)
+
+	return requireScopes(accepted, func(scopes []string) bool {
+		for _, scope := range accepted {
+			if slices.Contains(scopes, scope) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Scopes returns the scopes of the JWT decoded by the decode middleware or
+// stored by WithScopes.
+func Scopes(ctx context.Context) []string {
+	scopes, _ := ctx.Value(scopesKey{}).([]string)
+	return scopes
+}
+
+// WithScopes returns a copy of ctx holding scopes for Scopes, RequireScopes
+// and RequireAnyScope to retrieve. Use it to test handlers without signing a
+// JWT.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+func requireScopes(scopes []string, allowed func(scopes []string) bool) lcom.Middleware {
+	challenge := `Bearer error="insufficient_scope", scope="` + strings.Join(scopes, " ") + `"`
+
+	return func(next lcom.Handler) lcom.Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (
+			events.APIGatewayProxyResponse,
+			error,
+		) {
+			if !allowed(Scopes(ctx)) {
+				return lres.Custom(http.StatusForbidden, map[string]string{lcom.WWWAuthenticateHeaderKey: challenge}, lres.HTTPError{
+					Status:  http.StatusForbidden,
+					Message: lcom.ErrInsufficientScope.Error(),
+				})
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
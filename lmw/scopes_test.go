@@ -0,0 +1,68 @@
+package lmw
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestRequireScopes(t *testing.T) {
+	ctx := WithScopes(context.Background(), []string{"books:read", "books:write"})
+
+	t.Run("verify RequireScopes needs every scope", func(t *testing.T) {
+		res, err := RequireScopes("books:read", "books:write")(generateEmptySuccessHandler())(ctx, events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = RequireScopes("books:read", "books:delete")(generateEmptySuccessHandler())(ctx, events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+		require.Equal(t, `Bearer error="insufficient_scope", scope="books:read books:delete"`, res.Headers[lcom.WWWAuthenticateHeaderKey])
+
+		var responseBody lres.HTTPError
+		err = lres.Unmarshal(res, &responseBody)
+		require.Nil(t, err)
+		require.Equal(t, lcom.ErrInsufficientScope.Error(), responseBody.Message)
+	})
+	t.Run("verify RequireAnyScope needs one scope", func(t *testing.T) {
+		res, err := RequireAnyScope("admin", "books:write")(generateEmptySuccessHandler())(ctx, events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = RequireAnyScope("admin")(generateEmptySuccessHandler())(ctx, events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+		require.Equal(t, `Bearer error="insufficient_scope", scope="admin"`, res.Headers[lcom.WWWAuthenticateHeaderKey])
+	})
+	t.Run("verify reqs without scopes are forbidden", func(t *testing.T) {
+		res, err := RequireAnyScope("books:read")(generateEmptySuccessHandler())(context.Background(), events.APIGatewayProxyRequest{})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+	t.Run("verify the decode middleware add the JWT's scopes", func(t *testing.T) {
+		claims := util.GenerateStandardMapClaims()
+		claims[lcom.JWTClaimScopeKey] = "books:read books:write"
+
+		signedJWT, err := ljwt.Sign(claims)
+		require.Nil(t, err)
+
+		req := events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Bearer " + signedJWT}}
+
+		handler := func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			require.Equal(t, []string{"books:read", "books:write"}, Scopes(ctx))
+			return lres.Empty()
+		}
+
+		for _, decodeMW := range []lcom.Middleware{DecodeStandardMW, DecodeExpandedMW, DecodeClaimsMW[shelfClaims]()} {
+			res, err := decodeMW(RequireScopes("books:write")(handler))(context.Background(), req)
+			require.Nil(t, err)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	})
+}
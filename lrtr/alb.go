@@ -0,0 +1,138 @@
+package lrtr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerALB receives a context and an Application Load Balancer target
+// group req, and handles it exactly like Handler does for API Gateway reqs.
+// The req is converted to an events.APIGatewayProxyRequest before it is
+// matched, so the same routes, middleware, lreq.UnmarshalReq and lres helpers
+// work behind a load balancer:
+//
+//	func main() {
+//	    lambda.Start(router.HandlerALB)
+//	}
+//
+// Target groups with multi value headers enabled send headers and query
+// parameters only in their multi value form and expect the response headers
+// in their multi value form too. HandlerALB detects which form the req uses
+// and answers in the same form. Header names are converted to their canonical
+// form and query parameters, which the load balancer passes on still URL
+// encoded, are decoded.
+func (l *Router) HandlerALB(
+	ctx context.Context,
+	req events.ALBTargetGroupRequest,
+) (events.ALBTargetGroupResponse, error) {
+	multiValue := req.MultiValueHeaders != nil || req.MultiValueQueryStringParameters != nil
+
+	res, err := l.Handler(ctx, proxyRequestFromALB(req, multiValue))
+	if err != nil {
+		return events.ALBTargetGroupResponse{}, err
+	}
+
+	return albResponseFromProxy(res, multiValue), nil
+}
+
+// proxyRequestFromALB converts an ALB target group req into the equivalent
+// API Gateway req.
+func proxyRequestFromALB(req events.ALBTargetGroupRequest, multiValue bool) events.APIGatewayProxyRequest {
+	multiHeaders := make(map[string][]string)
+	multiQuery := make(map[string][]string)
+
+	if multiValue {
+		for key, values := range req.MultiValueHeaders {
+			key = http.CanonicalHeaderKey(key)
+			multiHeaders[key] = append(multiHeaders[key], values...)
+		}
+
+		for key, values := range req.MultiValueQueryStringParameters {
+			key = unescapeQuery(key)
+			for _, value := range values {
+				multiQuery[key] = append(multiQuery[key], unescapeQuery(value))
+			}
+		}
+	} else {
+		for key, value := range req.Headers {
+			multiHeaders[http.CanonicalHeaderKey(key)] = []string{value}
+		}
+
+		for key, value := range req.QueryStringParameters {
+			multiQuery[unescapeQuery(key)] = []string{unescapeQuery(value)}
+		}
+	}
+
+	return events.APIGatewayProxyRequest{
+		Path:                            req.Path,
+		HTTPMethod:                      req.HTTPMethod,
+		Headers:                         convertMap(multiHeaders),
+		MultiValueHeaders:               multiHeaders,
+		QueryStringParameters:           convertMap(multiQuery),
+		MultiValueQueryStringParameters: multiQuery,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			HTTPMethod: req.HTTPMethod,
+			Path:       req.Path,
+		},
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	}
+}
+
+// albResponseFromProxy converts an API Gateway response into the equivalent
+// ALB target group response. If multiValue is true then all headers are
+// returned in MultiValueHeaders, otherwise all headers are returned in
+// Headers and only the last value of a multi value header is kept.
+func albResponseFromProxy(res events.APIGatewayProxyResponse, multiValue bool) events.ALBTargetGroupResponse {
+	albRes := events.ALBTargetGroupResponse{
+		StatusCode:        res.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+		Body:              res.Body,
+		IsBase64Encoded:   res.IsBase64Encoded,
+	}
+
+	if multiValue {
+		albRes.MultiValueHeaders = make(map[string][]string)
+		for key, values := range res.MultiValueHeaders {
+			albRes.MultiValueHeaders[key] = append(albRes.MultiValueHeaders[key], values...)
+		}
+
+		for key, value := range res.Headers {
+			if _, ok := albRes.MultiValueHeaders[key]; !ok {
+				albRes.MultiValueHeaders[key] = []string{value}
+			}
+		}
+
+		return albRes
+	}
+
+	albRes.Headers = make(map[string]string)
+	for key, values := range res.MultiValueHeaders {
+		if len(values) > 0 {
+			albRes.Headers[key] = values[len(values)-1]
+		}
+	}
+
+	for key, value := range res.Headers {
+		if _, ok := albRes.Headers[key]; !ok {
+			albRes.Headers[key] = value
+		}
+	}
+
+	return albRes
+}
+
+// unescapeQuery decodes a query string key or value, returning it unchanged
+// if it isn't validly encoded.
+func unescapeQuery(value string) string {
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
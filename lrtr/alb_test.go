@@ -0,0 +1,100 @@
+package lrtr
+
+import (
+	"context"
+	"github.com/seantcanavan/lambda_jwt_router/lreq"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type adapterEchoReq struct {
+	ID       string   `lambda:"path.id"`
+	Terms    []string `lambda:"query.terms"`
+	Search   string   `lambda:"query.search"`
+	Language []string `lambda:"header.Accept-Language"`
+}
+
+// adapterEcho returns the unmarshalled req as the response body along with a
+// multi value header so tests can verify the conversion in both directions.
+func adapterEcho(_ context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var input adapterEchoReq
+	err := lreq.UnmarshalReq(req, false, &input)
+	if err != nil {
+		return lres.Error(err)
+	}
+
+	res, err := lres.Success(input)
+	res.MultiValueHeaders = map[string][]string{"Set-Cookie": {"a=1", "b=2"}}
+
+	return res, err
+}
+
+func TestHandlerALB(t *testing.T) {
+	lmd := NewRouter("/api")
+	lmd.Route(http.MethodGet, "/:id", adapterEcho)
+
+	t.Run("multi value req gets multi value res", func(t *testing.T) {
+		res, err := lmd.HandlerALB(context.Background(), events.ALBTargetGroupRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/fake-id",
+			MultiValueHeaders: map[string][]string{
+				"accept-language": {"en", "fr"},
+			},
+			MultiValueQueryStringParameters: map[string][]string{
+				"terms":  {"one", "two%20three"},
+				"search": {"a+b"},
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "200 OK", res.StatusDescription)
+		require.Nil(t, res.Headers)
+		require.Equal(t, []string{"a=1", "b=2"}, res.MultiValueHeaders["Set-Cookie"])
+		require.Equal(t, []string{"application/json; charset=UTF-8"}, res.MultiValueHeaders["Content-Type"])
+
+		var output adapterEchoReq
+		err = lres.Unmarshal(events.APIGatewayProxyResponse{Body: res.Body}, &output)
+		require.Nil(t, err)
+		require.Equal(t, "fake-id", output.ID)
+		require.Equal(t, []string{"one", "two three"}, output.Terms)
+		require.Equal(t, "a b", output.Search)
+		require.Equal(t, []string{"en", "fr"}, output.Language)
+	})
+
+	t.Run("single value req gets single value res", func(t *testing.T) {
+		res, err := lmd.HandlerALB(context.Background(), events.ALBTargetGroupRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/fake-id",
+			Headers: map[string]string{
+				"accept-language": "en",
+			},
+			QueryStringParameters: map[string]string{
+				"search": "x%2Fy",
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Nil(t, res.MultiValueHeaders)
+		require.Equal(t, "b=2", res.Headers["Set-Cookie"])
+
+		var output adapterEchoReq
+		err = lres.Unmarshal(events.APIGatewayProxyResponse{Body: res.Body}, &output)
+		require.Nil(t, err)
+		require.Equal(t, "x/y", output.Search)
+		require.Equal(t, []string{"en"}, output.Language)
+	})
+
+	t.Run("missing route returns 404", func(t *testing.T) {
+		res, err := lmd.HandlerALB(context.Background(), events.ALBTargetGroupRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/nope",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+		require.Equal(t, "404 Not Found", res.StatusDescription)
+	})
+}
@@ -0,0 +1,259 @@
+package lrtr
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+)
+
+// CORSPolicy configures Cross-Origin Resource Sharing for a Router or a
+// Group. When a policy is set it replaces the LAMBDA_JWT_ROUTER_CORS_*
+// environment variables for the routes it applies to:
+//
+//	router.CORS(&lrtr.CORSPolicy{
+//	    AllowOrigins:     []string{"https://app.example.com", "https://*.example.com"},
+//	    AllowHeaders:     []string{"Authorization", "Content-Type"},
+//	    AllowCredentials: true,
+//	    MaxAge:           time.Hour,
+//	})
+//
+// Preflight reqs (OPTIONS reqs with an Access-Control-Request-Method header)
+// are answered by the Router before any middleware runs, for the route the
+// requested method would be routed to. The requested method must be
+// registered for the path and every requested header must be allowed,
+// otherwise a 403 is returned. All other responses get the
+// req's Origin echoed back if it is allowed, along with "Vary: Origin".
+type CORSPolicy struct {
+	// AllowOrigins lists the allowed origins. Entries are matched case
+	// insensitively and may contain "*" wildcards, e.g.
+	// "https://*.example.com". A single "*" allows every origin and can't
+	// be combined with AllowCredentials.
+	AllowOrigins []string
+
+	// AllowHeaders lists the req headers a preflight may ask for. A single
+	// "*" allows every header.
+	AllowHeaders []string
+
+	// ExposeHeaders lists the response headers browsers may read.
+	ExposeHeaders []string
+
+	// AllowCredentials allows cookies and Authorization headers to be sent
+	// with cross-origin reqs.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response. Zero
+	// leaves it up to the browser.
+	MaxAge time.Duration
+}
+
+// CORS sets the CORSPolicy for every route of the Router that doesn't have
+// one set by its Group. It also applies to 404 and 405 responses. CORS
+// panics if policy allows every origin with credentials.
+func (l *Router) CORS(policy *CORSPolicy) *Router {
+	policy.validate()
+	l.cors = policy
+	return l
+}
+
+// CORS sets the CORSPolicy for every route registered through the Group
+// after this call, overriding the Router's policy. CORS panics if policy
+// allows every origin with credentials.
+func (g *Group) CORS(policy *CORSPolicy) *Group {
+	policy.validate()
+	g.cors = policy
+	return g
+}
+
+// validate panics if p allows credentialed reqs from every origin, which
+// would let any website act on behalf of the user.
+func (p *CORSPolicy) validate() {
+	if p != nil && p.AllowCredentials && slices.Contains(p.AllowOrigins, "*") {
+		panic(`CORS: AllowOrigins "*" can't be combined with AllowCredentials`)
+	}
+}
+
+// allowsOrigin reports whether origin matches one of the allowed origins.
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowOrigins {
+		if allowed == "*" {
+			return true
+		}
+
+		matched, err := path.Match(strings.ToLower(allowed), origin)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowsHeaders reports whether every requested header is allowed.
+func (p *CORSPolicy) allowsHeaders(requested []string) bool {
+	if slices.Contains(p.AllowHeaders, "*") {
+		return true
+	}
+
+	for _, header := range requested {
+		if !slices.ContainsFunc(p.AllowHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, header)
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preflight answers a preflight req for route r.
+func (p *CORSPolicy) preflight(req events.APIGatewayProxyRequest, r *route) (events.APIGatewayProxyResponse, error) {
+	origin := headerValue(req.Headers, lcom.OriginHeaderKey)
+	if !p.allowsOrigin(origin) {
+		return p.forbidden(req, "origin %s is not allowed", origin)
+	}
+
+	method := headerValue(req.Headers, lcom.CORSRequestMethodHeaderKey)
+	if _, ok := r.methods[method]; !ok {
+		return p.forbidden(req, "method %s is not allowed", method)
+	}
+
+	var requested []string
+	for _, header := range strings.Split(headerValue(req.Headers, lcom.CORSRequestHeadersHeaderKey), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" {
+			requested = append(requested, header)
+		}
+	}
+
+	if !p.allowsHeaders(requested) {
+		return p.forbidden(req, "headers %s are not allowed", strings.Join(requested, ", "))
+	}
+
+	res, err := lres.Empty()
+	if err != nil {
+		return res, err
+	}
+
+	p.apply(req, &res)
+
+	methods := make([]string, 0, len(r.methods))
+	for registered := range r.methods {
+		methods = append(methods, registered)
+	}
+	slices.Sort(methods)
+	res.Headers[lcom.CORSMethodsHeaderKey] = strings.Join(methods, ", ")
+
+	// a wildcard can't be combined with credentials so the requested
+	// headers are echoed back instead
+	allowHeaders := p.AllowHeaders
+	if slices.Contains(p.AllowHeaders, "*") {
+		allowHeaders = requested
+	}
+	if len(allowHeaders) > 0 {
+		res.Headers[lcom.CORSHeadersHeaderKey] = strings.Join(allowHeaders, ", ")
+	}
+
+	if p.MaxAge > 0 {
+		res.Headers[lcom.CORSMaxAgeHeaderKey] = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+
+	delete(res.Headers, lcom.CORSExposeHeadersHeaderKey)
+
+	return res, nil
+}
+
+// apply replaces the CORS headers lres adds from the environment variables
+// with the headers of the policy for the req's Origin. Reqs from an origin
+// that isn't allowed get no Access-Control-Allow-Origin header at all.
+func (p *CORSPolicy) apply(req events.APIGatewayProxyRequest, res *events.APIGatewayProxyResponse) {
+	if res.Headers == nil {
+		res.Headers = make(map[string]string)
+	}
+
+	for _, key := range []string{lcom.CORSHeadersHeaderKey, lcom.CORSMethodsHeaderKey, lcom.CORSOriginHeaderKey} {
+		delete(res.Headers, key)
+		delete(res.MultiValueHeaders, key)
+	}
+
+	addVary(res, lcom.OriginHeaderKey)
+
+	origin := headerValue(req.Headers, lcom.OriginHeaderKey)
+	if !p.allowsOrigin(origin) {
+		return
+	}
+
+	res.Headers[lcom.CORSOriginHeaderKey] = origin
+
+	if p.AllowCredentials {
+		res.Headers[lcom.CORSCredentialsHeaderKey] = "true"
+	}
+
+	if len(p.ExposeHeaders) > 0 {
+		res.Headers[lcom.CORSExposeHeadersHeaderKey] = strings.Join(p.ExposeHeaders, ", ")
+	}
+}
+
+// forbidden returns the 403 response for a failed preflight req.
+func (p *CORSPolicy) forbidden(req events.APIGatewayProxyRequest, format string, value string) (events.APIGatewayProxyResponse, error) {
+	res, err := lres.StatusAndError(http.StatusForbidden, lres.HTTPError{
+		Status:  http.StatusForbidden,
+		Message: fmt.Sprintf("CORS preflight failed: "+format, value),
+	})
+	if err != nil {
+		return res, err
+	}
+
+	p.apply(req, &res)
+
+	return res, nil
+}
+
+// isPreflightReq reports whether req is a CORS preflight req.
+func isPreflightReq(req events.APIGatewayProxyRequest) bool {
+	return req.HTTPMethod == http.MethodOptions && headerValue(req.Headers, lcom.CORSRequestMethodHeaderKey) != ""
+}
+
+// addVary adds value to the Vary header of res unless it's already there.
+func addVary(res *events.APIGatewayProxyResponse, value string) {
+	vary := res.Headers[lcom.VaryHeaderKey]
+	for _, existing := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(existing), value) {
+			return
+		}
+	}
+
+	if vary == "" {
+		res.Headers[lcom.VaryHeaderKey] = value
+	} else {
+		res.Headers[lcom.VaryHeaderKey] = vary + ", " + value
+	}
+}
+
+// headerValue returns the value of the header key, ignoring the case of the
+// header names in headers.
+func headerValue(headers map[string]string, key string) string {
+	if value, ok := headers[key]; ok {
+		return value
+	}
+
+	for name, value := range headers {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+
+	return ""
+}
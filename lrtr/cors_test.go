@@ -0,0 +1,214 @@
+package lrtr
+
+import (
+	"context"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCORSPolicy(t *testing.T) {
+	t.Setenv(lcom.CORSOriginEnvKey, "*")
+	t.Setenv(lcom.CORSMethodsEnvKey, "GET,POST")
+	t.Setenv(lcom.CORSHeadersEnvKey, "*")
+
+	router := NewRouter("/api", tagMW("global")).CORS(&CORSPolicy{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowHeaders:     []string{"Authorization", "Content-Type"},
+		ExposeHeaders:    []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	router.Route(http.MethodGet, "/books", tagHandler, auth)
+	router.Route(http.MethodPost, "/books", tagHandler, auth)
+	router.Route(http.MethodGet, "/books/new", tagHandler, auth)
+	router.Route(http.MethodDelete, "/books/:id", tagHandler, auth)
+
+	public := router.Group("/public").CORS(&CORSPolicy{
+		AllowOrigins: []string{"*"},
+		AllowHeaders: []string{"*"},
+	})
+	public.Route(http.MethodGet, "/stats", tagHandler)
+
+	legacy := NewRouter("/api")
+	legacy.Route(http.MethodGet, "/books", tagHandler)
+
+	preflight := func(path, origin, method, headers string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodOptions,
+			Path:       path,
+			Headers: map[string]string{
+				"origin":                         origin,
+				"access-control-request-method":  method,
+				"access-control-request-headers": headers,
+			},
+		}
+	}
+
+	t.Run("preflight skips middleware and lists registered methods", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books", "https://app.example.com", http.MethodPost, "content-type, authorization"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://app.example.com", res.Headers[lcom.CORSOriginHeaderKey])
+		require.Equal(t, "GET, OPTIONS, POST", res.Headers[lcom.CORSMethodsHeaderKey])
+		require.Equal(t, "Authorization, Content-Type", res.Headers[lcom.CORSHeadersHeaderKey])
+		require.Equal(t, "3600", res.Headers[lcom.CORSMaxAgeHeaderKey])
+		require.Equal(t, "true", res.Headers[lcom.CORSCredentialsHeaderKey])
+		require.Equal(t, "Origin", res.Headers[lcom.VaryHeaderKey])
+		require.NotContains(t, res.Headers, lcom.CORSExposeHeadersHeaderKey)
+	})
+
+	t.Run("preflight matches origin patterns case insensitively", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books", "https://Admin.Example.org", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://Admin.Example.org", res.Headers[lcom.CORSOriginHeaderKey])
+	})
+
+	t.Run("preflight with unknown origin returns 403", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books", "https://evil.com", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+		require.NotContains(t, res.Headers, lcom.CORSOriginHeaderKey)
+		require.NotContains(t, res.Headers, lcom.CORSMethodsHeaderKey)
+	})
+
+	t.Run("preflight with unregistered method returns 403", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books", "https://app.example.com", http.MethodDelete, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("preflight matches the route serving the requested method", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books/new", "https://app.example.com", http.MethodDelete, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "DELETE, OPTIONS", res.Headers[lcom.CORSMethodsHeaderKey])
+
+		res, err = router.Handler(context.Background(), preflight("/api/books/new", "https://app.example.com", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "GET, OPTIONS", res.Headers[lcom.CORSMethodsHeaderKey])
+
+		res, err = router.Handler(context.Background(), preflight("/api/books/new", "https://app.example.com", http.MethodPut, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("preflight with disallowed header returns 403", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/books", "https://app.example.com", http.MethodGet, "X-Custom"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("preflight for unknown path returns 404", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/nope", "https://app.example.com", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+		require.Equal(t, "https://app.example.com", res.Headers[lcom.CORSOriginHeaderKey])
+		require.Equal(t, "Origin", res.Headers[lcom.VaryHeaderKey])
+		require.NotContains(t, res.Headers, lcom.CORSMethodsHeaderKey)
+	})
+
+	t.Run("plain OPTIONS still runs the OPTIONS handler", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodOptions,
+			Path:       "/api/books",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NotContains(t, res.Headers, lcom.CORSOriginHeaderKey)
+	})
+
+	t.Run("actual req echoes allowed origin", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books",
+			Headers: map[string]string{
+				lcom.OriginHeaderKey: "https://app.example.com",
+				"Authorization":      "Bearer fake-token",
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://app.example.com", res.Headers[lcom.CORSOriginHeaderKey])
+		require.Equal(t, "true", res.Headers[lcom.CORSCredentialsHeaderKey])
+		require.Equal(t, "X-Request-Id", res.Headers[lcom.CORSExposeHeadersHeaderKey])
+		require.Equal(t, "Origin", res.Headers[lcom.VaryHeaderKey])
+		require.NotContains(t, res.Headers, lcom.CORSMethodsHeaderKey)
+		require.NotContains(t, res.Headers, lcom.CORSHeadersHeaderKey)
+	})
+
+	t.Run("actual req from unknown origin gets no allow origin", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books",
+			Headers: map[string]string{
+				lcom.OriginHeaderKey: "https://evil.com",
+				"Authorization":      "Bearer fake-token",
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.NotContains(t, res.Headers, lcom.CORSOriginHeaderKey)
+		require.NotContains(t, res.Headers, lcom.CORSCredentialsHeaderKey)
+	})
+
+	t.Run("group policy overrides router policy", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), preflight("/api/public/stats", "https://anyone.net", http.MethodGet, "X-Custom"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://anyone.net", res.Headers[lcom.CORSOriginHeaderKey])
+		require.Equal(t, "X-Custom", res.Headers[lcom.CORSHeadersHeaderKey])
+		require.NotContains(t, res.Headers, lcom.CORSCredentialsHeaderKey)
+	})
+
+	t.Run("mounted routes keep their policy", func(t *testing.T) {
+		parent := NewRouter("")
+		parent.Mount("/v1", router)
+
+		res, err := parent.Handler(context.Background(), preflight("/v1/api/public/stats", "https://anyone.net", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, err = parent.Handler(context.Background(), preflight("/v1/api/books", "https://anyone.net", http.MethodGet, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("every origin with credentials panics", func(t *testing.T) {
+		wildcard := &CORSPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}
+		require.Panics(t, func() { NewRouter("/api").CORS(wildcard) })
+		require.Panics(t, func() { NewRouter("/api").Group("/public").CORS(wildcard) })
+	})
+
+	t.Run("routers without a policy keep using the env vars", func(t *testing.T) {
+		res, err := legacy.Handler(context.Background(), preflight("/api/books", "https://evil.com", http.MethodDelete, ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "*", res.Headers[lcom.CORSOriginHeaderKey])
+		require.NotContains(t, res.Headers, lcom.VaryHeaderKey)
+	})
+
+	t.Run("ServeHTTP skips env headers for routes with a policy", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(router.ServeHTTP))
+		defer ts.Close()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/public/stats", nil)
+		require.Nil(t, err)
+		req.Header.Set(lcom.OriginHeaderKey, "https://anyone.net")
+
+		res, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://anyone.net", res.Header.Get(lcom.CORSOriginHeaderKey))
+		require.Empty(t, res.Header.Get(lcom.CORSMethodsHeaderKey))
+	})
+}
@@ -0,0 +1,86 @@
+package lrtr
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerFunctionURL receives a context and a Lambda Function URL req, and
+// handles it exactly like Handler does for API Gateway reqs. Function URLs
+// use the same payload as API Gateway HTTP APIs, so the req is converted the
+// same way HandlerV2 converts it:
+//
+//	func main() {
+//	    lambda.Start(router.HandlerFunctionURL)
+//	}
+//
+// Function URL responses have no multi value headers, so any multi value
+// headers of the response are joined with commas, except for "Set-Cookie"
+// headers which are returned in the response's Cookies field.
+func (l *Router) HandlerFunctionURL(
+	ctx context.Context,
+	req events.LambdaFunctionURLRequest,
+) (events.LambdaFunctionURLResponse, error) {
+	res, err := l.Handler(ctx, proxyRequestFromFunctionURL(req))
+	if err != nil {
+		return events.LambdaFunctionURLResponse{}, err
+	}
+
+	return functionURLResponseFromProxy(res), nil
+}
+
+// proxyRequestFromFunctionURL converts a Function URL req into the
+// equivalent API Gateway req.
+func proxyRequestFromFunctionURL(req events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	return proxyRequestFromV2(events.APIGatewayV2HTTPRequest{
+		Version:               req.Version,
+		RawPath:               req.RawPath,
+		RawQueryString:        req.RawQueryString,
+		Cookies:               req.Cookies,
+		Headers:               req.Headers,
+		QueryStringParameters: req.QueryStringParameters,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			AccountID:    req.RequestContext.AccountID,
+			RequestID:    req.RequestContext.RequestID,
+			APIID:        req.RequestContext.APIID,
+			DomainName:   req.RequestContext.DomainName,
+			DomainPrefix: req.RequestContext.DomainPrefix,
+			Time:         req.RequestContext.Time,
+			TimeEpoch:    req.RequestContext.TimeEpoch,
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    req.RequestContext.HTTP.Method,
+				Path:      req.RequestContext.HTTP.Path,
+				Protocol:  req.RequestContext.HTTP.Protocol,
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	})
+}
+
+// functionURLResponseFromProxy converts an API Gateway response into the
+// equivalent Function URL response.
+func functionURLResponseFromProxy(res events.APIGatewayProxyResponse) events.LambdaFunctionURLResponse {
+	v2Res := v2ResponseFromProxy(res)
+
+	headers := v2Res.Headers
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+
+	for key, values := range v2Res.MultiValueHeaders {
+		headers[key] = strings.Join(values, ",")
+	}
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      v2Res.StatusCode,
+		Headers:         headers,
+		Body:            v2Res.Body,
+		IsBase64Encoded: v2Res.IsBase64Encoded,
+		Cookies:         v2Res.Cookies,
+	}
+}
@@ -0,0 +1,56 @@
+package lrtr
+
+import (
+	"context"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandlerFunctionURL(t *testing.T) {
+	lmd := NewRouter("/api")
+	lmd.Route(http.MethodGet, "/:id", adapterEcho)
+
+	t.Run("req and res are converted", func(t *testing.T) {
+		res, err := lmd.HandlerFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath:        "/api/fake-id",
+			RawQueryString: "terms=one&terms=two&search=a%20b",
+			Headers:        map[string]string{"accept-language": "en"},
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+					Method: http.MethodGet,
+					Path:   "/api/fake-id",
+				},
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []string{"a=1", "b=2"}, res.Cookies)
+		require.Equal(t, "application/json; charset=UTF-8", res.Headers["Content-Type"])
+		require.NotContains(t, res.Headers, "Set-Cookie")
+
+		var output adapterEchoReq
+		err = lres.Unmarshal(events.APIGatewayProxyResponse{Body: res.Body}, &output)
+		require.Nil(t, err)
+		require.Equal(t, "fake-id", output.ID)
+		require.Equal(t, []string{"one", "two"}, output.Terms)
+		require.Equal(t, "a b", output.Search)
+		require.Equal(t, []string{"en"}, output.Language)
+	})
+
+	t.Run("wrong method returns 405", func(t *testing.T) {
+		res, err := lmd.HandlerFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath: "/api/fake-id",
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+					Method: http.MethodDelete,
+				},
+			},
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	})
+}
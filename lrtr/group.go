@@ -0,0 +1,122 @@
+package lrtr
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+)
+
+// Group registers routes under a shared path prefix and middleware stack.
+// Groups are created with Router.Group or Group.Group and register their
+// routes directly on the owning Router. Group middleware runs after the
+// Router's global middleware and before each route's own middleware:
+//
+//	router = lrtr.NewRouter("/api", lmw.InjectLambdaContextMW)
+//
+//	books := router.Group("/books", lmw.DecodeStandardMW)
+//	books.Route(http.MethodGet, "/:id", books.GetLambda)
+//	books.Route(http.MethodPost, "/", books.CreateLambda, someOtherMiddleware)
+type Group struct {
+	router *Router
+	prefix string
+	cors   *CORSPolicy
+	hasMiddleware
+}
+
+// Group creates a new Group for all routes below prefix with zero or more
+// middleware functions that apply to each route registered through it.
+func (l *Router) Group(prefix string, middleware ...lcom.Middleware) *Group {
+	return &Group{
+		router: l,
+		prefix: prefix,
+		hasMiddleware: hasMiddleware{
+			middleware: middleware,
+		},
+	}
+}
+
+// Group creates a nested Group below the current one. The nested Group's
+// prefix is appended to the parent's, its middleware runs after the parent's
+// middleware and it inherits the parent's CORSPolicy.
+func (g *Group) Group(prefix string, middleware ...lcom.Middleware) *Group {
+	return &Group{
+		router: g.router,
+		prefix: joinPath(g.prefix, prefix),
+		cors:   g.cors,
+		hasMiddleware: hasMiddleware{
+			middleware: append(slices.Clone(g.middleware), middleware...),
+		},
+	}
+}
+
+// Route registers a new route below the Group's prefix, with the provided
+// HTTP method name and path, and zero or more local middleware functions.
+// Use Endpoint instead to document the route for OpenAPI.
+func (g *Group) Route(method, path string, handler lcom.Handler, middleware ...lcom.Middleware) {
+	g.Endpoint(method, path, handler, middleware...)
+}
+
+// Endpoint registers a new route like Route does and returns its Endpoint,
+// see Router.Endpoint.
+func (g *Group) Endpoint(method, path string, handler lcom.Handler, middleware ...lcom.Middleware) *Endpoint {
+	endpoint := &Endpoint{method: method}
+	r := g.router.addRoute(
+		method,
+		joinPath(g.prefix, path),
+		handler,
+		append(slices.Clone(g.middleware), middleware...),
+		endpoint,
+	)
+	if g.cors != nil {
+		r.cors = g.cors
+	}
+	endpoint.route = r
+
+	return endpoint
+}
+
+// Mount copies every route currently registered on sub into the Router below
+// prefix. The sub Router's base path is appended to prefix and its global
+// middleware runs between this Router's global middleware and each route's
+// own middleware, exactly as if sub's routes had been registered through a
+// Group. sub's CORSPolicy, if any, applies to the mounted routes. The
+// OPTIONS handlers added for CORS aren't copied; the mounted routes get
+// their own without any middleware. Routes registered on sub after Mount is
+// called are not picked up.
+func (l *Router) Mount(prefix string, sub *Router) {
+	prefix = joinPath(prefix, sub.basePath)
+
+	for _, r := range sub.tree.routes() {
+		policy := r.cors
+		if policy == nil {
+			policy = sub.cors
+		}
+
+		for method, res := range r.methods {
+			if res.autoOptions {
+				continue
+			}
+
+			mounted := l.addRoute(
+				method,
+				joinPath(prefix, r.path),
+				res.handler,
+				append(slices.Clone(sub.middleware), res.middleware...),
+				res.endpoint,
+			)
+			if policy != nil {
+				mounted.cors = policy
+			}
+		}
+	}
+}
+
+// joinPath joins a prefix and a path with exactly one "/" between them.
+func joinPath(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+}
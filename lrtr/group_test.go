@@ -0,0 +1,161 @@
+package lrtr
+
+import (
+	"context"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestGroup(t *testing.T) {
+	router := NewRouter("/api", tagMW("global"))
+
+	books := router.Group("/books", tagMW("books"))
+	books.Route(http.MethodGet, "/", tagHandler)
+	books.Route(http.MethodGet, "/:id", tagHandler, tagMW("route"))
+
+	pages := books.Group("/:id/pages", tagMW("pages"))
+	pages.Route(http.MethodGet, "/:page", tagHandler, tagMW("route"))
+
+	t.Run("group root", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "global,books", res.Body)
+	})
+
+	t.Run("group middleware runs between global and route middleware", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/123",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "global,books,route", res.Body)
+	})
+
+	t.Run("nested group", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/123/pages/7",
+		}
+		res, err := router.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, "global,books,pages,route", res.Body)
+
+		_, err = router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "123", req.PathParameters["id"])
+		require.Equal(t, "7", req.PathParameters["page"])
+	})
+
+	t.Run("unknown method in group returns 405", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodDelete,
+			Path:       "/api/books/123",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	})
+}
+
+func TestMount(t *testing.T) {
+	authors := NewRouter("/authors", tagMW("authors"))
+	authors.Route(http.MethodGet, "/", tagHandler)
+	authors.Route(http.MethodGet, "/:id", tagHandler, tagMW("route"))
+
+	router := NewRouter("/api", tagMW("global"))
+	router.Route(http.MethodGet, "/books", tagHandler)
+	router.Mount("/v1", authors)
+
+	t.Run("mounted routes use prefix and sub router base path", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/v1/authors",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "global,authors", res.Body)
+	})
+
+	t.Run("sub router middleware runs between global and route middleware", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/v1/authors/abc",
+		}
+		res, err := router.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, "global,authors,route", res.Body)
+
+		_, err = router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "abc", req.PathParameters["id"])
+	})
+
+	t.Run("existing routes are untouched", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "global", res.Body)
+	})
+
+	t.Run("mounted routes keep OPTIONS support", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodOptions,
+			Path:       "/api/v1/authors/abc",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("mounted OPTIONS handlers don't run the sub router middleware", func(t *testing.T) {
+		secured := NewRouter("/secured", func(lcom.Handler) lcom.Handler {
+			return func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return lres.StatusAndError(http.StatusUnauthorized, lcom.ErrNoAuthorizationHeader)
+			}
+		})
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+			secured.Route(method, "/:id", tagHandler)
+		}
+
+		parent := NewRouter("/api")
+		parent.Mount("/v1", secured)
+
+		res, err := parent.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodOptions,
+			Path:       "/api/v1/secured/abc",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}
+
+type tagKey struct{}
+
+// tagMW appends tag to the list of tags stored in the context so tests can
+// verify the order middleware executed in.
+func tagMW(tag string) lcom.Middleware {
+	return func(next lcom.Handler) lcom.Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			tags, _ := ctx.Value(tagKey{}).([]string)
+			return next(context.WithValue(ctx, tagKey{}, append(tags, tag)), req)
+		}
+	}
+}
+
+// tagHandler returns the tags collected by tagMW as the response body.
+func tagHandler(ctx context.Context, _ events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tags, _ := ctx.Value(tagKey{}).([]string)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       strings.Join(tags, ","),
+	}, nil
+}
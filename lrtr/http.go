@@ -25,20 +25,25 @@ func (l *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Query(),
 	)
 
-	corsHeaders := os.Getenv(lcom.CORSHeadersEnvKey)
-	corsMethods := os.Getenv(lcom.CORSMethodsEnvKey)
-	corsOrigins := os.Getenv(lcom.CORSOriginEnvKey)
-
-	if corsHeaders != "" {
-		w.Header().Set(lcom.CORSHeadersHeaderKey, corsHeaders)
-	}
+	// the CORS environment variables don't apply to routes with a CORSPolicy
+	probe := events.APIGatewayProxyRequest{HTTPMethod: r.Method, Path: r.URL.Path}
+	matchedRoute, _, _ := l.matchRoute(&probe)
+	if l.corsPolicy(matchedRoute) == nil {
+		corsHeaders := os.Getenv(lcom.CORSHeadersEnvKey)
+		corsMethods := os.Getenv(lcom.CORSMethodsEnvKey)
+		corsOrigins := os.Getenv(lcom.CORSOriginEnvKey)
+
+		if corsHeaders != "" {
+			w.Header().Set(lcom.CORSHeadersHeaderKey, corsHeaders)
+		}
 
-	if corsMethods != "" {
-		w.Header().Set(lcom.CORSMethodsHeaderKey, corsMethods)
-	}
+		if corsMethods != "" {
+			w.Header().Set(lcom.CORSMethodsHeaderKey, corsMethods)
+		}
 
-	if corsOrigins != "" {
-		w.Header().Set(lcom.CORSOriginHeaderKey, corsOrigins)
+		if corsOrigins != "" {
+			w.Header().Set(lcom.CORSOriginHeaderKey, corsOrigins)
+		}
 	}
 
 	body, err := io.ReadAll(r.Body)
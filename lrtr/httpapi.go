@@ -0,0 +1,156 @@
+package lrtr
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerV2 receives a context and an API Gateway HTTP API (payload format
+// version 2.0) req, and handles it exactly like Handler does for REST API
+// reqs. The req is converted to an events.APIGatewayProxyRequest before it
+// is matched, so the same routes, middleware, lreq.UnmarshalReq and lres
+// helpers work for both payload versions:
+//
+//	func main() {
+//	    lambda.Start(router.HandlerV2)
+//	}
+//
+// HTTP APIs send header names in lowercase. They are converted to their
+// canonical form (e.g. "authorization" becomes "Authorization") so header
+// lookups and `lambda:"header.X"` struct tags behave the same as they do for
+// REST APIs. Cookies are passed to handlers in the "Cookie" header and any
+// "Set-Cookie" headers of the response are returned in the response's
+// Cookies field as HTTP APIs expect.
+func (l *Router) HandlerV2(
+	ctx context.Context,
+	req events.APIGatewayV2HTTPRequest,
+) (events.APIGatewayV2HTTPResponse, error) {
+	res, err := l.Handler(ctx, proxyRequestFromV2(req))
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, err
+	}
+
+	return v2ResponseFromProxy(res), nil
+}
+
+// proxyRequestFromV2 converts an HTTP API req into the equivalent REST API
+// req.
+func proxyRequestFromV2(req events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+	headers := make(map[string]string, len(req.Headers))
+	multiHeaders := make(map[string][]string, len(req.Headers))
+	for key, value := range req.Headers {
+		key = http.CanonicalHeaderKey(key)
+		headers[key] = value
+		multiHeaders[key] = []string{value}
+	}
+
+	if len(req.Cookies) > 0 {
+		cookie := strings.Join(req.Cookies, "; ")
+		headers["Cookie"] = cookie
+		multiHeaders["Cookie"] = []string{cookie}
+	}
+
+	// HTTP APIs join repeated query parameters with commas in
+	// QueryStringParameters, so the raw query string is the only reliable
+	// source of multi value parameters
+	multiQuery, err := url.ParseQuery(req.RawQueryString)
+	if err != nil {
+		multiQuery = make(url.Values)
+		for key, value := range req.QueryStringParameters {
+			multiQuery[key] = []string{value}
+		}
+	}
+
+	return events.APIGatewayProxyRequest{
+		Resource:                        req.RouteKey,
+		Path:                            req.RawPath,
+		HTTPMethod:                      req.RequestContext.HTTP.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               multiHeaders,
+		QueryStringParameters:           convertMap(multiQuery),
+		MultiValueQueryStringParameters: multiQuery,
+		StageVariables:                  req.StageVariables,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:    req.RequestContext.AccountID,
+			Stage:        req.RequestContext.Stage,
+			DomainName:   req.RequestContext.DomainName,
+			DomainPrefix: req.RequestContext.DomainPrefix,
+			RequestID:    req.RequestContext.RequestID,
+			Protocol:     req.RequestContext.HTTP.Protocol,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+			ResourcePath:     req.RequestContext.RouteKey,
+			Path:             req.RequestContext.HTTP.Path,
+			Authorizer:       authorizerFromV2(req.RequestContext.Authorizer),
+			HTTPMethod:       req.RequestContext.HTTP.Method,
+			RequestTime:      req.RequestContext.Time,
+			RequestTimeEpoch: req.RequestContext.TimeEpoch,
+			APIID:            req.RequestContext.APIID,
+		},
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
+	}
+}
+
+// authorizerFromV2 flattens an HTTP API authorizer description into the map
+// REST APIs use. Lambda authorizer context values are copied as-is and JWT
+// authorizer claims are stored under "claims" like Cognito authorizers do.
+func authorizerFromV2(authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription) map[string]interface{} {
+	if authorizer == nil {
+		return nil
+	}
+
+	values := make(map[string]interface{})
+	for key, value := range authorizer.Lambda {
+		values[key] = value
+	}
+
+	if authorizer.JWT != nil {
+		values["claims"] = authorizer.JWT.Claims
+		values["scopes"] = authorizer.JWT.Scopes
+	}
+
+	return values
+}
+
+// v2ResponseFromProxy converts a REST API response into the equivalent HTTP
+// API response.
+func v2ResponseFromProxy(res events.APIGatewayProxyResponse) events.APIGatewayV2HTTPResponse {
+	v2Res := events.APIGatewayV2HTTPResponse{
+		StatusCode:      res.StatusCode,
+		Body:            res.Body,
+		IsBase64Encoded: res.IsBase64Encoded,
+	}
+
+	for key, value := range res.Headers {
+		if http.CanonicalHeaderKey(key) == "Set-Cookie" {
+			v2Res.Cookies = append(v2Res.Cookies, value)
+			continue
+		}
+
+		if v2Res.Headers == nil {
+			v2Res.Headers = make(map[string]string)
+		}
+		v2Res.Headers[key] = value
+	}
+
+	for key, values := range res.MultiValueHeaders {
+		if http.CanonicalHeaderKey(key) == "Set-Cookie" {
+			v2Res.Cookies = append(v2Res.Cookies, values...)
+			continue
+		}
+
+		if v2Res.MultiValueHeaders == nil {
+			v2Res.MultiValueHeaders = make(map[string][]string)
+		}
+		v2Res.MultiValueHeaders[key] = values
+	}
+
+	return v2Res
+}
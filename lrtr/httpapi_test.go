@@ -0,0 +1,104 @@
+package lrtr
+
+import (
+	"context"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lreq"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandlerV2(t *testing.T) {
+	type echoReq struct {
+		ID     string   `lambda:"path.id"`
+		Terms  []string `lambda:"query.terms"`
+		Cookie string   `lambda:"header.Cookie"`
+		Agent  string   `lambda:"header.User-Agent"`
+	}
+
+	echo := func(_ context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		var input echoReq
+		err := lreq.UnmarshalReq(req, false, &input)
+		if err != nil {
+			return lres.Error(err)
+		}
+
+		return lres.Custom(http.StatusOK, map[string]string{"Set-Cookie": "session=abc; HttpOnly"}, input)
+	}
+
+	lmd := NewRouter("/api", logger)
+	lmd.Route(http.MethodGet, "/:id", echo)
+	lmd.Route(http.MethodPost, "/", postSomething, auth)
+
+	newV2Req := func(method, path string) events.APIGatewayV2HTTPRequest {
+		return events.APIGatewayV2HTTPRequest{
+			RawPath: path,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				RequestID: "request-id",
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+					Method: method,
+					Path:   path,
+				},
+			},
+		}
+	}
+
+	t.Run("path, multi value query, lowercase headers and cookies", func(t *testing.T) {
+		req := newV2Req(http.MethodGet, "/api/fake-id")
+		req.RawQueryString = "terms=one&terms=two"
+		req.QueryStringParameters = map[string]string{"terms": "one,two"}
+		req.Headers = map[string]string{"user-agent": "tests"}
+		req.Cookies = []string{"a=1", "b=2"}
+
+		res, err := lmd.HandlerV2(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []string{"session=abc; HttpOnly"}, res.Cookies)
+		require.NotContains(t, res.Headers, "Set-Cookie")
+		require.Equal(t, "application/json; charset=UTF-8", res.Headers[lcom.ContentTypeKey])
+
+		var output echoReq
+		err = lres.Unmarshal(events.APIGatewayProxyResponse{Body: res.Body}, &output)
+		require.Nil(t, err)
+		require.Equal(t, "fake-id", output.ID)
+		require.Equal(t, []string{"one", "two"}, output.Terms)
+		require.Equal(t, "a=1; b=2", output.Cookie)
+		require.Equal(t, "tests", output.Agent)
+	})
+
+	t.Run("lowercase authorization header reaches middleware", func(t *testing.T) {
+		req := newV2Req(http.MethodPost, "/api")
+		req.Headers = map[string]string{"authorization": "Bearer fake-token"}
+		req.Body = `{"name":"bla"}`
+
+		res, err := lmd.HandlerV2(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+	})
+
+	t.Run("missing route returns 404", func(t *testing.T) {
+		res, err := lmd.HandlerV2(context.Background(), newV2Req(http.MethodGet, "/api/fake-id/nope"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("authorizer context is flattened", func(t *testing.T) {
+		req := newV2Req(http.MethodGet, "/api/fake-id")
+		req.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			Lambda: map[string]interface{}{"sub": "user"},
+			JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{
+				Claims: map[string]string{"email": "a@b.c"},
+			},
+		}
+
+		proxyReq := proxyRequestFromV2(req)
+		require.Equal(t, "user", proxyReq.RequestContext.Authorizer["sub"])
+		require.Equal(t, map[string]string{"email": "a@b.c"}, proxyReq.RequestContext.Authorizer["claims"])
+		require.Equal(t, http.MethodGet, proxyReq.HTTPMethod)
+		require.Equal(t, "request-id", proxyReq.RequestContext.RequestID)
+	})
+}
@@ -32,9 +32,24 @@
 //
 // * Supports all HTTP methods.
 //
-// * Supports middleware functions at a global and per-resource level.
+// * Supports middleware functions at a global, per-group and per-resource level.
+//
+// * Supports grouping routes under a shared prefix and middleware stack, and
+// mounting independently built routers into a bigger one.
 //
 // * Supports path parameters with a simple ":<name>" format (e.g. "/posts/:id").
+// Routes are matched segment by segment using a tree, so static segments
+// always take precedence over parameters (e.g. "/posts/new" wins over
+// "/posts/:id") regardless of the order in which they were registered.
+//
+// * Supports inline path parameter constraints, either as a regular
+// expression or as one of the named constraints int, uint, float, uuid and
+// objectid (e.g. "/posts/:id{[0-9a-f]{24}}" or "/posts/:page{int}"). A path
+// that doesn't satisfy the constraint doesn't match the route and results in
+// a 404. Constraints cannot contain "/".
+//
+// * Supports catch-all parameters as the last segment of a path (e.g.
+// "/files/*key"), which capture the rest of the path including slashes.
 //
 // * Provides ability to automatically "unmarshal" an API Gateway req to an
 // arbitrary Go struct, with data coming either from path and query string
@@ -46,6 +61,20 @@
 // API Gateway response (only JSON responses are currently generated). See the
 // Custom function for more information.
 //
+// * Generates an OpenAPI 3 document from the registered routes and the
+// request and response types attached to them. See the OpenAPI method for
+// more information.
+//
+// * Supports configurable CORS policies per router or per group, with an
+// origin allowlist, credentials, max-age and preflight reqs that are checked
+// against the methods registered for the path. See the CORSPolicy type for
+// more information.
+//
+// * Supports API Gateway HTTP APIs (payload format version 2.0) through the
+// HandlerV2 method, Application Load Balancer target groups through the
+// HandlerALB method and Lambda Function URLs through the HandlerFunctionURL
+// method, using the same routes, middleware and helpers.
+//
 //   - Implements net/http.Handler for local development and general usage outside
 //     an AWS Lambda environment.
 package lrtr
@@ -57,9 +86,8 @@ import (
 	"github.com/seantcanavan/lambda_jwt_router/lmw"
 	"github.com/seantcanavan/lambda_jwt_router/lres"
 	"net/http"
-	"net/url"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -74,18 +102,23 @@ type hasMiddleware struct {
 // the appropriate handler.
 type Router struct {
 	basePath string
-	routes   map[string]route
+	tree     *node
+	cors     *CORSPolicy
 	hasMiddleware
 }
 
 type route struct {
-	re         *regexp.Regexp
-	paramNames []string
-	methods    map[string]resource
+	path     string
+	segments []string
+	methods  map[string]resource
+	cors     *CORSPolicy
 }
 
 type resource struct {
-	handler lcom.Handler
+	handler  lcom.Handler
+	endpoint *Endpoint
+	// autoOptions marks the OPTIONS resource addRoute adds for CORS.
+	autoOptions bool
 	hasMiddleware
 }
 
@@ -98,7 +131,7 @@ type resource struct {
 func NewRouter(basePath string, middleware ...lcom.Middleware) (l *Router) {
 	return &Router{
 		basePath: basePath,
-		routes:   make(map[string]route),
+		tree:     newNode(),
 		hasMiddleware: hasMiddleware{
 			middleware: middleware,
 		},
@@ -106,61 +139,71 @@ func NewRouter(basePath string, middleware ...lcom.Middleware) (l *Router) {
 }
 
 // Route registers a new route, with the provided HTTP method name and path,
-// and zero or more local middleware functions.
+// and zero or more local middleware functions. Use Endpoint instead to
+// document the route for OpenAPI.
 func (l *Router) Route(method, path string, handler lcom.Handler, middleware ...lcom.Middleware) {
-	// check if this route already exists
-	r, ok := l.routes[path]
-	if !ok {
-		r = route{
-			methods: make(map[string]resource),
-		}
+	l.Endpoint(method, path, handler, middleware...)
+}
 
-		// create a regular expression from the path
-		var err error
-		re := fmt.Sprintf("^%s", l.basePath)
-		for _, part := range strings.Split(path, "/") {
-			if part == "" {
-				continue
-			}
+// Endpoint registers a new route like Route does and returns its Endpoint,
+// which documents the route for OpenAPI and can add middleware to it.
+func (l *Router) Endpoint(method, path string, handler lcom.Handler, middleware ...lcom.Middleware) *Endpoint {
+	endpoint := &Endpoint{method: method}
+	endpoint.route = l.addRoute(method, path, handler, middleware, endpoint)
 
-			// is this a parameter?
-			if strings.HasPrefix(part, ":") {
-				r.paramNames = append(r.paramNames, strings.TrimPrefix(part, ":"))
-				re = fmt.Sprintf("%s/([^/]+)", re)
-			} else {
-				re = fmt.Sprintf("%s/%s", re, part)
-			}
-		}
-		re = fmt.Sprintf("%s$", re)
+	return endpoint
+}
 
-		r.re, err = regexp.Compile(re)
-		if err != nil {
-			panic(fmt.Sprintf("Generated invalid regex for route %s", path))
+// addRoute registers handler for method and path and returns the route it was
+// added to. The middleware slice is stored as-is so callers such as groups
+// can prepend their own middleware before it reaches the resource.
+func (l *Router) addRoute(method, path string, handler lcom.Handler, middleware []lcom.Middleware, endpoint *Endpoint) *route {
+	// find the tree node for this path, creating it if this is the first
+	// method registered for the path
+	segments := splitPath(path)
+	n, err := l.tree.insert(segments)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid route %s: %s", path, err))
+	}
+	if n.route == nil {
+		n.route = &route{
+			path:     path,
+			segments: segments,
+			methods:  make(map[string]resource),
 		}
 	}
+	r := n.route
+
+	// "/:id" and "/:userId" share a tree node so they can't both be routes
+	if !slices.Equal(r.segments, segments) {
+		panic(fmt.Sprintf("Route %s conflicts with existing route %s", path, r.path))
+	}
 
 	// unless CORS is overridden - we place an options handler at the
-	// current route. If the new method/route is OPTIONS then the
-	// code after this will override it with a new OPTIONS handler. If
-	// this isn't an OPTIONS call, this will add support for CORS
-	// for that specific route. No middleware can be applied here
-	// for simplicity reasons as any middleware that performs
+	// current route if it doesn't have one yet. If the new method/route
+	// is OPTIONS then the code after this will override it with a new
+	// OPTIONS handler. If this isn't an OPTIONS call, this will add
+	// support for CORS for that specific route. No middleware can be
+	// applied here for simplicity reasons as any middleware that performs
 	// authentication or authorization on the main route will also
 	// apply here and prevent the CORS request from succeeding.
-	if os.Getenv(lcom.NoCORS) != "true" {
+	_, hasOptions := r.methods[http.MethodOptions]
+	if !hasOptions && os.Getenv(lcom.NoCORS) != "true" {
 		r.methods[http.MethodOptions] = resource{
-			handler: lmw.AllowOptionsMW(),
+			handler:     lmw.AllowOptionsMW(),
+			autoOptions: true,
 		}
 	}
 
 	r.methods[method] = resource{
-		handler: handler,
+		handler:  handler,
+		endpoint: endpoint,
 		hasMiddleware: hasMiddleware{
 			middleware: middleware,
 		},
 	}
 
-	l.routes[path] = r
+	return r
 }
 
 // Handler receives a context and an API Gateway Proxy req, and handles the
@@ -192,74 +235,114 @@ func (l *Router) Handler(
 	ctx context.Context,
 	req events.APIGatewayProxyRequest,
 ) (events.APIGatewayProxyResponse, error) {
-	matchedResource, err := l.matchReq(&req)
+	r, matchedResource, err := l.matchRoute(&req)
+
+	// preflight reqs are answered by the policy before any middleware runs
+	// so authentication middleware can't reject them
+	if isPreflightReq(req) {
+		if preflightRoute := l.preflightRoute(req); preflightRoute != nil {
+			if policy := l.corsPolicy(preflightRoute); policy != nil {
+				return policy.preflight(req, preflightRoute)
+			}
+		}
+	}
+
+	policy := l.corsPolicy(r)
+
+	var res events.APIGatewayProxyResponse
 	if err != nil {
-		return lres.Error(err)
+		res, err = lres.Error(err)
+	} else {
+		handler := matchedResource.handler
+
+		for i := len(matchedResource.middleware) - 1; i >= 0; i-- {
+			handler = matchedResource.middleware[i](handler)
+		}
+		for i := len(l.middleware) - 1; i >= 0; i-- {
+			handler = l.middleware[i](handler)
+		}
+
+		res, err = handler(ctx, req)
 	}
 
-	handler := matchedResource.handler
+	if policy != nil && err == nil {
+		policy.apply(req, &res)
+	}
 
-	for i := len(matchedResource.middleware) - 1; i >= 0; i-- {
-		handler = matchedResource.middleware[i](handler)
+	return res, err
+}
+
+// corsPolicy returns the CORSPolicy that applies to r, which is nil if no
+// path matched. A nil policy means the CORS environment variables are used.
+func (l *Router) corsPolicy(r *route) *CORSPolicy {
+	if r != nil && r.cors != nil {
+		return r.cors
 	}
-	for i := len(l.middleware) - 1; i >= 0; i-- {
-		handler = l.middleware[i](handler)
+
+	return l.cors
+}
+
+// preflightRoute returns the route serving the method a preflight req asks
+// for, or nil if no route matches its path. It isn't necessarily the route
+// that matched the OPTIONS req: every route has an OPTIONS handler, so a
+// static route like "/books/new" always wins over "/books/:id" for OPTIONS
+// even if only "/books/:id" serves DELETE.
+func (l *Router) preflightRoute(req events.APIGatewayProxyRequest) *route {
+	path, ok := strings.CutPrefix(strings.TrimSuffix(req.Path, "/"), l.basePath)
+	if !ok || (path != "" && path[0] != '/') {
+		return nil
 	}
 
-	return handler(ctx, req)
+	r, _ := l.tree.match(path, headerValue(req.Headers, lcom.CORSRequestMethodHeaderKey))
+
+	return r
 }
 
 func (l *Router) matchReq(req *events.APIGatewayProxyRequest) (
 	matchedResource resource,
 	err error,
+) {
+	_, matchedResource, err = l.matchRoute(req)
+	return matchedResource, err
+}
+
+// matchRoute matches req to a route and the resource for its method. The
+// route is returned whenever the path matched, even if the method is not
+// supported, so CORS preflight reqs can be answered for it.
+func (l *Router) matchRoute(req *events.APIGatewayProxyRequest) (
+	r *route,
+	matchedResource resource,
+	err error,
 ) {
 	// remove trailing slash from req path
 	req.Path = strings.TrimSuffix(req.Path, "/")
 
-	negErr := lres.HTTPError{
+	notFoundErr := lres.HTTPError{
 		Status:  http.StatusNotFound,
 		Message: "No such resource",
 	}
 
-	// find a route that matches the req
-	for _, r := range l.routes {
-		// does the path match?
-		matches := r.re.FindStringSubmatch(req.Path)
-		if matches == nil {
-			continue
-		}
-
-		// do we have this method?
-		var ok bool
-		matchedResource, ok = r.methods[req.HTTPMethod]
-		if !ok {
-			// we matched a route, but it didn't support this method. Mark negErr
-			// with a 405 error, but continue, we might match another route
-			negErr = lres.HTTPError{
-				Status:  http.StatusMethodNotAllowed,
-				Message: fmt.Sprintf("%s reqs not supported by this resource", req.HTTPMethod),
-			}
-			continue
-		}
-
-		// process path parameters
-		for i, param := range r.paramNames {
-			if len(matches)-1 < len(r.paramNames) {
-				return matchedResource, lres.HTTPError{
-					Status:  http.StatusInternalServerError,
-					Message: "Failed matching path parameters",
-				}
-			}
+	// the base path must be a whole prefix of the req path, "/api" should
+	// never match a req for "/apis"
+	path, ok := strings.CutPrefix(req.Path, l.basePath)
+	if !ok || (path != "" && path[0] != '/') {
+		return nil, matchedResource, notFoundErr
+	}
 
-			if req.PathParameters == nil {
-				req.PathParameters = make(map[string]string)
-			}
+	r, found := l.tree.match(path, req.HTTPMethod)
+	if r == nil {
+		return nil, matchedResource, notFoundErr
+	}
 
-			req.PathParameters[param], _ = url.QueryUnescape(matches[i+1])
+	if !found {
+		// we matched a route, but it didn't support this method
+		return r, matchedResource, lres.HTTPError{
+			Status:  http.StatusMethodNotAllowed,
+			Message: fmt.Sprintf("%s reqs not supported by this resource", req.HTTPMethod),
 		}
-
-		return matchedResource, nil
 	}
 
-	return matchedResource, negErr
+	r.pathParams(path, req)
+
+	return r, r.methods[req.HTTPMethod], nil
 }
@@ -29,41 +29,33 @@ func TestRouter(t *testing.T) {
 
 	t.Run("Routes created correctly", func(t *testing.T) {
 		t.Run("/", func(t *testing.T) {
-			route, ok := lmd.routes["/"]
-			require.True(t, ok, "Route must be created")
-			if ok {
-				require.Equal(t, `^/api$`, route.re.String(), "Regex must be correct")
-				require.NotEqual(t, nil, route.methods[http.MethodGet], "GET method must exist")
-				require.NotEqual(t, nil, route.methods[http.MethodPost], "POST method must exist")
-				require.NotEqual(t, nil, route.methods[http.MethodOptions], "OPTIONS method must exist") // auto generated for CORS support
-			}
+			route := lmd.tree.route
+			require.NotNil(t, route, "Route must be created")
+			require.Empty(t, route.segments, "Segments must be correct")
+			require.Contains(t, route.methods, http.MethodGet, "GET method must exist")
+			require.Contains(t, route.methods, http.MethodPost, "POST method must exist")
+			require.Contains(t, route.methods, http.MethodOptions, "OPTIONS method must exist") // auto generated for CORS support
 		})
 		t.Run("/:id", func(t *testing.T) {
-			route, ok := lmd.routes["/:id"]
-			require.True(t, ok, "Route must be created")
-			if ok {
-				require.Equal(t, `^/api/([^/]+)$`, route.re.String(), "Regex must be correct")
-				require.NotEqual(t, nil, route.methods[http.MethodGet], "GET method must exist")
-				require.NotEqual(t, nil, route.methods[http.MethodOptions], "OPTIONS method must exist") // auto generated for CORS support
-			}
+			require.Len(t, lmd.tree.params, 1, "Param node must be created")
+			route := lmd.tree.params[0].route
+			require.NotNil(t, route, "Route must be created")
+			require.Equal(t, []string{":id"}, route.segments, "Segments must be correct")
+			require.Contains(t, route.methods, http.MethodGet, "GET method must exist")
+			require.Contains(t, route.methods, http.MethodOptions, "OPTIONS method must exist") // auto generated for CORS support
 		})
 		t.Run("/:id/stuff/:fake", func(t *testing.T) {
-			route, ok := lmd.routes["/:id/stuff/:fake"]
-			require.True(t, ok, "Route must be created")
-			if ok {
-				require.Equal(
-					t,
-					`^/api/([^/]+)/stuff/([^/]+)$`,
-					route.re.String(),
-					"Regex must be correct",
-				)
-				require.EqualValues(
-					t,
-					[]string{"id", "fake"},
-					route.paramNames,
-					"Param names must be correct",
-				)
-			}
+			stuff, ok := lmd.tree.params[0].static["stuff"]
+			require.True(t, ok, "Static node must be created")
+			require.Len(t, stuff.params, 1, "Param node must be created")
+			route := stuff.params[0].route
+			require.NotNil(t, route, "Route must be created")
+			require.Equal(
+				t,
+				[]string{":id", "stuff", ":fake"},
+				route.segments,
+				"Segments must be correct",
+			)
 		})
 	})
 
@@ -123,6 +115,19 @@ func TestRouter(t *testing.T) {
 			require.Equal(t, http.StatusNotFound, httpErr.Status, "Error code must be 404")
 		})
 
+		t.Run("GET /apis", func(t *testing.T) {
+			// the base path must match a whole segment
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodGet,
+				Path:       "/apis",
+			}
+			_, err := lmd.matchReq(&req)
+			var httpErr lres.HTTPError
+			ok := errors.As(err, &httpErr)
+			require.True(t, ok, "Error must be an HTTP error")
+			require.Equal(t, http.StatusNotFound, httpErr.Status, "Error code must be 404")
+		})
+
 		t.Run("GET /api/fake-id/stuff/faked-fake", func(t *testing.T) {
 			req := events.APIGatewayProxyRequest{
 				HTTPMethod: http.MethodGet,
@@ -203,18 +208,20 @@ func TestRouter(t *testing.T) {
 			},
 		)
 
-		// call POST /foo/bar in a loop. We do this because the router iterates
-		// over a map to match routes, which is non-deterministic, meaning
-		// sometimes we may match the route and sometimes not
-		for i := 1; i <= 10; i++ {
-			res, _ := router.Handler(context.Background(), events.APIGatewayProxyRequest{
-				HTTPMethod: http.MethodPost,
-				Path:       "/foo/bar",
-			})
-			require.Equal(t, "/foo/bar", res.Body, "req must match /foo/bar route")
-		}
-
 		res, _ := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Path:       "/foo/bar",
+		})
+		require.Equal(t, "/foo/bar", res.Body, "req must match /foo/bar route")
+
+		// the static route doesn't support GET so we fall back to the param route
+		res, _ = router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/foo/bar",
+		})
+		require.Equal(t, "/foo/:id", res.Body, "req must match /foo/:id route")
+
+		res, _ = router.Handler(context.Background(), events.APIGatewayProxyRequest{
 			HTTPMethod: http.MethodDelete,
 			Path:       "/foo/bar",
 		})
@@ -228,6 +235,181 @@ func TestRouter(t *testing.T) {
 	})
 }
 
+func TestRouterStaticPrecedence(t *testing.T) {
+	bodyHandler := func(body string) lcom.Handler {
+		return func(_ context.Context, _ events.APIGatewayProxyRequest) (res events.APIGatewayProxyResponse, err error) {
+			res.Body = body
+			return res, nil
+		}
+	}
+
+	// register the param routes first to make sure registration order doesn't matter
+	router := NewRouter("/api")
+	router.Route(http.MethodGet, "/books/:id", bodyHandler("/books/:id"))
+	router.Route(http.MethodGet, "/books/:id/pages", bodyHandler("/books/:id/pages"))
+	router.Route(http.MethodGet, "/books/new", bodyHandler("/books/new"))
+	router.Route(http.MethodGet, "/books/new/:page", bodyHandler("/books/new/:page"))
+
+	t.Run("static segment wins over param", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodGet,
+				Path:       "/api/books/new",
+			})
+			require.Nil(t, err)
+			require.Equal(t, "/books/new", res.Body)
+		}
+	})
+
+	t.Run("param matches other values", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/abc",
+		}
+		_, err := router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "abc", req.PathParameters["id"])
+	})
+
+	t.Run("backtracks into param when static branch dead-ends", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/new/pages",
+		}
+		res, err := router.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, "/books/new/:page", res.Body)
+
+		req.Path = "/api/books/abc/pages"
+		_, err = router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "abc", req.PathParameters["id"])
+	})
+
+	t.Run("matching does not allocate", func(t *testing.T) {
+		allocs := testing.AllocsPerRun(100, func() {
+			router.tree.match("/books/abc/pages", http.MethodGet)
+		})
+		require.Equal(t, float64(0), allocs)
+	})
+
+	t.Run("conflicting param names panic", func(t *testing.T) {
+		require.Panics(t, func() {
+			router.Route(http.MethodPost, "/books/:bookId", bodyHandler("/books/:bookId"))
+		})
+	})
+}
+
+func TestRouterCatchAllAndConstraints(t *testing.T) {
+	bodyHandler := func(body string) lcom.Handler {
+		return func(_ context.Context, _ events.APIGatewayProxyRequest) (res events.APIGatewayProxyResponse, err error) {
+			res.Body = body
+			return res, nil
+		}
+	}
+
+	router := NewRouter("/api")
+	router.Route(http.MethodGet, "/books/:id{objectid}", bodyHandler("/books/:id{objectid}"))
+	router.Route(http.MethodGet, "/books/:id{objectid}/pages/:page{int}", bodyHandler("/books/:id{objectid}/pages/:page{int}"))
+	router.Route(http.MethodGet, "/authors/:slug", bodyHandler("/authors/:slug"))
+	router.Route(http.MethodGet, "/authors/:id{[0-9]{3}}", bodyHandler("/authors/:id{[0-9]{3}}"))
+	router.Route(http.MethodGet, "/files/*key", bodyHandler("/files/*key"))
+	router.Route(http.MethodPut, "/files/*key", bodyHandler("/files/*key"))
+	router.Route(http.MethodGet, "/files/readme", bodyHandler("/files/readme"))
+
+	t.Run("constraint match", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/65a1b2c3d4e5f60718293a4b/pages/12",
+		}
+		res, err := router.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, "/books/:id{objectid}/pages/:page{int}", res.Body)
+
+		_, err = router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "65a1b2c3d4e5f60718293a4b", req.PathParameters["id"])
+		require.Equal(t, "12", req.PathParameters["page"])
+	})
+
+	t.Run("constraint mismatch returns 404", func(t *testing.T) {
+		for _, path := range []string{"/api/books/not-an-object-id", "/api/books/65a1b2c3d4e5f60718293a4b/pages/one"} {
+			res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodGet,
+				Path:       path,
+			})
+			require.Nil(t, err)
+			require.Equal(t, http.StatusNotFound, res.StatusCode, path)
+		}
+	})
+
+	t.Run("constrained param is tried before unconstrained param", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/authors/123",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "/authors/:id{[0-9]{3}}", res.Body)
+
+		res, err = router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/authors/1234",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "/authors/:slug", res.Body)
+	})
+
+	t.Run("catch-all captures slashes", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPut,
+			Path:       "/api/files/photos/2024/cat.png",
+		}
+		res, err := router.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, "/files/*key", res.Body)
+
+		_, err = router.matchReq(&req)
+		require.Nil(t, err)
+		require.Equal(t, "photos/2024/cat.png", req.PathParameters["key"])
+	})
+
+	t.Run("static wins over catch-all", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/files/readme",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "/files/readme", res.Body)
+	})
+
+	t.Run("catch-all requires a value", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/files",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("catch-all keeps 405 semantics", func(t *testing.T) {
+		res, err := router.Handler(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodDelete,
+			Path:       "/api/files/a/b",
+		})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	})
+
+	t.Run("invalid routes panic", func(t *testing.T) {
+		require.Panics(t, func() {
+			router.Route(http.MethodGet, "/files/*key/meta", bodyHandler(""))
+		})
+		require.Panics(t, func() {
+			router.Route(http.MethodGet, "/books/:id{[0-9}", bodyHandler(""))
+		})
+	})
+}
+
 func listSomethings(_ context.Context, req events.APIGatewayProxyRequest) (
 	res events.APIGatewayProxyResponse,
 	err error,
@@ -0,0 +1,599 @@
+package lrtr
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bearerAuthScheme is the name of the security scheme added to routes that
+// decode a JWT from the Authorization header.
+const bearerAuthScheme = "bearerAuth"
+
+// httpErrorSchema is the name of the lres.HTTPError schema every operation
+// uses for its error responses.
+const httpErrorSchema = "HTTPError"
+
+// Endpoint is returned by Router.Endpoint and Group.Endpoint and is used to
+// document the route for OpenAPI. All of its methods return the Endpoint so
+// calls can be chained:
+//
+//	router.Endpoint(http.MethodGet, "/books/:id", books.GetLambda).
+//	    Summary("Get a book").
+//	    Request(books.GetReq{}).
+//	    Response(http.StatusOK, books.Book{})
+type Endpoint struct {
+	summary     string
+	description string
+	tags        []string
+	request     reflect.Type
+	responses   map[int]reflect.Type
+	scopes      []string
+	secured     bool
+
+	// route and method locate the resource Use adds middleware to.
+	route  *route
+	method string
+}
+
+// Summary sets the short summary of the route.
+func (e *Endpoint) Summary(summary string) *Endpoint {
+	e.summary = summary
+	return e
+}
+
+// Description sets the long description of the route.
+func (e *Endpoint) Description(description string) *Endpoint {
+	e.description = description
+	return e
+}
+
+// Tags sets the tags used to group the route in the generated document.
+func (e *Endpoint) Tags(tags ...string) *Endpoint {
+	e.tags = tags
+	return e
+}
+
+// Request sets the type the route's handler passes to lreq.UnmarshalReq.
+// Fields with a "lambda" struct tag are documented as path, query or header
+// parameters and all other fields are documented as the JSON request body.
+func (e *Endpoint) Request(req any) *Endpoint {
+	e.request = reflect.TypeOf(req)
+	return e
+}
+
+// Response sets the type the route's handler returns as the JSON body for
+// the given HTTP status. It can be called once per status.
+func (e *Endpoint) Response(status int, res any) *Endpoint {
+	if e.responses == nil {
+		e.responses = make(map[int]reflect.Type)
+	}
+	e.responses[status] = reflect.TypeOf(res)
+	return e
+}
+
+// Secured marks the route as requiring a Bearer JWT. Middleware are opaque
+// funcs, so routes using a decode middleware passed to Route or Endpoint
+// have to be marked, or register it with Authenticate instead.
+func (e *Endpoint) Secured() *Endpoint {
+	e.secured = true
+	return e
+}
+
+// Scopes records OAuth 2.0 scopes the route requires and marks it as
+// Secured. They are listed in the operation's "x-scopes" extension along with
+// its 403 response. RequireScopes and RequireAnyScope record their scopes
+// themselves, so only use it for scopes checked elsewhere, such as in the
+// handler.
+func (e *Endpoint) Scopes(scopes ...string) *Endpoint {
+	for _, scope := range scopes {
+		if !slices.Contains(e.scopes, scope) {
+			e.scopes = append(e.scopes, scope)
+		}
+	}
+	e.secured = true
+	return e
+}
+
+// Use adds middleware to the route, running after the middleware it was
+// registered with. Call it before the route's Router is mounted.
+func (e *Endpoint) Use(middleware ...lcom.Middleware) *Endpoint {
+	res := e.route.methods[e.method]
+	res.middleware = append(slices.Clone(res.middleware), middleware...)
+	e.route.methods[e.method] = res
+	return e
+}
+
+// Authenticate adds the decode middleware mw, such as lmw.DecodeStandardMW
+// or a middleware from lmw.NewDecodeExpandedMW, to the route and marks it as
+// Secured:
+//
+//	router.Endpoint(http.MethodDelete, "/books/:id", books.DeleteLambda).
+//	    Authenticate(lmw.DecodeStandardMW).
+//	    RequireScopes("books:write")
+func (e *Endpoint) Authenticate(mw lcom.Middleware) *Endpoint {
+	return e.Use(mw).Secured()
+}
+
+// RequireScopes adds lmw.RequireScopes(scopes...) to the route and records
+// scopes like Scopes does. It must come after Authenticate.
+func (e *Endpoint) RequireScopes(scopes ...string) *Endpoint {
+	return e.Use(lmw.RequireScopes(scopes...)).Scopes(scopes...)
+}
+
+// RequireAnyScope adds lmw.RequireAnyScope(scopes...) to the route and
+// records scopes like Scopes does. It must come after Authenticate.
+func (e *Endpoint) RequireAnyScope(scopes ...string) *Endpoint {
+	return e.Use(lmw.RequireAnyScope(scopes...)).Scopes(scopes...)
+}
+
+// OpenAPIDocument is the root of an OpenAPI 3 document. It can be marshalled
+// to JSON as-is.
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+// OpenAPIInfo describes the API.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIServer is a URL the API is served from.
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem maps lowercase HTTP methods to the operation for a path.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation describes a single method of a path.
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Scopes      []string                   `json:"x-scopes,omitempty"`
+}
+
+// OpenAPIParameter describes a single path, query or header parameter.
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody describes the body of a req.
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes a single response of an operation.
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a req or response body.
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema is the subset of the JSON schema OpenAPI uses that can be
+// generated from Go types.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPIComponents holds the reusable schemas and security schemes.
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpenAPISecurityScheme describes how requests are authenticated.
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// OpenAPI generates an OpenAPI 3 document for every route registered on the
+// Router. Request and response types attached to routes through their
+// Endpoint are used to document parameters and bodies, and every operation
+// documents lres.HTTPError as its error response. The document's Info has a
+// placeholder title and version which callers are expected to overwrite:
+//
+//	doc := router.OpenAPI()
+//	doc.Info = lrtr.OpenAPIInfo{Title: "Books API", Version: "1.2.0"}
+//	jsonBytes, err := json.Marshal(doc)
+func (l *Router) OpenAPI() *OpenAPIDocument {
+	gen := &schemaGenerator{
+		schemas: make(map[string]*OpenAPISchema),
+		names:   make(map[reflect.Type]string),
+	}
+
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:   "API",
+			Version: "1.0.0",
+		},
+		Paths: make(map[string]OpenAPIPathItem),
+		Components: OpenAPIComponents{
+			Schemas: gen.schemas,
+		},
+	}
+
+	gen.schemas[httpErrorSchema] = gen.structSchema(reflect.TypeOf(lres.HTTPError{}), false)
+
+	for _, r := range l.tree.routes() {
+		path := l.openAPIPath(r)
+
+		for method, res := range r.methods {
+			// skip the auto generated CORS handlers
+			if method == http.MethodOptions && res.endpoint == nil {
+				continue
+			}
+
+			op := gen.operation(method, r, res)
+			if len(op.Security) > 0 && doc.Components.SecuritySchemes == nil {
+				doc.Components.SecuritySchemes = map[string]OpenAPISecurityScheme{
+					bearerAuthScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				}
+			}
+
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(OpenAPIPathItem)
+			}
+			doc.Paths[path][strings.ToLower(method)] = op
+		}
+	}
+
+	return doc
+}
+
+// openAPIPath converts a route path such as "/books/:id{int}" into the
+// OpenAPI form "/api/books/{id}".
+func (l *Router) openAPIPath(r *route) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(l.basePath, "/"))
+
+	for _, segment := range r.segments {
+		sb.WriteString("/")
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			sb.WriteString("{" + strings.TrimPrefix(segment, "*") + "}")
+		case strings.HasPrefix(segment, ":"):
+			name, _ := parseParam(segment)
+			sb.WriteString("{" + name + "}")
+		default:
+			sb.WriteString(segment)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return "/"
+	}
+
+	return sb.String()
+}
+
+// schemaGenerator converts Go types to OpenAPI schemas. Named struct types
+// are added to schemas once and referenced everywhere else.
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) operation(method string, r *route, res resource) *OpenAPIOperation {
+	endpoint := res.endpoint
+	if endpoint == nil {
+		endpoint = &Endpoint{}
+	}
+
+	op := &OpenAPIOperation{
+		Summary:     endpoint.summary,
+		Description: endpoint.description,
+		Tags:        endpoint.tags,
+		Responses:   make(map[string]OpenAPIResponse),
+	}
+
+	declared := make(map[string]bool)
+	if endpoint.request != nil {
+		reqType := derefType(endpoint.request)
+		if reqType.Kind() == reflect.Struct {
+			op.Parameters = g.parameters(reqType)
+			for _, param := range op.Parameters {
+				if param.In == "path" {
+					declared[param.Name] = true
+				}
+			}
+
+			body := g.structSchema(reqType, true)
+			if len(body.Properties) > 0 && methodHasBody(method) {
+				op.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content:  jsonContent(body),
+				}
+			}
+		}
+	}
+
+	// OpenAPI requires every path template parameter to be declared so
+	// declare the ones the request type doesn't using the route's constraint
+	for _, segment := range r.segments {
+		var name, pattern string
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			name = strings.TrimPrefix(segment, "*")
+		case strings.HasPrefix(segment, ":"):
+			name, pattern = parseParam(segment)
+		default:
+			continue
+		}
+
+		if declared[name] {
+			continue
+		}
+
+		op.Parameters = append(op.Parameters, OpenAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   constraintSchema(pattern),
+		})
+	}
+
+	for status, resType := range endpoint.responses {
+		op.Responses[strconv.Itoa(status)] = OpenAPIResponse{
+			Description: http.StatusText(status),
+			Content:     jsonContent(g.schema(resType)),
+		}
+	}
+
+	if len(endpoint.responses) == 0 {
+		op.Responses[strconv.Itoa(http.StatusOK)] = OpenAPIResponse{
+			Description: http.StatusText(http.StatusOK),
+		}
+	}
+
+	errRef := &OpenAPISchema{Ref: "#/components/schemas/" + httpErrorSchema}
+	op.Responses["default"] = OpenAPIResponse{
+		Description: "Error",
+		Content:     jsonContent(errRef),
+	}
+
+	if endpoint.secured {
+		op.Security = []map[string][]string{{bearerAuthScheme: {}}}
+		op.Responses[strconv.Itoa(http.StatusUnauthorized)] = OpenAPIResponse{
+			Description: http.StatusText(http.StatusUnauthorized),
+			Content:     jsonContent(errRef),
+		}
+	}
+
+	if len(endpoint.scopes) > 0 {
+		op.Scopes = endpoint.scopes
+		op.Responses[strconv.Itoa(http.StatusForbidden)] = OpenAPIResponse{
+			Description: http.StatusText(http.StatusForbidden),
+			Content:     jsonContent(errRef),
+		}
+	}
+
+	return op
+}
+
+// parameters documents every field of t with a "lambda" struct tag.
+func (g *schemaGenerator) parameters(t reflect.Type) []OpenAPIParameter {
+	var params []OpenAPIParameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		components := strings.Split(field.Tag.Get("lambda"), ".")
+		if len(components) != 2 {
+			continue
+		}
+
+		params = append(params, OpenAPIParameter{
+			Name:     components[1],
+			In:       components[0],
+			Required: components[0] == "path",
+			Schema:   g.schema(field.Type),
+		})
+	}
+
+	return params
+}
+
+// schema returns the schema for t, referencing named struct types through
+// the components.
+func (g *schemaGenerator) schema(t reflect.Type) *OpenAPISchema {
+	if t == nil {
+		return &OpenAPISchema{}
+	}
+
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+	}
+
+	var s *OpenAPISchema
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		s = &OpenAPISchema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(civil.Date{}):
+		s = &OpenAPISchema{Type: "string", Format: "date"}
+	case reflect.TypeOf(primitive.ObjectID{}):
+		s = &OpenAPISchema{Type: "string", Pattern: "^[0-9a-fA-F]{24}$"}
+	}
+
+	if s == nil {
+		switch t.Kind() {
+		case reflect.String:
+			s = &OpenAPISchema{Type: "string"}
+		case reflect.Bool:
+			s = &OpenAPISchema{Type: "boolean"}
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			s = &OpenAPISchema{Type: "integer", Format: "int64"}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			s = &OpenAPISchema{Type: "integer", Format: "int32"}
+		case reflect.Float32:
+			s = &OpenAPISchema{Type: "number", Format: "float"}
+		case reflect.Float64:
+			s = &OpenAPISchema{Type: "number", Format: "double"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				s = &OpenAPISchema{Type: "string", Format: "byte"}
+			} else {
+				s = &OpenAPISchema{Type: "array", Items: g.schema(t.Elem())}
+			}
+		case reflect.Map:
+			s = &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+		case reflect.Struct:
+			s = g.structRef(t)
+		default:
+			s = &OpenAPISchema{}
+		}
+	}
+
+	s.Nullable = nullable && s.Ref == ""
+
+	return s
+}
+
+// structRef adds the schema of a named struct to the components and returns
+// a reference to it. Anonymous structs are returned inline.
+func (g *schemaGenerator) structRef(t reflect.Type) *OpenAPISchema {
+	if t.Name() == "" {
+		return g.structSchema(t, false)
+	}
+
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			name = strings.ReplaceAll(t.String(), ".", "_")
+		}
+
+		// register the name before generating the schema so recursive types
+		// reference themselves instead of recursing forever
+		g.names[t] = name
+		g.schemas[name] = &OpenAPISchema{}
+		*g.schemas[name] = *g.structSchema(t, false)
+	}
+
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema returns the inline object schema for t using the same field
+// names encoding/json uses. If bodyOnly is true then fields with a "lambda"
+// struct tag are skipped, which gives the schema of a request body.
+func (g *schemaGenerator) structSchema(t reflect.Type, bodyOnly bool) *OpenAPISchema {
+	s := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if bodyOnly && field.Tag.Get("lambda") != "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// promote the fields of embedded structs like encoding/json does
+		if field.Anonymous && name == "" && derefType(field.Type).Kind() == reflect.Struct {
+			for key, value := range g.structSchema(derefType(field.Type), bodyOnly).Properties {
+				if _, ok := s.Properties[key]; !ok {
+					s.Properties[key] = value
+				}
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = g.schema(field.Type)
+	}
+
+	return s
+}
+
+// constraintSchema returns the schema for a path parameter with the given
+// inline constraint.
+func constraintSchema(pattern string) *OpenAPISchema {
+	switch pattern {
+	case "":
+		return &OpenAPISchema{Type: "string"}
+	case "int", "uint":
+		return &OpenAPISchema{Type: "integer"}
+	case "float":
+		return &OpenAPISchema{Type: "number"}
+	case "uuid":
+		return &OpenAPISchema{Type: "string", Format: "uuid"}
+	}
+
+	if expr, ok := paramConstraints[pattern]; ok {
+		pattern = expr
+	}
+
+	return &OpenAPISchema{Type: "string", Pattern: fmt.Sprintf("^(?:%s)$", pattern)}
+}
+
+func jsonContent(schema *OpenAPISchema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
+
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return false
+	}
+
+	return true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
@@ -0,0 +1,201 @@
+package lrtr
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/internal/util"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lmw"
+	"github.com/seantcanavan/lambda_jwt_router/lmw/ljwt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	type listReq struct {
+		Page     int64    `lambda:"query.page"`
+		Terms    []string `lambda:"query.terms"`
+		Language string   `lambda:"header.Accept-Language"`
+	}
+
+	verifier, err := ljwt.NewVerifier(ljwt.WithHMACSecret([]byte("secret")))
+	require.Nil(t, err)
+
+	lmd := NewRouter("/api", logger)
+	lmd.Endpoint(http.MethodGet, "/", listSomethings).
+		Summary("List somethings").
+		Tags("somethings").
+		Request(listReq{}).
+		Response(http.StatusOK, []util.MockItem{})
+	lmd.Endpoint(http.MethodPost, "/:id", postSomething).
+		Authenticate(lmw.DecodeStandardMW).
+		Request(&util.MockPostReq{}).
+		Response(http.StatusAccepted, map[string]string{})
+	lmd.Endpoint(http.MethodGet, "/:id", getSomething).
+		Request(util.MockGetReq{}).
+		Response(http.StatusOK, util.MockItem{})
+	lmd.Endpoint(http.MethodGet, "/:id/pages/:page{int}", getSomething).
+		Authenticate(lmw.NewDecodeStandardMW(verifier))
+	lmd.Group("/secure", lmw.DecodeExpandedMW).
+		Endpoint(http.MethodDelete, "/*key", getSomething).
+		Secured().
+		RequireAnyScope("items:admin", "items:write").
+		Scopes("items:write", "items:audit")
+	lmd.Endpoint(http.MethodPut, "/:id", getSomething).
+		Authenticate(lmw.DecodeClaimsMW[util.MockItem]())
+	lmd.Route(http.MethodPatch, "/:id", getSomething, lmw.DecodeStandardMW)
+	lmd.Endpoint(http.MethodDelete, "/:id", getSomething).
+		Authenticate(lmw.DecodeStandardMW).
+		RequireScopes("items:write", "items:delete")
+
+	doc := lmd.OpenAPI()
+
+	t.Run("document marshals to JSON", func(t *testing.T) {
+		jsonBytes, err := json.Marshal(doc)
+		require.Nil(t, err)
+		require.Contains(t, string(jsonBytes), `"openapi":"3.0.3"`)
+	})
+
+	t.Run("paths are converted and auto OPTIONS routes are skipped", func(t *testing.T) {
+		require.Len(t, doc.Paths, 4)
+		require.Contains(t, doc.Paths, "/api")
+		require.Contains(t, doc.Paths, "/api/{id}")
+		require.Contains(t, doc.Paths, "/api/{id}/pages/{page}")
+		require.Contains(t, doc.Paths, "/api/secure/{key}")
+		require.NotContains(t, doc.Paths["/api"], "options")
+	})
+
+	t.Run("query and header parameters come from lambda tags", func(t *testing.T) {
+		op := doc.Paths["/api"]["get"]
+		require.Equal(t, "List somethings", op.Summary)
+		require.Equal(t, []string{"somethings"}, op.Tags)
+		require.Nil(t, op.RequestBody)
+		require.Equal(t, []OpenAPIParameter{
+			{Name: "page", In: "query", Schema: &OpenAPISchema{Type: "integer", Format: "int64"}},
+			{Name: "terms", In: "query", Schema: &OpenAPISchema{Type: "array", Items: &OpenAPISchema{Type: "string"}}},
+			{Name: "Accept-Language", In: "header", Schema: &OpenAPISchema{Type: "string"}},
+		}, op.Parameters)
+
+		res := op.Responses["200"]
+		schema := res.Content["application/json"].Schema
+		require.Equal(t, "array", schema.Type)
+		require.Equal(t, "#/components/schemas/MockItem", schema.Items.Ref)
+
+		item := doc.Components.Schemas["MockItem"]
+		require.NotNil(t, item)
+		require.Equal(t, &OpenAPISchema{Type: "string", Format: "date-time"}, item.Properties["Date"])
+	})
+
+	t.Run("body excludes lambda tagged fields", func(t *testing.T) {
+		op := doc.Paths["/api/{id}"]["post"]
+		require.NotNil(t, op.RequestBody)
+		body := op.RequestBody.Content["application/json"].Schema
+		require.Len(t, body.Properties, 2)
+		require.Contains(t, body.Properties, "name")
+		require.Contains(t, body.Properties, "date")
+		require.Equal(t, []OpenAPIParameter{
+			{Name: "id", In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"}},
+		}, op.Parameters)
+		require.Contains(t, op.Responses, "202")
+	})
+
+	t.Run("undeclared path parameters use the route constraint", func(t *testing.T) {
+		op := doc.Paths["/api/{id}/pages/{page}"]["get"]
+		require.Equal(t, []OpenAPIParameter{
+			{Name: "id", In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"}},
+			{Name: "page", In: "path", Required: true, Schema: &OpenAPISchema{Type: "integer"}},
+		}, op.Parameters)
+		require.Contains(t, op.Responses, "200")
+	})
+
+	t.Run("authenticated and secured routes require bearer auth", func(t *testing.T) {
+		require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Paths["/api/{id}"]["post"].Security)
+		require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Paths["/api/secure/{key}"]["delete"].Security)
+		require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Paths["/api/{id}/pages/{page}"]["get"].Security)
+		require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Paths["/api/{id}"]["put"].Security)
+		require.Contains(t, doc.Paths["/api/secure/{key}"]["delete"].Responses, "401")
+		require.Nil(t, doc.Paths["/api/{id}"]["get"].Security)
+		// middleware passed to Route are opaque
+		require.Nil(t, doc.Paths["/api/{id}"]["patch"].Security)
+		require.Equal(t, "bearer", doc.Components.SecuritySchemes["bearerAuth"].Scheme)
+	})
+
+	t.Run("required scopes are listed on the route", func(t *testing.T) {
+		op := doc.Paths["/api/{id}"]["delete"]
+		require.Equal(t, []string{"items:write", "items:delete"}, op.Scopes)
+		require.Equal(t, []map[string][]string{{"bearerAuth": {}}}, op.Security)
+		require.Contains(t, op.Responses, "403")
+		require.Nil(t, doc.Paths["/api/{id}"]["put"].Scopes)
+
+		jsonBytes, err := json.Marshal(op)
+		require.Nil(t, err)
+		require.Contains(t, string(jsonBytes), `"x-scopes":["items:write","items:delete"]`)
+	})
+
+	t.Run("scopes recorded on the endpoint are merged", func(t *testing.T) {
+		op := doc.Paths["/api/secure/{key}"]["delete"]
+		require.Equal(t, []string{"items:admin", "items:write", "items:audit"}, op.Scopes)
+		require.Contains(t, op.Responses, "403")
+	})
+
+	t.Run("every operation documents the HTTPError schema", func(t *testing.T) {
+		errSchema := doc.Components.Schemas["HTTPError"]
+		require.NotNil(t, errSchema)
+		require.Contains(t, errSchema.Properties, "status")
+		require.Contains(t, errSchema.Properties, "message")
+
+		for path, item := range doc.Paths {
+			for method, op := range item {
+				res, ok := op.Responses["default"]
+				require.True(t, ok, "%s %s", method, path)
+				require.Equal(t, "#/components/schemas/HTTPError", res.Content["application/json"].Schema.Ref)
+			}
+		}
+	})
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) lcom.Middleware {
+		return func(next lcom.Handler) lcom.Handler {
+			return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				calls = append(calls, name)
+				return next(lmw.WithScopes(ctx, strings.Fields(req.Headers["X-Scopes"])), req)
+			}
+		}
+	}
+
+	lmd := NewRouter("/api")
+	lmd.Endpoint(http.MethodGet, "/books/:id", getSomething, record("route")).
+		Use(record("use")).
+		RequireScopes("books:read")
+	lmd.Group("/admin", record("group")).
+		Endpoint(http.MethodDelete, "/books/:id", getSomething).
+		Authenticate(lmw.DecodeStandardMW)
+
+	t.Run("verify middleware added with Use runs after the route's own", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       "/api/books/42",
+			Headers:    map[string]string{"X-Scopes": "books:read"},
+		}
+
+		res, err := lmd.Handler(context.Background(), req)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []string{"route", "use"}, calls)
+	})
+	t.Run("verify RequireScopes rejects reqs without the scopes", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/api/books/42"})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+	t.Run("verify Authenticate adds the decode middleware", func(t *testing.T) {
+		res, err := lmd.Handler(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodDelete, Path: "/api/admin/books/42"})
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,271 @@
+package lrtr
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// paramConstraints are the named constraints that can be used in place of a
+// regular expression in a path parameter, e.g. "/books/:page{int}".
+var paramConstraints = map[string]string{
+	"float":    `-?[0-9]+(\.[0-9]+)?`,
+	"int":      `-?[0-9]+`,
+	"objectid": `[0-9a-fA-F]{24}`,
+	"uint":     `[0-9]+`,
+	"uuid":     `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// node is a single segment of the routing tree. Every registered path is
+// split into its "/" separated segments and inserted one segment per level.
+// Literal segments are stored in the static map, ":<name>" segments in the
+// params list and a trailing "*<name>" segment in the catchAll child. Keeping
+// them apart is what lets matching prefer static segments over parameters,
+// and parameters over catch-alls, without relying on registration or map
+// iteration order.
+type node struct {
+	static   map[string]*node
+	params   []*node
+	catchAll *node
+	route    *route
+
+	// constraint and pattern are only set on param nodes with an inline
+	// constraint. pattern is the constraint as written in the route and is
+	// used to share nodes between routes using the same constraint.
+	constraint *regexp.Regexp
+	pattern    string
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+// insert walks the tree along the given path segments, creating any missing
+// nodes on the way, and returns the node the final segment ends at. An error
+// is returned if a segment is not a valid static, param or catch-all segment.
+func (n *node) insert(segments []string) (*node, error) {
+	current := n
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("catch-all segment %s must be the last segment", segment)
+			}
+			if current.catchAll == nil {
+				current.catchAll = newNode()
+			}
+			current = current.catchAll
+
+		case strings.HasPrefix(segment, ":"):
+			child, err := current.paramChild(segment)
+			if err != nil {
+				return nil, err
+			}
+			current = child
+
+		default:
+			child, ok := current.static[segment]
+			if !ok {
+				child = newNode()
+				current.static[segment] = child
+			}
+			current = child
+		}
+	}
+
+	return current, nil
+}
+
+// paramChild returns the param child for segment, creating it if no other
+// route has used the same constraint at this depth yet. Constrained params
+// are kept in front of unconstrained ones so they are tried first.
+func (n *node) paramChild(segment string) (*node, error) {
+	_, pattern := parseParam(segment)
+
+	for _, child := range n.params {
+		if child.pattern == pattern {
+			return child, nil
+		}
+	}
+
+	child := newNode()
+	child.pattern = pattern
+
+	if pattern != "" {
+		expr, ok := paramConstraints[pattern]
+		if !ok {
+			expr = pattern
+		}
+
+		var err error
+		child.constraint, err = regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint for segment %s: %w", segment, err)
+		}
+
+		// insert before the first unconstrained param
+		i := slices.IndexFunc(n.params, func(p *node) bool { return p.constraint == nil })
+		if i >= 0 {
+			n.params = slices.Insert(n.params, i, child)
+			return child, nil
+		}
+	}
+
+	n.params = append(n.params, child)
+
+	return child, nil
+}
+
+// match finds the route for path, trying static children, then param
+// children and finally the catch-all child at every level and backtracking
+// when a branch dead-ends. The boolean is true if the returned route supports
+// method. If no route supports method but at least one route matched the
+// path, that route is returned with false so the caller can answer with a
+// 405 instead of a 404. Matching unconstrained routes does not allocate.
+func (n *node) match(path, method string) (*route, bool) {
+	if path == "" {
+		if n.route == nil {
+			return nil, false
+		}
+		_, ok := n.route.methods[method]
+		return n.route, ok
+	}
+
+	segment, rest := nextSegment(path)
+
+	var fallback *route
+	if child, ok := n.static[segment]; ok {
+		r, found := child.match(rest, method)
+		if found {
+			return r, true
+		}
+		fallback = r
+	}
+
+	if segment != "" {
+		for _, child := range n.params {
+			if child.constraint != nil && !child.constraint.MatchString(segment) {
+				continue
+			}
+
+			r, found := child.match(rest, method)
+			if found {
+				return r, true
+			}
+			if fallback == nil {
+				fallback = r
+			}
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.route != nil && strings.TrimPrefix(path, "/") != "" {
+		r := n.catchAll.route
+		if _, ok := r.methods[method]; ok {
+			return r, true
+		}
+		if fallback == nil {
+			fallback = r
+		}
+	}
+
+	return fallback, false
+}
+
+// routes returns every route registered at or below the node. Static
+// children are visited in sorted order, followed by the param children and
+// the catch-all child, so the result is deterministic.
+func (n *node) routes() []*route {
+	var routes []*route
+	if n.route != nil {
+		routes = append(routes, n.route)
+	}
+
+	keys := make([]string, 0, len(n.static))
+	for key := range n.static {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		routes = append(routes, n.static[key].routes()...)
+	}
+
+	for _, child := range n.params {
+		routes = append(routes, child.routes()...)
+	}
+
+	if n.catchAll != nil {
+		routes = append(routes, n.catchAll.routes()...)
+	}
+
+	return routes
+}
+
+// pathParams extracts the values of the route's path parameters from a path
+// that is already known to match the route and stores them in the req. A
+// catch-all parameter receives the remainder of the path without its leading
+// slash, e.g. "photos/2024/cat.png" for "/files/*key".
+func (r *route) pathParams(path string, req *events.APIGatewayProxyRequest) {
+	for _, segment := range r.segments {
+		var name, value string
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			name = strings.TrimPrefix(segment, "*")
+			value, path = strings.TrimPrefix(path, "/"), ""
+		case strings.HasPrefix(segment, ":"):
+			name, _ = parseParam(segment)
+			value, path = nextSegment(path)
+		default:
+			_, path = nextSegment(path)
+			continue
+		}
+
+		if req.PathParameters == nil {
+			req.PathParameters = make(map[string]string)
+		}
+
+		req.PathParameters[name], _ = url.QueryUnescape(value)
+	}
+}
+
+// parseParam splits a ":<name>{<constraint>}" segment into its name and
+// constraint. The constraint is empty for a plain ":<name>" segment.
+func parseParam(segment string) (name, pattern string) {
+	name = strings.TrimPrefix(segment, ":")
+
+	i := strings.IndexByte(name, '{')
+	if i < 0 || !strings.HasSuffix(name, "}") {
+		return name, ""
+	}
+
+	return name[:i], name[i+1 : len(name)-1]
+}
+
+// splitPath breaks a route path into its non-empty segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		segments = append(segments, part)
+	}
+
+	return segments
+}
+
+// nextSegment returns the first segment of path (which is expected to begin
+// with a "/") and the remainder of the path after it.
+func nextSegment(path string) (segment, rest string) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.IndexByte(path, '/')
+	if i < 0 {
+		return path, ""
+	}
+
+	return path[:i], path[i:]
+}
@@ -0,0 +1,106 @@
+package lrtr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/seantcanavan/lambda_jwt_router/lcom"
+	"github.com/seantcanavan/lambda_jwt_router/lreq"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+)
+
+// Validator is implemented by request types that can check their own values.
+// Typed calls Valid after unmarshalling the req and before calling the
+// wrapped function.
+type Validator interface {
+	Valid() error
+}
+
+// Typed converts a function working on plain Go types into an lcom.Handler,
+// removing the unmarshal and marshal boilerplate from every handler:
+//
+//	router.Route(http.MethodPost, "/books", lrtr.Typed(books.Create))
+//
+// The returned handler:
+//
+//   - unmarshals the req into a new Req with lreq.UnmarshalReq. The JSON
+//     body is only read if Req has exported fields without a "lambda" struct
+//     tag and the req has a body. Unmarshalling errors return a 400.
+//   - calls Valid if *Req implements Validator. Validation errors return a
+//     400 unless they are an lres.HTTPError, in which case its status is used.
+//   - calls fn and returns its result with lres.Success. A nil result
+//     returns lres.Empty. Errors are returned with lres.Error so an
+//     lres.HTTPError anywhere in the error chain decides the status and all
+//     other errors return a 500.
+func Typed[Req, Res any](fn func(context.Context, *Req) (*Res, error)) lcom.Handler {
+	hasBody := hasBodyFields(reflect.TypeOf((*Req)(nil)).Elem())
+
+	return func(ctx context.Context, lambdaReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		req := new(Req)
+
+		err := lreq.UnmarshalReq(lambdaReq, hasBody && lambdaReq.Body != "", req)
+		if err != nil {
+			return statusOrHTTPError(http.StatusBadRequest, err)
+		}
+
+		if validator, ok := any(req).(Validator); ok {
+			err = validator.Valid()
+			if err != nil {
+				return statusOrHTTPError(http.StatusBadRequest, err)
+			}
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			return lres.Error(err)
+		}
+
+		if res == nil {
+			return lres.Empty()
+		}
+
+		return lres.Success(res)
+	}
+}
+
+// statusOrHTTPError returns err with its own status if it is an
+// lres.HTTPError and with httpStatus otherwise.
+func statusOrHTTPError(httpStatus int, err error) (events.APIGatewayProxyResponse, error) {
+	var httpErr lres.HTTPError
+	if errors.As(err, &httpErr) {
+		return lres.Error(httpErr)
+	}
+
+	return lres.StatusAndError(httpStatus, err)
+}
+
+// hasBodyFields reports whether t is a struct with at least one exported
+// field that is filled from the JSON body rather than a "lambda" struct tag.
+func hasBodyFields(t reflect.Type) bool {
+	t = derefType(t)
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("lambda") != "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.IsExported() || (field.Anonymous && hasBodyFields(field.Type)) {
+			return true
+		}
+	}
+
+	return false
+}
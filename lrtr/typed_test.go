@@ -0,0 +1,141 @@
+package lrtr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/seantcanavan/lambda_jwt_router/lres"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type typedReq struct {
+	ID   primitive.ObjectID `lambda:"path.id"`
+	Name string             `json:"name"`
+}
+
+func (tr *typedReq) Valid() error {
+	if tr.Name == "invalid" {
+		return errors.New("name is invalid")
+	}
+
+	if tr.Name == "teapot" {
+		return lres.HTTPError{Status: http.StatusTeapot, Message: "teapot"}
+	}
+
+	return nil
+}
+
+type typedPathReq struct {
+	ID string `lambda:"path.id"`
+}
+
+type typedRes struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTyped(t *testing.T) {
+	handler := Typed(func(_ context.Context, req *typedReq) (*typedRes, error) {
+		switch req.Name {
+		case "missing":
+			return nil, fmt.Errorf("wrapped: %w", lres.HTTPError{Status: http.StatusNotFound, Message: "not found"})
+		case "broken":
+			return nil, errors.New("broken")
+		case "empty":
+			return nil, nil
+		}
+
+		return &typedRes{ID: req.ID.Hex(), Name: req.Name}, nil
+	})
+
+	id := primitive.NewObjectID()
+	newReq := func(id, body string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": id},
+			Body:           body,
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"bla"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var output typedRes
+		require.Nil(t, lres.Unmarshal(res, &output))
+		require.Equal(t, typedRes{ID: id.Hex(), Name: "bla"}, output)
+	})
+
+	t.Run("invalid body returns 400", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("invalid path param returns 400", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq("not-an-object-id", `{"name":"bla"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("Valid errors return 400", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"invalid"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		var httpErr lres.HTTPError
+		require.Nil(t, lres.Unmarshal(res, &httpErr))
+		require.Equal(t, "name is invalid", httpErr.Message)
+	})
+
+	t.Run("Valid HTTPError keeps its status", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"teapot"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusTeapot, res.StatusCode)
+	})
+
+	t.Run("wrapped HTTPError from fn keeps its status", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"missing"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("other errors from fn return 500", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"broken"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	})
+
+	t.Run("nil result returns empty response", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), `{"name":"empty"}`))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "{}", res.Body)
+	})
+
+	t.Run("empty body skips body unmarshalling", func(t *testing.T) {
+		res, err := handler(context.Background(), newReq(id.Hex(), ""))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("path only request never reads the body", func(t *testing.T) {
+		require.False(t, hasBodyFields(reflect.TypeOf(typedPathReq{})))
+		require.True(t, hasBodyFields(reflect.TypeOf(typedReq{})))
+
+		pathHandler := Typed(func(_ context.Context, req *typedPathReq) (*typedRes, error) {
+			return &typedRes{ID: req.ID}, nil
+		})
+
+		// a GET request with a non JSON body must not fail on the body
+		res, err := pathHandler(context.Background(), newReq("abc", "not json"))
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+}